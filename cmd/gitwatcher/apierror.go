@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// APIError is the body of every API error response, under the "error" key.
+type APIError struct {
+	// Code is a stable snake_case name of the status, such as not_found
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// errorCode derives the error code of an HTTP status.
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// apiError replies with message in the JSON error envelope. It takes the
+// same arguments as http.Error.
+func apiError(w http.ResponseWriter, message string, status int) {
+	apiErrorDetails(w, message, status, nil)
+}
+
+// apiErrorDetails is apiError with details about the failure, such as the
+// invalid fields.
+func apiErrorDetails(w http.ResponseWriter, message string, status int, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error APIError `json:"error"`
+	}{APIError{Code: errorCode(status), Message: message, Details: details}})
+}
+
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	apiError(w, "No such endpoint", http.StatusNotFound)
+}
+
+func handleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	apiError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiPrefix is the prefix of the current version of the API.
+const apiPrefix = "/api/v1"
+
+// deprecatedAPI marks the responses of the unversioned /api routes as
+// deprecated, pointing to their /api/v1 successor. They behave like v1 until
+// a breaking change lands there.
+func deprecatedAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		successor := apiPrefix + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiAction returns the name of an API route for the audit log: its path
+// without the API prefix, the same for every version.
+func apiAction(route string) string {
+	if action := strings.TrimPrefix(route, apiPrefix+"/"); action != route {
+		return action
+	}
+	return strings.TrimPrefix(route, "/api/")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// PendingPR is a generated PR awaiting approval. The embedded draft holds the
+// current (possibly edited) content, while the AI fields keep what the model
+// originally produced for later prompt tuning.
+type PendingPR struct {
+	gitops.PRDraft
+	AITitle   string    `json:"aiTitle"`
+	AIBody    string    `json:"aiBody"`
+	CreatedAt time.Time `json:"createdAt"`
+	EditedAt  time.Time `json:"editedAt,omitempty"`
+}
+
+func (p *PendingPR) Edited() bool {
+	return p.Title != p.AITitle || p.Body != p.AIBody
+}
+
+// setPendingPR stores a freshly generated draft for approval. Drafts that a
+// human already edited are kept rather than overwritten.
+func setPendingPR(repoPath string, draft *gitops.PRDraft) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	repo, exists := state.Repositories[repoPath]
+	if !exists {
+		return
+	}
+	if repo.PendingPR != nil && repo.PendingPR.Edited() {
+		slog.Info("Keeping edited pending PR", "repo", repoPath)
+		return
+	}
+	repo.PendingPR = &PendingPR{
+		PRDraft:   *draft,
+		AITitle:   draft.Title,
+		AIBody:    draft.Body,
+		CreatedAt: time.Now(),
+	}
+}
+
+func pendingPRRepoPath(path string) (string, *PendingPR, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid path")
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	repo, exists := state.Repositories[absPath]
+	if !exists || repo.PendingPR == nil {
+		return "", nil, fmt.Errorf("no pending PR for %s", absPath)
+	}
+	pending := *repo.PendingPR
+	return absPath, &pending, nil
+}
+
+func handleGetPendingPR(w http.ResponseWriter, r *http.Request) {
+	_, pending, err := pendingPRRepoPath(r.URL.Query().Get("path"))
+	if err != nil {
+		apiError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(pending)
+}
+
+func handleEditPendingPR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path  string  `json:"path"`
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath, _, err := pendingPRRepoPath(req.Path)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// The repository may have been removed since pendingPRRepoPath
+	state.mu.Lock()
+	repo, exists := state.Repositories[absPath]
+	if !exists || repo.PendingPR == nil {
+		state.mu.Unlock()
+		apiError(w, fmt.Sprintf("no pending PR for %s", absPath), http.StatusNotFound)
+		return
+	}
+	pending := repo.PendingPR
+	if req.Title != nil {
+		pending.Title = *req.Title
+	}
+	if req.Body != nil {
+		pending.Body = *req.Body
+	}
+	pending.EditedAt = time.Now()
+	edited := *pending
+	state.mu.Unlock()
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(edited)
+}
+
+func handleApprovePendingPR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath, pending, err := pendingPRRepoPath(req.Path)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	githubToken := settings.githubToken(r.Context())
+	pr, err := gitops.SubmitPR(absPath, &pending.PRDraft, githubToken, opts.PROptions(&settings))
+	var nothing *gitops.NothingToPRError
+	if errors.As(err, &nothing) {
+		// The changes were merged some other way, the draft is obsolete
+		state.mu.Lock()
+		if repo, exists := state.Repositories[absPath]; exists {
+			repo.PendingPR = nil
+		}
+		state.mu.Unlock()
+		if err := saveConfig(); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving config", "error", err)
+		}
+		json.NewEncoder(w).Encode(PRResult{Skipped: true, Reason: nothing.Error()})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating PR", "repo", absPath, "operation", "pr", "error", err)
+		apiError(w, fmt.Sprintf("Error creating PR: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	state.mu.Lock()
+	if repo, exists := state.Repositories[absPath]; exists {
+		repo.PendingPR = nil
+	}
+	state.mu.Unlock()
+
+	recordOperation(absPath, Operation{
+		Type:     "pr",
+		Trigger:  TriggerManual,
+		User:     contextUser(r.Context()),
+		PRNumber: pr.Number,
+		PRURL:    pr.HTMLURL,
+		Title:    pr.Title,
+		Body:     pending.Body,
+		AITitle:  pending.AITitle,
+		AIBody:   pending.AIBody,
+	})
+
+	if opts.AutoMerge {
+		if err := gitops.EnableAutoMerge(absPath, pr, githubToken); err != nil {
+			slog.ErrorContext(r.Context(), "Error enabling auto-merge", "repo", absPath, "error", err)
+		}
+	}
+
+	if err := saveConfig(); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving config", "error", err)
+	}
+
+	json.NewEncoder(w).Encode(PRResult{
+		Number: pr.Number,
+		URL:    pr.HTMLURL,
+		Title:  pr.Title,
+	})
+}
+
+func handleRejectPendingPR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath, _, err := pendingPRRepoPath(req.Path)
+	if err != nil {
+		apiError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	state.mu.Lock()
+	if repo, exists := state.Repositories[absPath]; exists {
+		repo.PendingPR = nil
+	}
+	state.mu.Unlock()
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ActorScheduler is the audit actor of scheduled tasks.
+const ActorScheduler = "scheduler"
+
+// defaultAuditLimit is the number of entries returned when no limit is given.
+const defaultAuditLimit = 100
+
+// AuditEntry records one mutating action.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is the GitHub login, "token:<role>" for API tokens, "scheduler"
+	// or "anonymous" when authentication is disabled
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Repo   string `json:"repo,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// RequestID matches the entry with the request's log records
+	RequestID string `json:"requestId,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+type auditKey struct{}
+
+func auditLogPath() (string, error) {
+	configPath, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), "audit.log"), nil
+}
+
+// recordAudit appends entry to the audit log, one JSON object per line.
+func recordAudit(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Error encoding audit entry", "error", err)
+		return
+	}
+
+	path, err := auditLogPath()
+	if err != nil {
+		slog.Error("Error writing audit log", "error", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		slog.Error("Error writing audit log", "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Error("Error writing audit log", "error", err)
+	}
+}
+
+// contextActor describes who is behind ctx for the audit log.
+func contextActor(ctx context.Context) string {
+	if user := contextUser(ctx); user != "" {
+		return user
+	}
+	if role, ok := ctx.Value(roleKey{}).(string); ok {
+		return "token:" + role
+	}
+	return "anonymous"
+}
+
+// auditDetail adds detail to the audit entry of the request, if any.
+func auditDetail(r *http.Request, detail string) {
+	if entry, ok := r.Context().Value(auditKey{}).(*AuditEntry); ok {
+		entry.Detail = detail
+	}
+}
+
+// auditRequests records every API request that is not a GET, named after
+// its route, along with the caller and the response status.
+func auditRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		action := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				action = tmpl
+			}
+		}
+		// GraphQL is POSTed but only serves queries
+		if apiAction(action) == "graphql" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		entry := &AuditEntry{
+			Time:      time.Now(),
+			Actor:     contextActor(r.Context()),
+			Action:    apiAction(action),
+			RequestID: contextRequestID(r.Context()),
+		}
+		if path := requestPath(r); path != "" {
+			if absPath, err := filepath.Abs(path); err == nil {
+				entry.Repo = absPath
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditKey{}, entry)))
+		entry.Status = rec.status
+		recordAudit(*entry)
+	})
+}
+
+// handleAuditLog returns audit entries, newest first, filtered by the repo,
+// actor, action and since (RFC 3339) query parameters and capped by limit.
+// Signed in users only see the entries of the repositories visible to them.
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoFilter := query.Get("repo")
+	if repoFilter != "" {
+		absPath, err := filepath.Abs(repoFilter)
+		if err != nil {
+			apiError(w, "Invalid repo", http.StatusBadRequest)
+			return
+		}
+		repoFilter = absPath
+	}
+	var since time.Time
+	if s := query.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			apiError(w, fmt.Sprintf("Invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit := defaultAuditLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			apiError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	path, err := auditLogPath()
+	if err != nil {
+		apiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditMu.Lock()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		auditMu.Unlock()
+		json.NewEncoder(w).Encode([]AuditEntry{})
+		return
+	}
+	if err != nil {
+		auditMu.Unlock()
+		apiError(w, fmt.Sprintf("Error reading audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	user := contextUser(r.Context())
+	state.mu.RLock()
+	visible := userRepositories(user)
+	state.mu.RUnlock()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxPathBody)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if repoFilter != "" && entry.Repo != repoFilter ||
+			query.Get("actor") != "" && entry.Actor != query.Get("actor") ||
+			query.Get("action") != "" && entry.Action != query.Get("action") ||
+			entry.Time.Before(since) {
+			continue
+		}
+		if _, ok := visible[entry.Repo]; user != "" && entry.Repo != "" && !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	f.Close()
+	auditMu.Unlock()
+
+	// Newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
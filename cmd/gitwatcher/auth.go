@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiTokenEnv overrides the apiToken setting.
+const apiTokenEnv = "GITWATCHER_API_TOKEN"
+
+// apiToken returns the token required by every request, empty when
+// authentication is disabled.
+func apiToken() string {
+	if token := os.Getenv(apiTokenEnv); token != "" {
+		return token
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.Settings.APIToken
+}
+
+// requireAuth rejects requests that neither belong to a GitHub login session
+// nor carry the API or viewer token, either as a bearer token or as the
+// password of basic auth so browsers can prompt for it. Signed in users and
+// the caller's role are attached to the request context.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GitHub webhooks are authenticated by their signature instead
+		if strings.HasPrefix(r.URL.Path, "/auth/") || r.URL.Path == "/hooks/github" ||
+			publicBadges.Load() && strings.HasPrefix(r.URL.Path, "/badge/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if session := requestSession(r); session != nil {
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+			next.ServeHTTP(w, withRole(r, userRole(session.Login)))
+			return
+		}
+
+		token := apiToken()
+		viewer := viewerToken()
+		oauth := oauthEnabled()
+		if token == "" && viewer == "" && !oauth {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		provided := ""
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			provided = bearer
+		} else if _, password, ok := r.BasicAuth(); ok {
+			provided = password
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			next.ServeHTTP(w, withRole(r, RoleAdmin))
+			return
+		}
+		if viewer != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(viewer)) == 1 {
+			next.ServeHTTP(w, withRole(r, RoleViewer))
+			return
+		}
+
+		// Send browsers opening a page to the GitHub login
+		if oauth && r.Method == "GET" && !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Redirect(w, r, "/auth/github/login", http.StatusFound)
+			return
+		}
+		if token != "" || viewer != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="GitWatcher"`)
+		}
+		apiError(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/configfile"
+	"gitwatcher/internal/gitops"
+)
+
+// backupVersion is the version of the backup archive layout.
+const backupVersion = 1
+
+// Entries of a backup archive besides the config file, which keeps its name
+// under config/, and the bundles under bundles/.
+const (
+	backupManifest = "manifest.json"
+	backupState    = "state.json"
+	backupAuditLog = "audit.log"
+)
+
+// BackupManifest describes a backup archive.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Config is the entry of the config file
+	Config string `json:"config"`
+	// Bundles maps repository paths to the entries of their git bundle
+	Bundles map[string]string `json:"bundles,omitempty"`
+}
+
+// RepositoryState is the runtime state of a repository in a backup.
+type RepositoryState struct {
+	History   []Operation         `json:"history,omitempty"`
+	PendingPR *PendingPR          `json:"pendingPR,omitempty"`
+	AIUsage   map[string]*AIUsage `json:"aiUsage,omitempty"`
+}
+
+// RestoreResult reports what a restore brought back.
+type RestoreResult struct {
+	Repositories int      `json:"repositories"`
+	Operations   int      `json:"operations"`
+	Cloned       []string `json:"cloned,omitempty"`
+	AuditLog     bool     `json:"auditLog"`
+}
+
+// handleBackup streams a gzipped tarball of the config file, the history,
+// pending PRs and AI usage of every repository and the audit log. With
+// bundles=true it also holds a git bundle of every repository that git can
+// bundle, so their commits can be restored on another disk.
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	withBundles, _ := strconv.ParseBool(r.URL.Query().Get("bundles"))
+
+	configPath, err := configPath()
+	if err != nil {
+		apiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error reading the config file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	repoStates, err := repositoryStates()
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error reading history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Bundles are made before answering, git only writes them to files
+	manifest := BackupManifest{
+		Version:   backupVersion,
+		CreatedAt: time.Now().UTC(),
+		Config:    "config/" + filepath.Base(configPath),
+	}
+	var bundleDir string
+	if withBundles {
+		bundleDir, err = os.MkdirTemp("", "gitwatcher-bundles-")
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.RemoveAll(bundleDir)
+		manifest.Bundles = make(map[string]string)
+		paths := make([]string, 0, len(repoStates))
+		for repoPath := range repoStates {
+			paths = append(paths, repoPath)
+		}
+		sort.Strings(paths)
+		for i, repoPath := range paths {
+			name := fmt.Sprintf("bundles/%d-%s.bundle", i, filepath.Base(repoPath))
+			if err := gitops.CreateBundle(repoPath, filepath.Join(bundleDir, path.Base(name))); err != nil {
+				// Such as repositories without commits, which git cannot bundle
+				slog.WarnContext(r.Context(), "Leaving a repository out of the backup bundles", "repo", repoPath, "error", err)
+				continue
+			}
+			manifest.Bundles[repoPath] = name
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gitwatcher-backup-%s.tar.gz"`, manifest.CreatedAt.Format("20060102-150405")))
+	if err := writeBackup(w, manifest, config, repoStates, bundleDir); err != nil {
+		// The status is already sent, the truncated archive fails to extract
+		slog.ErrorContext(r.Context(), "Error writing backup", "error", err)
+	}
+}
+
+// repositoryStates returns the runtime state of every repository, with the
+// whole history when there is a state database.
+func repositoryStates() (map[string]*RepositoryState, error) {
+	state.mu.RLock()
+	states := make(map[string]*RepositoryState, len(state.Repositories))
+	for repoPath, repo := range state.Repositories {
+		states[repoPath] = &RepositoryState{
+			History:   append([]Operation(nil), repo.History...),
+			PendingPR: repo.PendingPR,
+			AIUsage:   repo.AIUsage,
+		}
+	}
+	state.mu.RUnlock()
+
+	if stateDB == nil {
+		return states, nil
+	}
+	for repoPath, s := range states {
+		events, err := queryOperations([]string{repoPath}, "", time.Time{}, 0)
+		if err != nil {
+			return nil, err
+		}
+		s.History = make([]Operation, len(events))
+		for i, event := range events {
+			s.History[len(events)-1-i] = event.Operation
+		}
+	}
+	return states, nil
+}
+
+func writeBackup(w io.Writer, manifest BackupManifest, config []byte, repoStates map[string]*RepositoryState, bundleDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add(backupManifest, data); err != nil {
+		return err
+	}
+	if err := add(manifest.Config, config); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(repoStates); err != nil {
+		return err
+	}
+	if err := add(backupState, data); err != nil {
+		return err
+	}
+	if auditPath, err := auditLogPath(); err == nil {
+		auditMu.Lock()
+		data, err := os.ReadFile(auditPath)
+		auditMu.Unlock()
+		if err == nil {
+			if err := add(backupAuditLog, data); err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, name := range manifest.Bundles {
+		if err := addFile(tw, name, filepath.Join(bundleDir, path.Base(name)), manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, name, file string, modTime time.Time) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// handleRestore restores a backup made by handleBackup, sent as the request
+// body. Repositories whose directory is missing are cloned from their
+// bundle, the config file is replaced and applied as when edited, then the
+// history, pending PRs and AI usage of the repositories are replaced. The
+// audit log is only brought back when there is none.
+func handleRestore(w http.ResponseWriter, r *http.Request) {
+	dir, err := os.MkdirTemp("", "gitwatcher-restore-")
+	if err != nil {
+		apiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := extractBackup(r.Body, dir)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Invalid backup: %v", err), http.StatusBadRequest)
+		return
+	}
+	result, err := restoreBackup(manifest, dir)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error restoring backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Restored backup", "created", manifest.CreatedAt, "repositories", result.Repositories, "operations", result.Operations, "cloned", result.Cloned)
+	json.NewEncoder(w).Encode(result)
+}
+
+// extractBackup unpacks a backup archive into dir and returns its manifest.
+func extractBackup(body io.Reader, dir string) (*BackupManifest, error) {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		file, err := backupEntry(dir, header.Name)
+		if err != nil || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, backupManifest))
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", backupManifest)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %v", backupManifest, err)
+	}
+	if manifest.Version > backupVersion {
+		return nil, fmt.Errorf("version %d is newer than the supported version %d", manifest.Version, backupVersion)
+	}
+	if manifest.Config == "" {
+		return nil, fmt.Errorf("%s lists no config file", backupManifest)
+	}
+	return &manifest, nil
+}
+
+// backupEntry returns where the entry name of an archive is extracted in
+// dir, refusing names that would end up outside of it.
+func backupEntry(dir, name string) (string, error) {
+	name = path.Clean(name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid entry %s", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+func restoreBackup(manifest *BackupManifest, dir string) (*RestoreResult, error) {
+	result := &RestoreResult{}
+	configPath, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the config before touching anything
+	backupConfig, err := backupEntry(dir, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(backupConfig)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", manifest.Config)
+	}
+	config, substitutions, _, err := parseConfig(backupConfig, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", manifest.Config, err)
+	}
+	if configfile.FormatOf(backupConfig) != configfile.FormatOf(configPath) {
+		previous, _ := os.ReadFile(configPath)
+		if data, err = configfile.Marshal(configPath, config, previous, substitutions); err != nil {
+			return nil, err
+		}
+	}
+	var repoStates map[string]*RepositoryState
+	if stateData, err := os.ReadFile(filepath.Join(dir, backupState)); err == nil {
+		if err := json.Unmarshal(stateData, &repoStates); err != nil {
+			return nil, fmt.Errorf("%s: %v", backupState, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for repoPath, name := range manifest.Bundles {
+		if _, declared := config.Repositories[repoPath]; !declared {
+			continue
+		}
+		if _, err := os.Stat(repoPath); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		bundle, err := backupEntry(dir, name)
+		if err != nil {
+			return result, err
+		}
+		if err := os.MkdirAll(filepath.Dir(repoPath), 0755); err != nil {
+			return result, err
+		}
+		if err := gitops.CloneBundle(bundle, repoPath); err != nil {
+			return result, fmt.Errorf("error cloning %s: %v", repoPath, err)
+		}
+		result.Cloned = append(result.Cloned, repoPath)
+	}
+	sort.Strings(result.Cloned)
+
+	if err := configfile.Save(configPath, data, 0644); err != nil {
+		return result, err
+	}
+	if err := reloadConfig(); err != nil {
+		return result, fmt.Errorf("error applying the restored config: %v", err)
+	}
+
+	for repoPath, s := range repoStates {
+		restored, err := restoreRepositoryState(repoPath, s)
+		if err != nil {
+			return result, fmt.Errorf("error restoring the history of %s: %v", repoPath, err)
+		}
+		if restored {
+			result.Repositories++
+			result.Operations += len(s.History)
+		}
+	}
+	if err := saveConfig(); err != nil {
+		return result, err
+	}
+
+	if auditData, err := os.ReadFile(filepath.Join(dir, backupAuditLog)); err == nil {
+		result.AuditLog, err = restoreAuditLog(auditData)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// restoreRepositoryState replaces the runtime state of the repository at
+// repoPath with s, and reports whether the repository is watched.
+func restoreRepositoryState(repoPath string, s *RepositoryState) (bool, error) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	repo, exists := state.Repositories[repoPath]
+	if !exists {
+		return false, nil
+	}
+
+	if stateDB != nil {
+		tx, err := stateDB.Begin()
+		if err != nil {
+			return false, err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(stateDB.bind(`INSERT INTO repositories (path) VALUES (?) ON CONFLICT (path) DO NOTHING`), repoPath); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(stateDB.bind(`DELETE FROM operations WHERE repo = ?`), repoPath); err != nil {
+			return false, err
+		}
+		for _, op := range s.History {
+			if err := insertOperation(tx, repoPath, op); err != nil {
+				return false, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return false, err
+		}
+	}
+
+	repo.History = s.History
+	if len(repo.History) > maxHistory {
+		repo.History = repo.History[len(repo.History)-maxHistory:]
+	}
+	repo.PendingPR = s.PendingPR
+	repo.AIUsage = s.AIUsage
+	return true, nil
+}
+
+// restoreAuditLog writes data as the audit log unless there is one already,
+// and reports whether it did.
+func restoreAuditLog(data []byte) (bool, error) {
+	auditPath, err := auditLogPath()
+	if err != nil {
+		return false, err
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if info, err := os.Stat(auditPath); err == nil && info.Size() > 0 {
+		return false, nil
+	}
+	return true, os.WriteFile(auditPath, data, 0600)
+}
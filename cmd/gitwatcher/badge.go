@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// publicBadges serves the status badges without authentication, for pages
+// that embed them as images and cannot send a token.
+var publicBadges atomic.Bool
+
+// Colors of the badge message.
+const (
+	badgeGreen  = "#4c1"
+	badgeYellow = "#dfb317"
+	badgeRed    = "#e05d44"
+	badgeGrey   = "#9f9f9f"
+)
+
+// initPublicBadges makes the badges public when requested by flag or by the
+// GITWATCHER_PUBLIC_BADGES environment variable.
+func initPublicBadges(flagValue bool) {
+	enabled := flagValue
+	if env := os.Getenv("GITWATCHER_PUBLIC_BADGES"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_PUBLIC_BADGES value", "value", env)
+		} else {
+			enabled = enabled || v
+		}
+	}
+	publicBadges.Store(enabled)
+}
+
+// handleBadge serves an SVG badge with the health of the repository at the
+// path following /badge/: synced, dirty, error or missing, and when it last
+// synced.
+func handleBadge(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs("/" + mux.Vars(r)["path"])
+	if err != nil {
+		absPath = ""
+	}
+
+	state.mu.RLock()
+	repo, exists := state.Repositories[absPath]
+	visible := exists && visibleTo(repo, contextUser(r.Context()))
+	var message, color string
+	if visible {
+		message, color = badgeStatus(repo)
+	}
+	state.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// Pages embedding the badge should not show a stale status
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if !visible {
+		w.WriteHeader(http.StatusNotFound)
+		writeBadge(w, "gitwatcher", "not found", badgeGrey)
+		return
+	}
+	writeBadge(w, filepath.Base(absPath), message, color)
+}
+
+// badgeStatus returns the message and color of the badge of repo. The caller
+// must hold state.mu.
+func badgeStatus(repo *Repository) (message, color string) {
+	switch {
+	case repo.Missing:
+		return "missing", badgeGrey
+	case repo.LastError != "":
+		message, color = "error", badgeRed
+	case repo.Status != nil && repo.Status.HasChanges:
+		message, color = "dirty", badgeYellow
+	default:
+		message, color = "synced", badgeGreen
+	}
+	if !repo.LastSync.IsZero() {
+		message += " · " + sinceString(time.Since(repo.LastSync))
+	}
+	return message, color
+}
+
+// sinceString formats how long ago something happened, rounded to the
+// largest unit.
+func sinceString(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// writeBadge writes a flat badge in the style of shields.io. Text widths are
+// estimated from the number of characters, close enough for 11px Verdana.
+func writeBadge(w http.ResponseWriter, label, message, color string) {
+	labelWidth := textWidth(label)
+	messageWidth := textWidth(message)
+	width := labelWidth + messageWidth
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[7]d" y="14">%[4]s</text>
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, width, labelWidth, messageWidth, label, message, color, labelWidth/2, labelWidth+messageWidth/2)
+}
+
+// textWidth estimates the width of a badge half holding text, padding
+// included.
+func textWidth(text string) int {
+	return len([]rune(text))*7 + 10
+}
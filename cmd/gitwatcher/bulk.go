@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// BulkAddResult is the outcome of adding one repository of a bulk request.
+type BulkAddResult struct {
+	Path  string `json:"path"`
+	Added bool   `json:"added"`
+	Error string `json:"error,omitempty"`
+	// Fields lists the invalid fields of the repository, if any
+	Fields FieldErrors `json:"fields,omitempty"`
+}
+
+// BulkAddResponse is the reply to a bulk add.
+type BulkAddResponse struct {
+	Added   int             `json:"added"`
+	Failed  int             `json:"failed"`
+	Results []BulkAddResult `json:"results"`
+}
+
+// handleBulkAddRepositories adds many repositories at once, from a JSON array
+// of repositories or, with a text/plain body, one path per line. Lines can
+// set a schedule like GITWATCHER_REPOSITORIES, as path=schedule, and the
+// group and tags query parameters apply to every line. Each repository is
+// added on its own, so one failure does not stop the others.
+func handleBulkAddRepositories(w http.ResponseWriter, r *http.Request) {
+	var repos []Repository
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/plain" {
+		var err error
+		repos, err = parsePathList(r)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&repos); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(repos) == 0 {
+		apiError(w, "No repositories given", http.StatusBadRequest)
+		return
+	}
+
+	owner := contextUser(r.Context())
+	response := BulkAddResponse{Results: make([]BulkAddResult, 0, len(repos))}
+	for i := range repos {
+		repo := &repos[i]
+		repo.Path = absRequestPath(repo.Path)
+		repo.Owner = owner
+		result := BulkAddResult{Path: repo.Path}
+
+		state.mu.RLock()
+		_, exists := state.Repositories[repo.Path]
+		state.mu.RUnlock()
+		if exists {
+			result.Fields = FieldErrors{"path": "is already watched"}
+		} else {
+			var err error
+			result.Fields, err = addRepository(r.Context(), repo)
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+		if len(result.Fields) > 0 {
+			result.Error = result.Fields.err().Error()
+		}
+
+		if result.Error == "" {
+			result.Added = true
+			response.Added++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if response.Added > 0 {
+		if err := saveConfig(); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving config", "error", err)
+			apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "Repositories added in bulk", "added", response.Added, "failed", response.Failed, "user", owner)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parsePathList reads the repositories of a text/plain bulk add. Blank lines
+// and lines starting with # are skipped.
+func parsePathList(r *http.Request) ([]Repository, error) {
+	group := r.URL.Query().Get("group")
+	var tags []string
+	if value := r.URL.Query().Get("tags"); value != "" {
+		for _, tag := range strings.Split(value, ",") {
+			tags = append(tags, strings.TrimSpace(tag))
+		}
+	}
+
+	state.mu.RLock()
+	inherit := effectiveSchedule(&Repository{Group: group}) != ""
+	state.mu.RUnlock()
+
+	var repos []Repository
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		path, schedule, _ := strings.Cut(line, "=")
+		repo := Repository{Path: strings.TrimSpace(path), Schedule: strings.TrimSpace(schedule), Group: group, Tags: tags}
+		if repo.Schedule == "" && !inherit {
+			repo.Schedule = defaultSchedule
+		}
+		repos = append(repos, repo)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the path list: %v", err)
+	}
+	return repos, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/configfile"
+	"gitwatcher/internal/scheduler"
+)
+
+// configVersion is the version of the config file layout. Changes that
+// rename or reshape fields bump it and add the migration from the previous
+// version to configSchema, so older files keep loading.
+const configVersion = 2
+
+var configSchema = &configfile.Schema{
+	Version: configVersion,
+	Migrations: []configfile.Migration{
+		migrateRepositoryPaths,
+		migrateInstanceLoginToken,
+	},
+}
+
+// parseConfig decodes the content of the config file, migrating it from
+// older versions, and validates it. It returns the version the file had.
+func parseConfig(path string, data []byte) (*savedConfig, configfile.Substitutions, int, error) {
+	var config savedConfig
+	substitutions, version, err := configSchema.Unmarshal(path, data, &config)
+	if err != nil {
+		return nil, nil, version, err
+	}
+	if config.Groups == nil {
+		config.Groups = make(map[string]*RepoGroup)
+	}
+	if config.UserSettings == nil {
+		config.UserSettings = make(map[string]*Settings)
+	}
+	if err := validateConfig(&config); err != nil {
+		return nil, nil, version, err
+	}
+	return &config, substitutions, version, nil
+}
+
+// migrateRepositoryPaths fills in the path of repositories from their key,
+// which hand-written files before version 1 could leave out.
+func migrateRepositoryPaths(doc map[string]interface{}) error {
+	repos, _ := doc["repositories"].(map[string]interface{})
+	for key, value := range repos {
+		if repo, ok := value.(map[string]interface{}); ok {
+			if path, _ := repo["path"].(string); path == "" {
+				repo["path"] = key
+			}
+		}
+	}
+	return nil
+}
+
+// migrateInstanceLoginToken drops the token of the latest GitHub login that
+// files before version 2 kept in the instance settings, where scheduled tasks
+// of shared repositories used it on behalf of whoever signed in last.
+func migrateInstanceLoginToken(doc map[string]interface{}) error {
+	if settings, ok := doc["settings"].(map[string]interface{}); ok {
+		delete(settings, "githubOAuthToken")
+	}
+	return nil
+}
+
+// validateConfig checks the values of a loaded config, reporting the
+// problems by their path in the file, such as /repositories/~1src~1notes/schedule.
+func validateConfig(config *savedConfig) error {
+	errs := FieldErrors{}
+	for key, repo := range config.Repositories {
+		path := configfile.Path("repositories", key)
+		if repo.Path != key {
+			errs.add(path+"/path", "must be the same as the key")
+		}
+		group, inGroup := config.Groups[repo.Group]
+		if repo.Schedule != "" {
+			if err := scheduler.ValidateSchedule(repo.Schedule); err != nil {
+				errs.add(path+"/schedule", err.Error())
+			}
+		} else if !inGroup || group.Schedule == "" {
+			errs.add(path+"/schedule", "is required unless the group has one")
+		}
+		if repo.StaleAfter != "" {
+			if d, err := time.ParseDuration(repo.StaleAfter); err != nil || d <= 0 {
+				errs.add(path+"/staleAfter", "must be a positive duration such as 48h")
+			}
+		}
+		for i, tag := range repo.Tags {
+			if strings.TrimSpace(tag) == "" {
+				errs.add(fmt.Sprintf("%s/tags/%d", path, i), "must not be blank")
+			}
+		}
+		if repo.Group != "" && !inGroup {
+			errs.add(path+"/group", "unknown group "+repo.Group)
+		}
+		validateOptionsAt(repo.RepoOptions, path, errs)
+	}
+	for key, group := range config.Groups {
+		path := configfile.Path("groups", key)
+		if group.Schedule != "" {
+			if err := scheduler.ValidateSchedule(group.Schedule); err != nil {
+				errs.add(path+"/schedule", err.Error())
+			}
+		}
+		validateOptionsAt(group.RepoOptions, path, errs)
+	}
+	validateOptionsAt(config.Settings.Defaults, configfile.Path("settings", "defaults"), errs)
+	if err := config.Settings.validateRoles(); err != nil {
+		errs.add(configfile.Path("settings", "roles"), err.Error())
+	}
+	if err := config.Settings.validateStoredWebhooks(); err != nil {
+		errs.add(configfile.Path("settings", "webhooks"), err.Error())
+	}
+	if err := config.Settings.validateEmail(); err != nil {
+		errs.add(configfile.Path("settings", "smtpHost"), err.Error())
+	}
+	if err := config.Settings.validatePush(); err != nil {
+		errs.add(configfile.Path("settings"), err.Error())
+	}
+	if err := config.Settings.validateMQTT(); err != nil {
+		errs.add(configfile.Path("settings", "mqttBroker"), err.Error())
+	}
+	if err := config.Settings.validateAirGap(); err != nil {
+		errs.add(configfile.Path("settings", "airGappedAllow"), err.Error())
+	}
+	if config.Settings.FailureIssueAfter < 0 {
+		errs.add(configfile.Path("settings", "failureIssueAfter"), "must be 0 or more")
+	}
+	if schedule := config.Settings.UnpushedAuditSchedule; schedule != "" {
+		if err := scheduler.ValidateSchedule(schedule); err != nil {
+			errs.add(configfile.Path("settings", "unpushedAuditSchedule"), err.Error())
+		}
+	}
+	return errs.err()
+}
+
+// validateOptionsAt adds the problems of options found at path to errs.
+func validateOptionsAt(options RepoOptions, path string, errs FieldErrors) {
+	fields := FieldErrors{}
+	options.validateFields(fields)
+	for field, message := range fields {
+		errs.add(path+"/"+field, message)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// defaultDetailHistory is how many operations the repository detail lists.
+const defaultDetailHistory = 20
+
+// RepositoryDetail gathers what a page about one repository shows.
+type RepositoryDetail struct {
+	// Repository holds the configuration and status, without the history
+	Repository Repository `json:"repository"`
+	// Schedule is the effective schedule, which may come from the group
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"nextRun"`
+	LastRun  time.Time `json:"lastRun"`
+	// History is the recent operations, newest first
+	History []Operation `json:"history"`
+	// OpenPRs are the PRs opened by GitWatcher that are still open
+	OpenPRs []gitops.GitHubPRResponse `json:"openPRs"`
+	// PRError tells why the open PRs could not be listed
+	PRError string `json:"prError,omitempty"`
+}
+
+// handleRepositoryDetail returns the status, schedule, recent history and
+// open PRs of the repository at path. history sets how many operations are
+// listed.
+func handleRepositoryDetail(w http.ResponseWriter, r *http.Request) {
+	absPath := absRequestPath(r.URL.Query().Get("path"))
+	limit := defaultDetailHistory
+	if value := r.URL.Query().Get("history"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			apiError(w, "Invalid history", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	state.mu.RLock()
+	repo, exists := state.Repositories[absPath]
+	visible := exists && visibleTo(repo, contextUser(r.Context()))
+	state.mu.RUnlock()
+	if !visible {
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	detail := RepositoryDetail{OpenPRs: []gitops.GitHubPRResponse{}}
+	var err error
+	if detail.History, err = repositoryHistory(absPath, "", time.Time{}, limit); err != nil {
+		apiError(w, fmt.Sprintf("Error reading history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Only PRs GitWatcher recorded opening are listed, which spares a GitHub
+	// request for repositories that never had one
+	prs, err := repositoryHistory(absPath, "pr", time.Time{}, 0)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error reading history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var numbers []int
+	for _, op := range prs {
+		numbers = append(numbers, op.PRNumber)
+	}
+	if len(numbers) > 0 {
+		settings := repoSettings(absPath)
+		open, err := gitops.OpenPRs(absPath, settings.githubToken(r.Context()), numbers)
+		if err != nil {
+			detail.PRError = err.Error()
+		} else if open != nil {
+			detail.OpenPRs = open
+		}
+	}
+
+	if task, scheduled := state.scheduler.Task(absPath); scheduled {
+		detail.NextRun, detail.LastRun = task.Next, task.LastRun
+	}
+
+	// Encoded under the lock, the status and usage can change meanwhile
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if repo, exists = state.Repositories[absPath]; !exists {
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	detail.Repository = *repo
+	detail.Repository.History = nil
+	detail.Schedule = effectiveSchedule(repo)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// handleRepositoryPage serves the page of a repository, which loads its
+// detail from the API.
+func handleRepositoryPage(w http.ResponseWriter, r *http.Request) {
+	user := contextUser(r.Context())
+	state.mu.RLock()
+	data := PageData{
+		Page:     "repository",
+		Settings: state.ownSettings(user),
+		User:     user,
+		Role:     contextRole(r.Context()),
+	}
+	state.mu.RUnlock()
+
+	err := templates.ExecuteTemplate(w, "layout.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/scheduler"
+)
+
+const digestTask = "email-digest"
+
+// digestPage is how many operations of a repository are read at a time
+// while gathering a digest.
+const digestPage = 100
+
+// digestSection is what GitWatcher did on a repository during a digest
+// period, newest first, and the unpushed commits the latest audit found.
+type digestSection struct {
+	path     string
+	commits  []Operation
+	prs      []Operation
+	unpushed []gitops.UnpushedBranch
+}
+
+// scheduleDigest schedules the email digest on the digestSchedule setting,
+// or removes it when the setting is empty.
+func scheduleDigest() {
+	state.mu.RLock()
+	schedule := state.Settings.DigestSchedule
+	state.mu.RUnlock()
+
+	if schedule == "" {
+		state.scheduler.RemoveTask(digestTask)
+		return
+	}
+	if state.scheduler.Schedule(digestTask) == schedule {
+		return
+	}
+	if err := state.scheduler.AddTask(digestTask, schedule, sendDigest); err != nil {
+		slog.Error("Error scheduling the email digest", "error", err)
+	}
+}
+
+// sendDigest mails the digest of the commits and PRs made since the last
+// digest, or over one period of the schedule for the first one. Nothing is
+// sent when there were none.
+func sendDigest() {
+	state.mu.RLock()
+	settings := state.Settings
+	state.mu.RUnlock()
+
+	now := time.Now()
+	since := time.Time{}
+	if task, exists := state.scheduler.Task(digestTask); exists {
+		since = task.LastRun
+	}
+	if since.IsZero() {
+		interval, err := scheduler.Interval(settings.DigestSchedule)
+		if err != nil {
+			slog.Error("Error sending the email digest", "error", err)
+			return
+		}
+		since = now.Add(-interval)
+	}
+
+	sections, err := gatherDigest(since)
+	if err != nil {
+		slog.Error("Error gathering the email digest", "error", err)
+		return
+	}
+	if len(sections) == 0 {
+		slog.Info("Not sending the email digest, no commits or PRs were made and none are unpushed", "since", since)
+		return
+	}
+	if err := sendEmail(&settings, formatDigest(since, now, sections)); err != nil {
+		slog.Error("Error sending the email digest", "error", err)
+	}
+}
+
+// gatherDigest returns the repositories GitWatcher made commits or PRs on
+// since the given time, or that have unpushed commits, sorted by path.
+func gatherDigest(since time.Time) ([]digestSection, error) {
+	state.mu.RLock()
+	paths := make([]string, 0, len(state.Repositories))
+	for path := range state.Repositories {
+		paths = append(paths, path)
+	}
+	state.mu.RUnlock()
+	sort.Strings(paths)
+
+	unpushedReportMu.RLock()
+	unpushed := unpushedReport.Repositories
+	unpushedReportMu.RUnlock()
+
+	var sections []digestSection
+	for _, path := range paths {
+		section := digestSection{path: path, unpushed: unpushed[path]}
+		var err error
+		if section.commits, err = operationsSince(path, "commit", since); err != nil {
+			return nil, err
+		}
+		if section.prs, err = operationsSince(path, "pr", since); err != nil {
+			return nil, err
+		}
+		if len(section.commits) > 0 || len(section.prs) > 0 || len(section.unpushed) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
+
+// operationsSince returns the operations of type opType on the repository at
+// path from after since, newest first.
+func operationsSince(path, opType string, since time.Time) ([]Operation, error) {
+	var operations []Operation
+	before := time.Time{}
+	for {
+		page, err := repositoryHistory(path, opType, before, digestPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range page {
+			if !op.Timestamp.After(since) {
+				return operations, nil
+			}
+			operations = append(operations, op)
+		}
+		if len(page) < digestPage {
+			return operations, nil
+		}
+		before = page[len(page)-1].Timestamp
+	}
+}
+
+// formatDigest writes the digest of sections as a plain text email.
+func formatDigest(since, until time.Time, sections []digestSection) Notification {
+	commits, prs := 0, 0
+	for _, section := range sections {
+		commits += len(section.commits)
+		prs += len(section.prs)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s to %s, GitWatcher made %d commits and opened %d PRs on %d repositories.\n",
+		since.Format(time.RFC1123), until.Format(time.RFC1123), commits, prs, len(sections))
+	for _, section := range sections {
+		fmt.Fprintf(&b, "\n%s\n", section.path)
+		for _, op := range section.prs {
+			fmt.Fprintf(&b, "  PR #%d %s\n    %s\n", op.PRNumber, op.Title, op.PRURL)
+		}
+		for _, op := range section.commits {
+			subject, _, _ := strings.Cut(op.Message, "\n")
+			fmt.Fprintf(&b, "  %.7s %s\n", op.Hash, subject)
+		}
+		for _, branch := range section.unpushed {
+			fmt.Fprintf(&b, "  Unpushed: %d commits on %s exist on no remote\n", branch.Count, branch.Branch)
+		}
+	}
+	return Notification{
+		Title:   fmt.Sprintf("GitWatcher digest: %d commits and %d PRs", commits, prs),
+		Message: b.String(),
+	}
+}
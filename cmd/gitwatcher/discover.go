@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gitwatcher/internal/gitops"
+)
+
+// defaultScanDepth is how many directories below the root a scan looks for
+// repositories, enough for layouts such as ~/src/github.com/owner/repo.
+const defaultScanDepth = 4
+
+// maxScanDepth bounds the depth of a scan requested through the API.
+const maxScanDepth = 8
+
+// DiscoveredRepository is a repository found by a scan.
+type DiscoveredRepository struct {
+	Path string `json:"path"`
+	// Watched is set for repositories that are already watched
+	Watched bool `json:"watched"`
+}
+
+// handleDiscoverRepositories lists the repositories under the root query
+// parameter so they can be added with POST /repositories/bulk.
+func handleDiscoverRepositories(w http.ResponseWriter, r *http.Request) {
+	errs := FieldErrors{}
+	root := absRequestPath(expandHome(r.URL.Query().Get("root")))
+	if root == "" {
+		errs.add("root", "is required")
+	}
+	depth := defaultScanDepth
+	if value := r.URL.Query().Get("depth"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxScanDepth {
+			errs.add("depth", fmt.Sprintf("must be between 1 and %d", maxScanDepth))
+		}
+		depth = n
+	}
+	if writeFieldErrors(w, errs) {
+		return
+	}
+
+	paths, err := gitops.FindRepositories(root, depth)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error scanning %s: %v", root, err), http.StatusBadRequest)
+		return
+	}
+
+	state.mu.RLock()
+	found := make([]DiscoveredRepository, len(paths))
+	for i, path := range paths {
+		_, watched := state.Repositories[path]
+		found[i] = DiscoveredRepository{Path: path, Watched: watched}
+	}
+	state.mu.RUnlock()
+
+	json.NewEncoder(w).Encode(found)
+}
+
+// printRepositories prints the repositories under root one per line, the
+// format POST /repositories/bulk takes as text/plain.
+func printRepositories(root string) error {
+	paths, err := gitops.FindRepositories(expandHome(root), defaultScanDepth)
+	if err != nil {
+		return fmt.Errorf("error scanning %s: %v", root, err)
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+
+	"gitwatcher/internal/secrets"
+)
+
+// secretKeyEnv is the passphrase the secret settings are encrypted with.
+// The machine ID is used when it is not set.
+const secretKeyEnv = "GITWATCHER_SECRET_KEY"
+
+// secretBox encrypts the secret settings in the config file when set.
+var secretBox *secrets.Box
+
+// initEncryption enables encrypting the secret settings when requested by
+// flag or by the GITWATCHER_ENCRYPT_SECRETS environment variable, then
+// decrypts the loaded secrets and encrypts those still in plaintext.
+// Encrypted secrets in the config are an error without it.
+func initEncryption(flagValue bool) error {
+	enabled := flagValue
+	if env := os.Getenv("GITWATCHER_ENCRYPT_SECRETS"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_ENCRYPT_SECRETS value", "value", env)
+		} else {
+			enabled = enabled || v
+		}
+	}
+	if enabled {
+		passphrase, source := os.Getenv(secretKeyEnv), secretKeyEnv
+		if passphrase == "" {
+			id, err := secrets.MachineID()
+			if err != nil {
+				return fmt.Errorf("error reading the machine ID, set %s: %v", secretKeyEnv, err)
+			}
+			passphrase, source = "gitwatcher:"+id, "machine ID"
+		}
+		box, err := secrets.New([]byte(passphrase))
+		if err != nil {
+			return err
+		}
+		secretBox = box
+		slog.Info("Secret settings are encrypted in the config file", "key", source)
+	}
+
+	state.mu.Lock()
+	plaintext, err := decryptSecrets(&state.Settings, "")
+	for login, settings := range state.UserSettings {
+		if err != nil {
+			break
+		}
+		var p bool
+		p, err = decryptSecrets(settings, login)
+		plaintext = plaintext || p
+	}
+	state.updateSSHPassphrases()
+	state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if plaintext && secretBox != nil {
+		slog.Info("Encrypting the plaintext secrets of the config file")
+		return saveConfig()
+	}
+	return nil
+}
+
+// decryptSecrets decrypts the secret fields of the settings of login in
+// place, and reports whether some are still in plaintext. The caller must
+// hold state.mu.
+func decryptSecrets(s *Settings, login string) (bool, error) {
+	plaintext := false
+	for field, value := range secretFields(s) {
+		if _, exists := state.substitutions[secretPath(login, field)]; exists || *value == "" {
+			continue
+		}
+		if !secrets.IsSealed(*value) {
+			plaintext = true
+			continue
+		}
+		if secretBox == nil {
+			return false, fmt.Errorf("%s is encrypted, start with -encrypt-secrets and the same %s", field, secretKeyEnv)
+		}
+		decrypted, err := secretBox.Open(*value)
+		if err != nil {
+			return false, fmt.Errorf("error decrypting %s: %v", field, err)
+		}
+		*value = decrypted
+	}
+	return plaintext, nil
+}
+
+// encryptSecrets encrypts the secret fields of s, the settings of login
+// about to be saved. The caller must hold state.mu.
+func encryptSecrets(s *Settings, login string) error {
+	for field, value := range secretFields(s) {
+		if _, exists := state.substitutions[secretPath(login, field)]; exists || *value == "" {
+			continue
+		}
+		sealed, err := secretBox.Seal(*value)
+		if err != nil {
+			return fmt.Errorf("error encrypting %s: %v", field, err)
+		}
+		*value = sealed
+	}
+	return nil
+}
+
+// encryptedSettings returns copies of the settings to save with their
+// secrets encrypted. The caller must hold state.mu.
+func encryptedSettings(settings Settings, users map[string]*Settings) (Settings, map[string]*Settings, error) {
+	// The webhooks are encrypted in place, away from the running settings
+	settings.Webhooks = slices.Clone(settings.Webhooks)
+	if err := encryptSecrets(&settings, ""); err != nil {
+		return settings, nil, err
+	}
+	copies := make(map[string]*Settings, len(users))
+	for login, s := range users {
+		c := *s
+		c.Webhooks = slices.Clone(c.Webhooks)
+		if err := encryptSecrets(&c, login); err != nil {
+			return settings, nil, err
+		}
+		copies[login] = &c
+	}
+	return settings, copies, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// settingsEnv maps environment variables to the settings they override, so
+// containers can be configured without a config file.
+var settingsEnv = []struct {
+	env     string
+	setting func(s *Settings) interface{}
+}{
+	{"GITWATCHER_OLLAMA_SERVER", func(s *Settings) interface{} { return &s.OllamaServer }},
+	{"GITWATCHER_OLLAMA_MODEL", func(s *Settings) interface{} { return &s.OllamaModel }},
+	{"GITWATCHER_GITHUB_TOKEN", func(s *Settings) interface{} { return &s.GitHubToken }},
+	{"GITWATCHER_AI_SERVICE", func(s *Settings) interface{} { return &s.AIService }},
+	{"GITWATCHER_GEMINI_API_KEY", func(s *Settings) interface{} { return &s.GeminiAPIKey }},
+	{"GITWATCHER_GEMINI_MODEL", func(s *Settings) interface{} { return &s.GeminiModel }},
+	{"GITWATCHER_OPENAI_API_KEY", func(s *Settings) interface{} { return &s.OpenAIAPIKey }},
+	{"GITWATCHER_OPENAI_MODEL", func(s *Settings) interface{} { return &s.OpenAIModel }},
+	{"GITWATCHER_SSH_KEY_PATH", func(s *Settings) interface{} { return &s.SSHKeyPath }},
+	{"GITWATCHER_EXEC_COMMAND", func(s *Settings) interface{} { return &s.ExecCommand }},
+	{"GITWATCHER_GITHUB_CLIENT_ID", func(s *Settings) interface{} { return &s.GitHubClientID }},
+	{"GITWATCHER_GITHUB_CLIENT_SECRET", func(s *Settings) interface{} { return &s.GitHubClientSecret }},
+	{"GITWATCHER_ALLOWED_LOGINS", func(s *Settings) interface{} { return &s.AllowedLogins }},
+	{"GITWATCHER_ALLOWED_ORGS", func(s *Settings) interface{} { return &s.AllowedOrgs }},
+	{"GITWATCHER_COMMIT_FORMAT", func(s *Settings) interface{} { return &s.CommitFormat }},
+	{"GITWATCHER_LANGUAGE", func(s *Settings) interface{} { return &s.Language }},
+	{"GITWATCHER_DIFF_TOKEN_BUDGET", func(s *Settings) interface{} { return &s.DiffTokenBudget }},
+	{"GITWATCHER_AI_TIMEOUT", func(s *Settings) interface{} { return &s.AITimeout }},
+	{"GITWATCHER_UNPUSHED_AUDIT_SCHEDULE", func(s *Settings) interface{} { return &s.UnpushedAuditSchedule }},
+	{"GITWATCHER_SMTP_HOST", func(s *Settings) interface{} { return &s.SMTPHost }},
+	{"GITWATCHER_SMTP_PORT", func(s *Settings) interface{} { return &s.SMTPPort }},
+	{"GITWATCHER_SMTP_USERNAME", func(s *Settings) interface{} { return &s.SMTPUsername }},
+	{"GITWATCHER_SMTP_PASSWORD", func(s *Settings) interface{} { return &s.SMTPPassword }},
+	{"GITWATCHER_EMAIL_FROM", func(s *Settings) interface{} { return &s.EmailFrom }},
+	{"GITWATCHER_EMAIL_TO", func(s *Settings) interface{} { return &s.EmailTo }},
+	{"GITWATCHER_DIGEST_SCHEDULE", func(s *Settings) interface{} { return &s.DigestSchedule }},
+	{"GITWATCHER_NTFY_URL", func(s *Settings) interface{} { return &s.NtfyURL }},
+	{"GITWATCHER_NTFY_TOKEN", func(s *Settings) interface{} { return &s.NtfyToken }},
+	{"GITWATCHER_GOTIFY_URL", func(s *Settings) interface{} { return &s.GotifyURL }},
+	{"GITWATCHER_GOTIFY_TOKEN", func(s *Settings) interface{} { return &s.GotifyToken }},
+	{"GITWATCHER_PUSHOVER_USER_KEY", func(s *Settings) interface{} { return &s.PushoverUserKey }},
+	{"GITWATCHER_PUSHOVER_TOKEN", func(s *Settings) interface{} { return &s.PushoverToken }},
+	{"GITWATCHER_GITHUB_WEBHOOK_SECRET", func(s *Settings) interface{} { return &s.GitHubWebhookSecret }},
+	{"GITWATCHER_MQTT_BROKER", func(s *Settings) interface{} { return &s.MQTTBroker }},
+	{"GITWATCHER_MQTT_USERNAME", func(s *Settings) interface{} { return &s.MQTTUsername }},
+	{"GITWATCHER_MQTT_PASSWORD", func(s *Settings) interface{} { return &s.MQTTPassword }},
+	{"GITWATCHER_MQTT_TOPIC_PREFIX", func(s *Settings) interface{} { return &s.MQTTTopicPrefix }},
+	{"GITWATCHER_AIR_GAPPED_ALLOW", func(s *Settings) interface{} { return &s.AirGappedAllow }},
+	{"GITWATCHER_FAILURE_ISSUE_AFTER", func(s *Settings) interface{} { return &s.FailureIssueAfter }},
+}
+
+// repositoriesEnv seeds repositories that are not in the config yet. Entries
+// are separated by newlines or semicolons and are a path, optionally
+// followed by =schedule.
+const repositoriesEnv = "GITWATCHER_REPOSITORIES"
+
+const defaultSchedule = "0 * * * *"
+
+// defaultListenAddress is where the dashboard and REST API are served unless
+// -listen or GITWATCHER_LISTEN is set.
+const defaultListenAddress = "0.0.0.0:8082"
+
+// flagOrEnv returns flagValue when set, then the environment variable env,
+// then def.
+func flagOrEnv(flagValue, env, def string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return def
+}
+
+// fileSettings are the instance settings as the config file has them,
+// before the environment overrides. Guarded by state.mu.
+var fileSettings Settings
+
+// applyEnvironment overrides the loaded settings with the GITWATCHER_*
+// environment variables and adds the repositories of GITWATCHER_REPOSITORIES.
+// The overrides only live in memory, like GITWATCHER_API_TOKEN, so secrets
+// passed through the environment never reach the config file.
+func applyEnvironment() error {
+	state.mu.Lock()
+	err := overrideSettings(&state.Settings)
+	state.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if _, err := seedRepositories(os.Getenv(repositoriesEnv)); err != nil {
+		return fmt.Errorf("invalid %s: %v", repositoriesEnv, err)
+	}
+	return nil
+}
+
+// overrideSettings remembers s as the file settings and overrides it with
+// the environment variables. The caller must hold state.mu.
+func overrideSettings(s *Settings) error {
+	fileSettings = *s
+	for _, e := range settingsEnv {
+		value, ok := os.LookupEnv(e.env)
+		if !ok {
+			continue
+		}
+		switch setting := e.setting(s).(type) {
+		case *string:
+			*setting = value
+		case *int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", e.env, err)
+			}
+			*setting = n
+		case *[]string:
+			// Lists are comma separated
+			*setting = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*setting = append(*setting, item)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// withoutEnvironment returns s with the settings overridden by the
+// environment put back to their file values, which is what gets saved. The
+// caller must hold state.mu.
+func withoutEnvironment(s Settings) Settings {
+	for _, e := range settingsEnv {
+		if _, ok := os.LookupEnv(e.env); ok {
+			reflect.ValueOf(e.setting(&s)).Elem().Set(reflect.ValueOf(e.setting(&fileSettings)).Elem())
+		}
+	}
+	return s
+}
+
+// seedRepositories adds and schedules the repositories listed in value that
+// are not watched yet, and reports whether any were added.
+func seedRepositories(value string) (bool, error) {
+	entries := strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ';' })
+	added := false
+	for _, entry := range entries {
+		path, schedule, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if path == "" {
+			continue
+		}
+		repo := &Repository{Path: absRequestPath(strings.TrimSpace(path)), Schedule: strings.TrimSpace(schedule), RunState: RunIdle}
+		if repo.Schedule == "" {
+			repo.Schedule = defaultSchedule
+		}
+
+		state.mu.RLock()
+		_, exists := state.Repositories[repo.Path]
+		state.mu.RUnlock()
+		if exists {
+			continue
+		}
+		if err := validateRepository(repo).err(); err != nil {
+			return added, fmt.Errorf("%s: %v", repo.Path, err)
+		}
+		if err := repo.GetStatus(); err != nil {
+			slog.Warn("Error getting repo status", "repo", repo.Path, "error", err)
+		}
+
+		state.mu.Lock()
+		state.Repositories[repo.Path] = repo
+		err := scheduleRepository(repo)
+		state.mu.Unlock()
+		path = repo.Path
+		if err != nil {
+			return added, fmt.Errorf("%s: %v", path, err)
+		}
+		added = true
+		slog.Info("Repository added from the environment", "repo", path, "schedule", repo.Schedule)
+	}
+	return added, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// trackScheduledRun counts the consecutive failures of the scheduled runs of
+// the repository at path. Past the failureIssueAfter setting, each failure
+// files or updates a GitHub issue on the repository, which is closed by the
+// next successful run.
+func trackScheduledRun(path string, err error) {
+	if errors.Is(err, errRepositoryBusy) {
+		return
+	}
+
+	state.mu.Lock()
+	repo, exists := state.Repositories[path]
+	if !exists || repo.Missing {
+		state.mu.Unlock()
+		return
+	}
+	previous := repo.Failures
+	if err != nil {
+		repo.Failures++
+	} else {
+		repo.Failures = 0
+	}
+	failures := repo.Failures
+	settings := state.settingsFor(path)
+	state.mu.Unlock()
+
+	threshold := settings.FailureIssueAfter
+	switch {
+	case threshold == 0:
+	case err != nil && failures >= threshold:
+		go fileFailureIssue(path, settings.githubToken(context.Background()), failures, err)
+	case err == nil && previous >= threshold:
+		go closeFailureIssue(path, settings.githubToken(context.Background()), previous)
+	}
+}
+
+// failureIssueTitle is the title of the failure issue of the repository at
+// path, which finds it again on later runs.
+func failureIssueTitle(path string) string {
+	return fmt.Sprintf("GitWatcher: scheduled syncs of %s are failing", filepath.Base(path))
+}
+
+// fileFailureIssue files the failure issue of the repository at path, or
+// updates its body with the latest error.
+func fileFailureIssue(path, githubToken string, failures int, err error) {
+	body := fmt.Sprintf("The scheduled syncs of `%s` by GitWatcher have failed %d times in a row.\n\n"+
+		"Last failure, at %s:\n\n```\n%s\n```\n\n"+
+		"This issue is updated on every failed run and closed once a scheduled sync succeeds again.\n",
+		filepath.Base(path), failures, time.Now().Format(time.RFC1123), err)
+	issue, issueErr := gitops.FileFailureIssue(path, githubToken, failureIssueTitle(path), body)
+	if issueErr != nil {
+		slog.Warn("Error filing failure issue", "repo", path, "failures", failures, "error", issueErr)
+		return
+	}
+	slog.Info("Filed failure issue", "repo", path, "failures", failures, "issue", issue.HTMLURL)
+}
+
+// closeFailureIssue closes the failure issue of the repository at path once
+// it syncs again.
+func closeFailureIssue(path, githubToken string, failures int) {
+	comment := fmt.Sprintf("The scheduled sync succeeded at %s after %d failed runs.\n", time.Now().Format(time.RFC1123), failures)
+	issue, err := gitops.CloseFailureIssue(path, githubToken, failureIssueTitle(path), comment)
+	if err != nil {
+		slog.Warn("Error closing failure issue", "repo", path, "error", err)
+		return
+	}
+	if issue != nil {
+		slog.Info("Closed failure issue", "repo", path, "issue", issue.HTMLURL)
+	}
+}
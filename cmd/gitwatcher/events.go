@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// repoChanges queues the paths of repositories whose state changed. It is
+// buffered so notifyRepoChanged can be called while holding state.mu.
+var repoChanges = make(chan string, 256)
+
+type eventSubscriber struct {
+	user   string
+	events chan []byte
+}
+
+var repoEvents = struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	// last holds the latest payload sent per repository to skip repeats
+	last map[string][]byte
+}{
+	subscribers: make(map[*eventSubscriber]struct{}),
+	last:        make(map[string][]byte),
+}
+
+// notifyRepoChanged tells the clients following /api/events that the
+// repository at path may have changed.
+func notifyRepoChanged(path string) {
+	select {
+	case repoChanges <- path:
+	default:
+	}
+}
+
+// broadcastRepoChanges sends the state of every changed repository to the
+// subscribers allowed to see it.
+func broadcastRepoChanges() {
+	for path := range repoChanges {
+		state.mu.RLock()
+		repo, exists := state.Repositories[path]
+		if !exists {
+			state.mu.RUnlock()
+			// The repository was removed or moved
+			repoEvents.mu.Lock()
+			_, published := repoEvents.last[path]
+			delete(repoEvents.last, path)
+			repoEvents.mu.Unlock()
+			if published {
+				clearMQTTState(path)
+			}
+			continue
+		}
+		// History and usage have their own endpoints and grow large
+		snapshot := *repo
+		snapshot.History = nil
+		snapshot.AIUsage = nil
+		payload, err := json.Marshal(snapshot)
+		state.mu.RUnlock()
+		if err != nil {
+			continue
+		}
+
+		repoEvents.mu.Lock()
+		if bytes.Equal(repoEvents.last[path], payload) {
+			repoEvents.mu.Unlock()
+			continue
+		}
+		repoEvents.last[path] = payload
+		publishMQTTState(&snapshot)
+		for sub := range repoEvents.subscribers {
+			if !visibleTo(&snapshot, sub.user) {
+				continue
+			}
+			select {
+			case sub.events <- payload:
+			default:
+			}
+		}
+		repoEvents.mu.Unlock()
+	}
+}
+
+// handleEvents streams a "repository" Server-Sent Event with the repository
+// whenever its status, last sync or error changes.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	sub := &eventSubscriber{user: contextUser(r.Context()), events: make(chan []byte, 64)}
+	repoEvents.mu.Lock()
+	repoEvents.subscribers[sub] = struct{}{}
+	repoEvents.mu.Unlock()
+	defer func() {
+		repoEvents.mu.Lock()
+		delete(repoEvents.subscribers, sub)
+		repoEvents.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamsDone:
+			return
+		case payload := <-sub.events:
+			fmt.Fprintf(w, "event: repository\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
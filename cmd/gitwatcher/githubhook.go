@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/webhook"
+)
+
+const (
+	githubEventHeader     = "X-GitHub-Event"
+	githubSignatureHeader = "X-Hub-Signature-256"
+)
+
+// maxGitHubHookBody is the largest payload GitHub sends.
+const maxGitHubHookBody = 25 << 20
+
+// GitHubHookResult lists the repositories refreshed for a GitHub webhook.
+type GitHubHookResult struct {
+	Event        string   `json:"event"`
+	Repositories []string `json:"repositories"`
+}
+
+// handleGitHubHook receives GitHub webhooks signed with the
+// githubWebhookSecret setting. Pushes refresh the watched repositories whose
+// origin is the pushed repository, in the background; other events are
+// acknowledged and ignored.
+func handleGitHubHook(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	secret := state.Settings.GitHubWebhookSecret
+	state.mu.RUnlock()
+	if secret == "" {
+		apiError(w, "GitHub webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGitHubHookBody))
+	if err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !webhook.Verify(secret, body, r.Header.Get(githubSignatureHeader)) {
+		apiError(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	result := GitHubHookResult{Event: r.Header.Get(githubEventHeader), Repositories: []string{}}
+	if result.Event != "push" {
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	var push struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		apiError(w, "Invalid push payload", http.StatusBadRequest)
+		return
+	}
+
+	result.Repositories = githubClones(push.Repository.FullName)
+	for _, path := range result.Repositories {
+		slog.InfoContext(r.Context(), "Refreshing repository after a GitHub push", "repo", path, "ref", push.Ref)
+		go refreshAfterPush(path)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(result)
+}
+
+// githubClones returns the paths of the watched repositories whose origin is
+// the GitHub repository fullName, such as "owner/name".
+func githubClones(fullName string) []string {
+	state.mu.RLock()
+	var paths []string
+	for path, repo := range state.Repositories {
+		if !repo.Missing {
+			paths = append(paths, path)
+		}
+	}
+	state.mu.RUnlock()
+
+	clones := []string{}
+	for _, path := range paths {
+		owner, name, err := gitops.GitHubRepository(path)
+		if err == nil && owner != "" && strings.EqualFold(owner+"/"+name, fullName) {
+			clones = append(clones, path)
+		}
+	}
+	return clones
+}
+
+// refreshAfterPush refreshes the repository at path from its remote, unless
+// it is already running.
+func refreshAfterPush(path string) {
+	if err := beginRun(path, StepFetch); err != nil {
+		slog.Info("Not refreshing repository after a GitHub push", "repo", path, "error", err)
+		return
+	}
+	defer endRun(path)
+	if _, err := refreshRemote(context.Background(), path); err != nil {
+		slog.Warn("Error refreshing repository after a GitHub push", "repo", path, "error", err)
+	}
+}
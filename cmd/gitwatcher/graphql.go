@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gitwatcher/internal/graphql"
+)
+
+// repositorySnapshot copies a repository so it can be read once state.mu is
+// released. The caller must hold state.mu.
+func repositorySnapshot(repo *Repository) *Repository {
+	snapshot := *repo
+	snapshot.History = append([]Operation(nil), repo.History...)
+	return &snapshot
+}
+
+// dashboardSchema is the GraphQL graph visible to the caller behind ctx:
+// their repositories with status and history, the groups, the activity
+// feed and, for admins, the settings.
+func dashboardSchema(ctx context.Context) *graphql.Schema {
+	user := contextUser(ctx)
+	return &graphql.Schema{
+		Query: map[string]graphql.Resolver{
+			"repositories": func(args map[string]interface{}) (interface{}, error) {
+				group, err := graphql.StringArg(args, "group")
+				if err != nil {
+					return nil, err
+				}
+				state.mu.RLock()
+				defer state.mu.RUnlock()
+				repos := []*Repository{}
+				for _, repo := range userRepositories(user) {
+					if group == "" || repo.Group == group {
+						repos = append(repos, repositorySnapshot(repo))
+					}
+				}
+				sort.Slice(repos, func(i, j int) bool { return repos[i].Path < repos[j].Path })
+				return repos, nil
+			},
+			"repository": func(args map[string]interface{}) (interface{}, error) {
+				path, err := graphql.StringArg(args, "path")
+				if err != nil || path == "" {
+					return nil, fmt.Errorf("argument path is required")
+				}
+				absPath, err := filepath.Abs(path)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path")
+				}
+				state.mu.RLock()
+				defer state.mu.RUnlock()
+				repo, exists := state.Repositories[absPath]
+				if !exists || !visibleTo(repo, user) {
+					return nil, nil
+				}
+				return repositorySnapshot(repo), nil
+			},
+			"groups": func(args map[string]interface{}) (interface{}, error) {
+				state.mu.RLock()
+				defer state.mu.RUnlock()
+				groups := []RepoGroup{}
+				for _, group := range state.Groups {
+					groups = append(groups, *group)
+				}
+				sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+				return groups, nil
+			},
+			"settings": func(args map[string]interface{}) (interface{}, error) {
+				if role := contextRole(ctx); role != RoleAdmin {
+					return nil, fmt.Errorf("Forbidden for the %s role", role)
+				}
+				state.mu.RLock()
+				defer state.mu.RUnlock()
+				return state.ownSettings(user), nil
+			},
+			"activity": func(args map[string]interface{}) (interface{}, error) {
+				limit, err := graphql.IntArg(args, "limit", defaultActivityLimit)
+				if err != nil || limit <= 0 {
+					return nil, fmt.Errorf("invalid limit")
+				}
+				opType, err := graphql.StringArg(args, "type")
+				if err != nil {
+					return nil, err
+				}
+				b, err := graphql.StringArg(args, "before")
+				if err != nil {
+					return nil, err
+				}
+				var before time.Time
+				if b != "" {
+					if before, err = time.Parse(time.RFC3339Nano, b); err != nil {
+						return nil, fmt.Errorf("invalid before: %v", err)
+					}
+				}
+				return activityFeed(user, opType, before, limit), nil
+			},
+		},
+		Fields: map[string]map[string]graphql.FieldResolver{
+			"Repository": {
+				// history is newest first and takes the filters of the activity
+				// endpoint
+				"history": func(parent interface{}, args map[string]interface{}) (interface{}, error) {
+					repo := parent.(Repository)
+					limit, err := graphql.IntArg(args, "limit", maxHistory)
+					if err != nil || limit <= 0 {
+						return nil, fmt.Errorf("invalid limit")
+					}
+					opType, err := graphql.StringArg(args, "type")
+					if err != nil {
+						return nil, err
+					}
+					operations := []Operation{}
+					for i := len(repo.History) - 1; i >= 0 && len(operations) < limit; i-- {
+						if opType == "" || repo.History[i].Type == opType {
+							operations = append(operations, repo.History[i])
+						}
+					}
+					return operations, nil
+				},
+			},
+		},
+	}
+}
+
+// handleGraphQL runs a GraphQL query, sent as JSON in a POST body or in the
+// query, operationName and variables parameters of a GET.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == "GET" {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				apiError(w, fmt.Sprintf("Invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		apiError(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	resp := dashboardSchema(r.Context()).Execute(req)
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/scheduler"
+)
+
+// RepoOptions holds the per-repository behaviour that can be defined on a
+// group and overridden by its member repositories. Unset fields inherit.
+// RequireApproval holds generated PRs for review instead of opening them.
+type RepoOptions struct {
+	AutoMerge           *bool    `json:"autoMerge,omitempty"`
+	WaitForChecks       *bool    `json:"waitForChecks,omitempty"`
+	ForcePush           *bool    `json:"forcePush,omitempty"`
+	SquashCommits       *bool    `json:"squashCommits,omitempty"`
+	RequireApproval     *bool    `json:"requireApproval,omitempty"`
+	UpdateChangelog     *bool    `json:"updateChangelog,omitempty"`
+	IgnoreSymlinks      *bool    `json:"ignoreSymlinks,omitempty"`
+	IgnoreExecutableBit *bool    `json:"ignoreExecutableBit,omitempty"`
+	IgnoreModeChanges   *bool    `json:"ignoreModeChanges,omitempty"`
+	SplitCommits        *bool    `json:"splitCommits,omitempty"`
+	ClassifyChanges     *bool    `json:"classifyChanges,omitempty"`
+	RiskAssessment      *bool    `json:"riskAssessment,omitempty"`
+	LocalAIOnly         *bool    `json:"localAIOnly,omitempty"`
+	RedactSecrets       *bool    `json:"redactSecrets,omitempty"`
+	Watch               *bool    `json:"watch,omitempty"`
+	WatchSettle         string   `json:"watchSettle,omitempty"`
+	AIType              string   `json:"aiService,omitempty"`
+	AIModel             string   `json:"aiModel,omitempty"`
+	PromptTemplate      string   `json:"promptTemplate,omitempty"`
+	CommitTemplate      string   `json:"commitTemplate,omitempty"`
+	CommitTrailers      []string `json:"commitTrailers,omitempty"`
+	PRLabels            []string `json:"prLabels,omitempty"`
+	NoisePaths          []string `json:"noisePaths,omitempty"`
+	RedactPatterns      []string `json:"redactPatterns,omitempty"`
+	RedactPaths         []string `json:"redactPaths,omitempty"`
+	// Scopes limits a monorepo to some of its paths, such as docs/
+	Scopes []string `json:"scopes,omitempty"`
+	// CommitAreas commits the changes of each path, such as apps/web/, apart
+	CommitAreas []string `json:"commitAreas,omitempty"`
+}
+
+// RepoGroup holds the defaults of its member repositories. Members without
+// a schedule of their own sync on the schedule of the group.
+type RepoGroup struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule,omitempty"`
+	RepoOptions
+}
+
+// ResolvedOptions are the effective options of a repository after applying
+// its group and local overrides.
+type ResolvedOptions struct {
+	AutoMerge           bool
+	WaitForChecks       bool
+	ForcePush           bool
+	SquashCommits       bool
+	RequireApproval     bool
+	UpdateChangelog     bool
+	IgnoreSymlinks      bool
+	IgnoreExecutableBit bool
+	IgnoreModeChanges   bool
+	SplitCommits        bool
+	ClassifyChanges     bool
+	RiskAssessment      bool
+	LocalAIOnly         bool
+	RedactSecrets       bool
+	Watch               bool
+	WatchSettle         string
+	AIType              string
+	AIModel             string
+	PromptTemplate      string
+	CommitTemplate      string
+	CommitTrailers      []string
+	PRLabels            []string
+	NoisePaths          []string
+	RedactPatterns      []string
+	RedactPaths         []string
+	Scopes              []string
+	CommitAreas         []string
+	// path is the repository the options were resolved for, if any
+	path string
+}
+
+// apply overlays the fields set in o onto r.
+func (o RepoOptions) apply(r *ResolvedOptions) {
+	if o.AutoMerge != nil {
+		r.AutoMerge = *o.AutoMerge
+	}
+	if o.WaitForChecks != nil {
+		r.WaitForChecks = *o.WaitForChecks
+	}
+	if o.ForcePush != nil {
+		r.ForcePush = *o.ForcePush
+	}
+	if o.SquashCommits != nil {
+		r.SquashCommits = *o.SquashCommits
+	}
+	if o.RequireApproval != nil {
+		r.RequireApproval = *o.RequireApproval
+	}
+	if o.UpdateChangelog != nil {
+		r.UpdateChangelog = *o.UpdateChangelog
+	}
+	if o.IgnoreSymlinks != nil {
+		r.IgnoreSymlinks = *o.IgnoreSymlinks
+	}
+	if o.IgnoreExecutableBit != nil {
+		r.IgnoreExecutableBit = *o.IgnoreExecutableBit
+	}
+	if o.IgnoreModeChanges != nil {
+		r.IgnoreModeChanges = *o.IgnoreModeChanges
+	}
+	if o.SplitCommits != nil {
+		r.SplitCommits = *o.SplitCommits
+	}
+	if o.ClassifyChanges != nil {
+		r.ClassifyChanges = *o.ClassifyChanges
+	}
+	if o.RiskAssessment != nil {
+		r.RiskAssessment = *o.RiskAssessment
+	}
+	if o.LocalAIOnly != nil {
+		r.LocalAIOnly = *o.LocalAIOnly
+	}
+	if o.RedactSecrets != nil {
+		r.RedactSecrets = *o.RedactSecrets
+	}
+	if o.Watch != nil {
+		r.Watch = *o.Watch
+	}
+	if o.WatchSettle != "" {
+		r.WatchSettle = o.WatchSettle
+	}
+	if o.AIType != "" {
+		r.AIType = o.AIType
+	}
+	if o.AIModel != "" {
+		r.AIModel = o.AIModel
+	}
+	if o.PromptTemplate != "" {
+		r.PromptTemplate = o.PromptTemplate
+	}
+	if o.CommitTemplate != "" {
+		r.CommitTemplate = o.CommitTemplate
+	}
+	if o.CommitTrailers != nil {
+		r.CommitTrailers = o.CommitTrailers
+	}
+	if o.PRLabels != nil {
+		r.PRLabels = o.PRLabels
+	}
+	if o.NoisePaths != nil {
+		r.NoisePaths = o.NoisePaths
+	}
+	if o.RedactPatterns != nil {
+		r.RedactPatterns = o.RedactPatterns
+	}
+	if o.RedactPaths != nil {
+		r.RedactPaths = o.RedactPaths
+	}
+	if o.Scopes != nil {
+		r.Scopes = o.Scopes
+	}
+	if o.CommitAreas != nil {
+		r.CommitAreas = o.CommitAreas
+	}
+}
+
+// resolveOptions returns the effective options of repo, layering the
+// defaults of its owner or the instance, its group and its own overrides. The caller must hold
+// state.mu.
+func resolveOptions(repo *Repository) ResolvedOptions {
+	var resolved ResolvedOptions
+	state.settingsFor(repo.Path).Defaults.apply(&resolved)
+	if group, exists := state.Groups[repo.Group]; exists {
+		group.RepoOptions.apply(&resolved)
+	}
+	repo.RepoOptions.apply(&resolved)
+	resolved.path = repo.Path
+	return resolved
+}
+
+// effectiveSchedule returns the schedule of repo, falling back on the one of
+// its group. The caller must hold state.mu.
+func effectiveSchedule(repo *Repository) string {
+	if repo.Schedule != "" {
+		return repo.Schedule
+	}
+	if group, exists := state.Groups[repo.Group]; exists {
+		return group.Schedule
+	}
+	return ""
+}
+
+// scheduleRepository schedules the sync of repo on its effective schedule,
+// leaving the task alone when it already runs on it, and watches its worktree
+// when the watch option is set. Missing repositories are neither scheduled
+// nor watched. The caller must hold state.mu.
+func scheduleRepository(repo *Repository) error {
+	updateWatch(repo)
+	if repo.Missing {
+		state.scheduler.RemoveTask(repo.Path)
+		return nil
+	}
+	schedule := effectiveSchedule(repo)
+	if state.scheduler.Schedule(repo.Path) == schedule {
+		return nil
+	}
+	path := repo.Path
+	return state.scheduler.AddTask(path, schedule, func() {
+		handleScheduledTask(path)
+	})
+}
+
+// rescheduleRepositories moves every repository to its effective schedule,
+// after groups changed. The caller must hold state.mu.
+func rescheduleRepositories() {
+	for path, repo := range state.Repositories {
+		if err := scheduleRepository(repo); err != nil {
+			slog.Error("Error setting up schedule", "repo", path, "error", err)
+		}
+	}
+}
+
+// filterRepositories returns the repositories of repos in group, when set,
+// and tagged with tag, when set.
+func filterRepositories(repos map[string]*Repository, group, tag string) map[string]*Repository {
+	if group == "" && tag == "" {
+		return repos
+	}
+	filtered := make(map[string]*Repository)
+	for path, repo := range repos {
+		if group != "" && repo.Group != group || tag != "" && !slices.Contains(repo.Tags, tag) {
+			continue
+		}
+		filtered[path] = repo
+	}
+	return filtered
+}
+
+// AIService builds the AI configuration of the repository, applying its
+// service and model overrides on top of the instance settings.
+func (o ResolvedOptions) AIService(settings *Settings) gitops.AIService {
+	s := *settings
+	if o.AIType != "" {
+		s.AIService = o.AIType
+	}
+	if o.AIModel != "" {
+		switch s.AIService {
+		case "gemini":
+			s.GeminiModel = o.AIModel
+		case "openai":
+			s.OpenAIModel = o.AIModel
+		default:
+			s.OllamaModel = o.AIModel
+		}
+	}
+
+	aiService := s.GetAIService()
+	aiService.PromptTemplate = o.PromptTemplate
+	aiService.NoisePaths = o.NoisePaths
+	aiService.LocalOnly = o.LocalAIOnly
+	aiService.RedactSecrets = o.RedactSecrets
+	aiService.RedactPatterns = o.RedactPatterns
+	aiService.RedactPaths = o.RedactPaths
+	if o.path != "" {
+		path := o.path
+		aiService.OnUsage = func(usage gitops.Usage) {
+			recordAIUsage(path, usage)
+		}
+	}
+	return aiService
+}
+
+func (o ResolvedOptions) CommitOptions() gitops.CommitOptions {
+	return gitops.CommitOptions{
+		Template:            o.CommitTemplate,
+		Trailers:            o.CommitTrailers,
+		UpdateChangelog:     o.UpdateChangelog,
+		IgnoreSymlinks:      o.IgnoreSymlinks,
+		IgnoreExecutableBit: o.IgnoreExecutableBit,
+		IgnoreModeChanges:   o.IgnoreModeChanges,
+		SplitCommits:        o.SplitCommits,
+		ClassifyChanges:     o.ClassifyChanges,
+		Scopes:              o.Scopes,
+		CommitAreas:         o.CommitAreas,
+	}
+}
+
+func (o ResolvedOptions) PROptions(settings *Settings) gitops.PROptions {
+	return gitops.PROptions{
+		Labels:          o.PRLabels,
+		SSHKeyPath:      settings.SSHKeyPath,
+		LabelChangeType: o.ClassifyChanges,
+		RiskAssessment:  o.RiskAssessment,
+	}
+}
+
+// repoOptions resolves the options of the repository at path, falling back to
+// the instance defaults for paths that are not watched.
+func repoOptions(path string) ResolvedOptions {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	if repo, exists := state.Repositories[path]; exists {
+		return resolveOptions(repo)
+	}
+	return resolveOptions(&Repository{})
+}
+
+// repoStatus returns the status of the repository at path, limited to its
+// scopes.
+func repoStatus(path string) (*gitops.RepoStatus, error) {
+	return gitops.GetRepoStatus(path, repoOptions(path).Scopes)
+}
+
+// validate rejects options that cannot be resolved.
+func (o RepoOptions) validate() error {
+	errs := FieldErrors{}
+	o.validateFields(errs)
+	return errs.err()
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+func handleListGroups(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	json.NewEncoder(w).Encode(state.Groups)
+}
+
+func handleSaveGroup(w http.ResponseWriter, r *http.Request) {
+	var group RepoGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	errs := FieldErrors{}
+	if group.Name == "" {
+		errs.add("name", "is required")
+	}
+	if group.Schedule != "" {
+		if err := scheduler.ValidateSchedule(group.Schedule); err != nil {
+			errs.add("schedule", err.Error())
+		}
+	}
+	group.RepoOptions.validateFields(errs)
+
+	state.mu.Lock()
+	if group.Schedule == "" {
+		for _, repo := range state.Repositories {
+			if repo.Group == group.Name && repo.Schedule == "" {
+				errs.add("schedule", fmt.Sprintf("is required by repository %s", repo.Path))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		state.mu.Unlock()
+		writeFieldErrors(w, errs)
+		return
+	}
+	state.Groups[group.Name] = &group
+	rescheduleRepositories()
+	state.mu.Unlock()
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(group)
+}
+
+func handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state.mu.Lock()
+	for _, repo := range state.Repositories {
+		if repo.Group == req.Name {
+			state.mu.Unlock()
+			apiError(w, fmt.Sprintf("Group %s still has repository %s", req.Name, repo.Path), http.StatusConflict)
+			return
+		}
+	}
+	delete(state.Groups, req.Name)
+	state.mu.Unlock()
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUpdateRepositoryOptions replaces the group membership, tags and
+// local overrides of a repository. The schedule is kept unless given, an
+// empty one inherits the schedule of the group.
+func handleUpdateRepositoryOptions(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path     string   `json:"path"`
+		Group    string   `json:"group"`
+		Schedule *string  `json:"schedule"`
+		Tags     []string `json:"tags"`
+		RepoOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath := absRequestPath(req.Path)
+	errs := FieldErrors{}
+	if absPath == "" {
+		errs.add("path", "is required")
+	}
+	validateTags(req.Tags, errs)
+	req.RepoOptions.validateFields(errs)
+
+	state.mu.Lock()
+	validateGroup(req.Group, errs)
+	repo, exists := state.Repositories[absPath]
+	schedule := ""
+	if exists {
+		schedule = repo.Schedule
+		if req.Schedule != nil {
+			schedule = *req.Schedule
+		}
+		validateSchedule(schedule, req.Group, errs)
+	}
+	if len(errs) > 0 {
+		state.mu.Unlock()
+		writeFieldErrors(w, errs)
+		return
+	}
+	if !exists {
+		state.mu.Unlock()
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	repo.Group = req.Group
+	repo.Schedule = schedule
+	repo.Tags = req.Tags
+	repo.RepoOptions = req.RepoOptions
+	err := scheduleRepository(repo)
+	state.mu.Unlock()
+	notifyRepoChanged(absPath)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error setting up schedule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer implements the gRPC API on top of the same state as the REST
+// API. Calls carry no GitHub login, so like API token requests they see
+// every repository.
+type grpcServer struct {
+	pb.UnimplementedGitWatcherServer
+}
+
+// startGRPC serves the gRPC API on addr until the returned server is stopped.
+func startGRPC(addr string) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryAuth),
+		grpc.StreamInterceptor(grpcStreamAuth),
+	)
+	pb.RegisterGitWatcherServer(server, &grpcServer{})
+	go func() {
+		slog.Info("gRPC server starting", "address", lis.Addr().String())
+		if err := server.Serve(lis); err != nil {
+			slog.Error("gRPC server stopped", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// grpcRole checks the bearer token in the authorization metadata of ctx like
+// requireAuth checks HTTP requests, and returns the caller's role. GitHub
+// login has no gRPC equivalent, so a token is required once any
+// authentication is configured.
+func grpcRole(ctx context.Context) (string, error) {
+	token := apiToken()
+	viewer := viewerToken()
+	if token == "" && viewer == "" && !oauthEnabled() {
+		return RoleAdmin, nil
+	}
+
+	provided := ""
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if bearer, ok := strings.CutPrefix(value, "Bearer "); ok {
+			provided = bearer
+		}
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+		return RoleAdmin, nil
+	}
+	if viewer != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(viewer)) == 1 {
+		return RoleViewer, nil
+	}
+	return "", status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	role, err := grpcRole(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, roleKey{}, role), req)
+}
+
+// roleStream attaches the caller's role to the context of a stream.
+type roleStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *roleStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	role, err := grpcRole(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &roleStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), roleKey{}, role)})
+}
+
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func protoRepoStatus(s *gitops.RepoStatus) *pb.RepoStatus {
+	if s == nil {
+		return nil
+	}
+	return &pb.RepoStatus{
+		HasChanges:       s.HasChanges,
+		ChangedFiles:     s.ChangedFiles,
+		CurrentBranch:    s.CurrentBranch,
+		IsClean:          s.IsClean,
+		RecoveryBranches: s.RecoveryBranches,
+		HasCommits:       s.HasCommits,
+		HasRemote:        s.HasRemote,
+	}
+}
+
+func protoRepository(repo *Repository) *pb.Repository {
+	return &pb.Repository{
+		Path:         repo.Path,
+		Schedule:     repo.Schedule,
+		Group:        repo.Group,
+		Owner:        repo.Owner,
+		LastSync:     protoTime(repo.LastSync),
+		LastActivity: protoTime(repo.LastActivity),
+		Stale:        repo.Stale,
+		LastError:    repo.LastError,
+		Status:       protoRepoStatus(repo.Status),
+		PendingPr:    repo.PendingPR != nil,
+	}
+}
+
+// repositoryProto returns the repository at path, made absolute.
+func repositoryProto(path string) (*pb.Repository, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil || path == "" {
+		return nil, status.Error(codes.InvalidArgument, "Invalid path")
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	repo, exists := state.Repositories[absPath]
+	if !exists {
+		return nil, status.Error(codes.NotFound, "Repository not found")
+	}
+	return protoRepository(repo), nil
+}
+
+func (s *grpcServer) ListRepositories(ctx context.Context, req *pb.ListRepositoriesRequest) (*pb.ListRepositoriesResponse, error) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	resp := &pb.ListRepositoriesResponse{}
+	for _, repo := range state.Repositories {
+		resp.Repositories = append(resp.Repositories, protoRepository(repo))
+	}
+	sort.Slice(resp.Repositories, func(i, j int) bool {
+		return resp.Repositories[i].Path < resp.Repositories[j].Path
+	})
+	return resp, nil
+}
+
+func (s *grpcServer) GetRepository(ctx context.Context, req *pb.GetRepositoryRequest) (*pb.Repository, error) {
+	return repositoryProto(req.Path)
+}
+
+func (s *grpcServer) GetSettings(ctx context.Context, req *pb.GetSettingsRequest) (*pb.Settings, error) {
+	if role := contextRole(ctx); role != RoleAdmin {
+		return nil, status.Errorf(codes.PermissionDenied, "Forbidden for the %s role", role)
+	}
+	state.mu.RLock()
+	settings := state.Settings
+	state.mu.RUnlock()
+	return &pb.Settings{
+		AiService:             settings.AIService,
+		OllamaServer:          settings.OllamaServer,
+		OllamaModel:           settings.OllamaModel,
+		GeminiModel:           settings.GeminiModel,
+		OpenaiModel:           settings.OpenAIModel,
+		CommitFormat:          settings.CommitFormat,
+		Language:              settings.Language,
+		DiffTokenBudget:       int32(settings.DiffTokenBudget),
+		AiTimeout:             int32(settings.AITimeout),
+		UnpushedAuditSchedule: settings.UnpushedAuditSchedule,
+		HasGithubToken:        settings.GitHubToken != "",
+		ReadOnly:              readOnly.Load(),
+	}, nil
+}
+
+func (s *grpcServer) SyncRepository(ctx context.Context, req *pb.SyncRepositoryRequest) (*pb.Repository, error) {
+	if role := contextRole(ctx); role != RoleAdmin {
+		return nil, status.Errorf(codes.PermissionDenied, "Forbidden for the %s role", role)
+	}
+	if readOnly.Load() {
+		return nil, status.Error(codes.FailedPrecondition, readOnlyMessage)
+	}
+	repo, err := repositoryProto(req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(AuditEntry{Actor: contextActor(ctx), Action: "grpc/sync", Repo: repo.Path})
+	if err := syncRepository(repo.Path); errors.Is(err, errRepositoryBusy) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return repositoryProto(repo.Path)
+}
+
+func (s *grpcServer) WatchRepositories(req *pb.WatchRepositoriesRequest, stream pb.GitWatcher_WatchRepositoriesServer) error {
+	// Subscribe before listing so no change falls in between
+	sub := &eventSubscriber{events: make(chan []byte, 64)}
+	repoEvents.mu.Lock()
+	repoEvents.subscribers[sub] = struct{}{}
+	repoEvents.mu.Unlock()
+	defer func() {
+		repoEvents.mu.Lock()
+		delete(repoEvents.subscribers, sub)
+		repoEvents.mu.Unlock()
+	}()
+
+	list, _ := s.ListRepositories(stream.Context(), &pb.ListRepositoriesRequest{})
+	for _, repo := range list.Repositories {
+		if err := stream.Send(repo); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-streamsDone:
+			return nil
+		case payload := <-sub.events:
+			var repo Repository
+			if err := json.Unmarshal(payload, &repo); err != nil {
+				continue
+			}
+			if err := stream.Send(protoRepository(&repo)); err != nil {
+				return err
+			}
+		}
+	}
+}
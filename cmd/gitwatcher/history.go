@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"gitwatcher/internal/gitops"
+
+	"github.com/gorilla/mux"
+)
+
+// maxHistory bounds the number of operations kept per repository.
+const maxHistory = 1000
+
+const (
+	TriggerManual    = "manual"
+	TriggerScheduler = "scheduler"
+)
+
+type Operation struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Trigger   string    `json:"trigger"`
+	// User is the GitHub login of whoever triggered a manual operation
+	User string `json:"user,omitempty"`
+	// Hash and Message describe the commit of commit operations and the
+	// pushed HEAD of push operations. Message also explains stale operations
+	Hash     string `json:"hash,omitempty"`
+	Message  string `json:"message,omitempty"`
+	PRNumber int    `json:"prNumber,omitempty"`
+	PRURL    string `json:"prUrl,omitempty"`
+	Title    string `json:"title,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Body     string `json:"body,omitempty"`
+	// AITitle and AIBody hold the generated content when a human edited it
+	AITitle string `json:"aiTitle,omitempty"`
+	AIBody  string `json:"aiBody,omitempty"`
+	// Error is the failure of error operations and failed syncs, and Step
+	// the pipeline step that failed
+	Error string `json:"error,omitempty"`
+	Step  string `json:"step,omitempty"`
+	// DurationMs is how long a sync took
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// recordOperation appends op to the repository's operation history and
+// saves it, to the state database when there is one.
+func recordOperation(repoPath string, op Operation) {
+	if op.Timestamp.IsZero() {
+		op.Timestamp = time.Now()
+	}
+
+	state.mu.Lock()
+	repo, exists := state.Repositories[repoPath]
+	if !exists {
+		state.mu.Unlock()
+		return
+	}
+	repo.History = append(repo.History, op)
+	if len(repo.History) > maxHistory {
+		repo.History = repo.History[len(repo.History)-maxHistory:]
+	}
+	state.mu.Unlock()
+	publishOperation(repoPath, op)
+	notifyOperation(repoPath, op)
+
+	if stateDB != nil {
+		if err := storeOperation(repoPath, op); err != nil {
+			slog.Error("Error saving operation history", "repo", repoPath, "error", err)
+		}
+		return
+	}
+	if err := saveConfig(); err != nil {
+		slog.Error("Error saving operation history", "repo", repoPath, "error", err)
+	}
+}
+
+// recordCommits records a commit operation, based on op, for every commit
+// made on top of before.
+func recordCommits(repoPath string, before string, op Operation) {
+	commits, err := gitops.CommitsSince(repoPath, before)
+	if err != nil {
+		slog.Warn("Error listing new commits", "repo", repoPath, "error", err)
+		return
+	}
+	for _, c := range commits {
+		op.Type = "commit"
+		op.Hash = c.Hash
+		op.Message = c.Message
+		recordOperation(repoPath, op)
+	}
+}
+
+// recordPush records a push operation of the current HEAD.
+func recordPush(repoPath string, op Operation) {
+	op.Type = "push"
+	op.Hash, _ = gitops.HeadHash(repoPath)
+	recordOperation(repoPath, op)
+}
+
+// handleRepoActivity returns the operation history of a repository, newest
+// first, optionally filtered by type, from before an RFC 3339 time and capped
+// by limit. With a state database it is the whole history, not only the
+// operations kept in memory.
+func handleRepoActivity(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs("/" + mux.Vars(r)["path"])
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			apiError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	opType := r.URL.Query().Get("type")
+	var before time.Time
+	if b := r.URL.Query().Get("before"); b != "" {
+		if before, err = time.Parse(time.RFC3339Nano, b); err != nil {
+			apiError(w, fmt.Sprintf("Invalid before: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	state.mu.RLock()
+	repo, exists := state.Repositories[absPath]
+	visible := exists && visibleTo(repo, contextUser(r.Context()))
+	state.mu.RUnlock()
+	if !visible {
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	operations, err := repositoryHistory(absPath, opType, before, limit)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error reading history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(operations)
+}
+
+// repositoryHistory returns the operations of the repository at path, newest
+// first, of type opType and from before the given time when set, at most
+// limit of them unless it is 0.
+func repositoryHistory(path, opType string, before time.Time, limit int) ([]Operation, error) {
+	if stateDB != nil {
+		events, err := queryOperations([]string{path}, opType, before, limit)
+		if err != nil {
+			return nil, err
+		}
+		operations := make([]Operation, len(events))
+		for i, event := range events {
+			operations[i] = event.Operation
+		}
+		return operations, nil
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	operations := []Operation{}
+	repo, exists := state.Repositories[path]
+	if !exists {
+		return operations, nil
+	}
+	for i := len(repo.History) - 1; i >= 0; i-- {
+		if opType != "" && repo.History[i].Type != opType {
+			continue
+		}
+		if !before.IsZero() && !repo.History[i].Timestamp.Before(before) {
+			continue
+		}
+		operations = append(operations, repo.History[i])
+		if len(operations) == limit {
+			break
+		}
+	}
+	return operations, nil
+}
+
+// defaultActivityLimit is the page size of the activity feed.
+const defaultActivityLimit = 50
+
+// ActivityEvent is an operation in the activity feed.
+type ActivityEvent struct {
+	Repo string `json:"repo"`
+	Operation
+}
+
+// ActivityFeed is a page of the activity feed. Next is the before value of
+// the following page, empty on the last one.
+type ActivityFeed struct {
+	Events []ActivityEvent `json:"events"`
+	Next   string          `json:"next,omitempty"`
+}
+
+// handleActivityFeed returns the operations of every visible repository,
+// newest first. Pages hold limit events and start before the given RFC 3339
+// time; type keeps only one kind of operation.
+func handleActivityFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultActivityLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			apiError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var before time.Time
+	if b := query.Get("before"); b != "" {
+		t, err := time.Parse(time.RFC3339Nano, b)
+		if err != nil {
+			apiError(w, fmt.Sprintf("Invalid before: %v", err), http.StatusBadRequest)
+			return
+		}
+		before = t
+	}
+
+	json.NewEncoder(w).Encode(activityFeed(contextUser(r.Context()), query.Get("type"), before, limit))
+}
+
+// activityFeed returns a page of the operations of the repositories visible
+// to user, newest first.
+func activityFeed(user, opType string, before time.Time, limit int) ActivityFeed {
+	if stateDB != nil {
+		state.mu.RLock()
+		var paths []string
+		for path := range userRepositories(user) {
+			paths = append(paths, path)
+		}
+		state.mu.RUnlock()
+		// One more event tells whether there is a next page
+		events, err := queryOperations(paths, opType, before, limit+1)
+		if err == nil {
+			return activityPage(events, limit)
+		}
+		slog.Error("Error reading history, showing the operations in memory", "error", err)
+	}
+
+	events := []ActivityEvent{}
+	state.mu.RLock()
+	for path, repo := range userRepositories(user) {
+		for _, op := range repo.History {
+			if opType != "" && op.Type != opType {
+				continue
+			}
+			if !before.IsZero() && !op.Timestamp.Before(before) {
+				continue
+			}
+			events = append(events, ActivityEvent{Repo: path, Operation: op})
+		}
+	}
+	state.mu.RUnlock()
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+	return activityPage(events, limit)
+}
+
+// activityPage makes a page of at most limit of events, sorted newest first.
+func activityPage(events []ActivityEvent, limit int) ActivityFeed {
+	feed := ActivityFeed{Events: events}
+	if len(events) > limit {
+		feed.Events = events[:limit]
+		feed.Next = feed.Events[limit-1].Timestamp.Format(time.RFC3339Nano)
+	}
+	return feed
+}
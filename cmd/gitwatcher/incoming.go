@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"gitwatcher/internal/gitops"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// refreshRemote fetches the repository at path, records its incoming
+// changes and refreshes its status. A failed fetch is only logged, the status
+// is still refreshed.
+func refreshRemote(ctx context.Context, path string) (*gitops.RepoStatus, error) {
+	err := gitops.FetchRepository(path, repoSettings(path).SSHKeyPath)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		slog.WarnContext(ctx, "Fetch error", "repo", path, "error", err)
+	} else {
+		refreshIncoming(path)
+	}
+
+	status, err := repoStatus(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state.mu.Lock()
+	if repo, exists := state.Repositories[path]; exists {
+		repo.Status = status
+		repo.LastSync = time.Now()
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+	return status, nil
+}
+
+// refreshIncoming records the upstream commits a pull would bring into the
+// repository, with an AI summary. The summary is only regenerated when the
+// remote branch moved since the last fetch.
+func refreshIncoming(repoPath string) {
+	incoming, err := gitops.GetIncomingChanges(repoPath)
+	if err != nil {
+		slog.Warn("Error getting incoming changes", "repo", repoPath, "error", err)
+		return
+	}
+
+	state.mu.RLock()
+	repo, exists := state.Repositories[repoPath]
+	if !exists {
+		state.mu.RUnlock()
+		return
+	}
+	previous := repo.Incoming
+	settings := state.settingsFor(repoPath)
+	opts := resolveOptions(repo)
+	state.mu.RUnlock()
+
+	if incoming != nil && incoming.Count == 0 {
+		incoming = nil
+	}
+
+	if incoming != nil {
+		if previous != nil && previous.RemoteHash == incoming.RemoteHash {
+			incoming.Summary = previous.Summary
+		} else {
+			summary, err := gitops.SummarizeIncomingChanges(incoming, opts.AIService(&settings))
+			if err != nil {
+				slog.Warn("Error summarizing incoming changes", "repo", repoPath, "error", err)
+			}
+			incoming.Summary = summary
+			slog.Info("Incoming changes", "repo", repoPath, "commits", incoming.Count,
+				"branch", "origin/"+incoming.Branch, "summary", summary)
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if repo, exists := state.Repositories[repoPath]; exists {
+		repo.Incoming = incoming
+	}
+	notifyRepoChanged(repoPath)
+}
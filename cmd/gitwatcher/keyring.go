@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitwatcher/internal/configfile"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringEnabled keeps the secret settings in the OS keyring (the macOS
+// keychain, the Secret Service on Linux or the Windows credential manager)
+// instead of the config file.
+var keyringEnabled bool
+
+// keyringSecrets caches the values the keyring holds, by account, so saving
+// the config only writes the secrets that changed.
+var keyringSecrets = struct {
+	mu     sync.Mutex
+	values map[string]string
+}{values: make(map[string]string)}
+
+// keyringService is the keyring service of the instance, one per config
+// file so separate instances keep separate secrets.
+func keyringService() string {
+	path, err := configPath()
+	if err != nil {
+		return "gitwatcher"
+	}
+	return "gitwatcher:" + path
+}
+
+// keyringAccount names the secret field of the instance settings, or of the
+// settings of login.
+func keyringAccount(login, field string) string {
+	if login == "" {
+		return field
+	}
+	return login + "/" + field
+}
+
+// secretPath is the path of a secret field in the config file. Fields of
+// list entries are named like webhooks/0/url.
+func secretPath(login, field string) string {
+	keys := strings.Split(field, "/")
+	if login == "" {
+		return configfile.Path(append([]string{"settings"}, keys...)...)
+	}
+	return configfile.Path(append([]string{"userSettings", login}, keys...)...)
+}
+
+// secretFields returns the secret string fields of s by JSON name, and the
+// URL and secret of each webhook, whose URLs may embed a token.
+func secretFields(s *Settings) map[string]*string {
+	fields := make(map[string]*string)
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if secretSettings[name] && v.Field(i).Kind() == reflect.String {
+			fields[name] = v.Field(i).Addr().Interface().(*string)
+		}
+	}
+	for i := range s.Webhooks {
+		fields[fmt.Sprintf("webhooks/%d/url", i)] = &s.Webhooks[i].URL
+		fields[fmt.Sprintf("webhooks/%d/secret", i)] = &s.Webhooks[i].Secret
+	}
+	return fields
+}
+
+// initKeyring enables the keyring when requested by flag or by the
+// GITWATCHER_KEYRING environment variable, reads the secrets from it and
+// moves the secrets still in the config file into it.
+func initKeyring(flagValue bool) error {
+	enabled := flagValue
+	if env := os.Getenv("GITWATCHER_KEYRING"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_KEYRING value", "value", env)
+		} else {
+			enabled = enabled || v
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	if secretBox != nil {
+		return errors.New("secrets are either encrypted or kept in the keyring, not both")
+	}
+	keyringEnabled = true
+
+	state.mu.Lock()
+	migrate, err := loadSecrets(&state.Settings, "")
+	for login, settings := range state.UserSettings {
+		if err != nil {
+			break
+		}
+		var m bool
+		m, err = loadSecrets(settings, login)
+		migrate = migrate || m
+	}
+	state.updateSSHPassphrases()
+	state.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error reading secrets from the keyring: %v", err)
+	}
+
+	slog.Info("Secret settings are kept in the OS keyring", "service", keyringService())
+	if migrate {
+		slog.Info("Moving the secrets of the config file to the keyring")
+		return saveConfig()
+	}
+	return nil
+}
+
+// loadSecrets fills the empty secret fields of the settings of login, empty
+// for the instance settings, from the keyring. It reports whether some
+// secrets are still in the config file. Fields set from environment
+// variables are left alone. The caller must hold state.mu.
+func loadSecrets(s *Settings, login string) (bool, error) {
+	keyringSecrets.mu.Lock()
+	defer keyringSecrets.mu.Unlock()
+
+	service := keyringService()
+	migrate := false
+	for field, value := range secretFields(s) {
+		if _, exists := state.substitutions[secretPath(login, field)]; exists {
+			continue
+		}
+		if *value != "" {
+			migrate = true
+			continue
+		}
+		account := keyringAccount(login, field)
+		secret, err := keyring.Get(service, account)
+		if errors.Is(err, keyring.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		*value = secret
+		keyringSecrets.values[account] = secret
+	}
+	return migrate, nil
+}
+
+// storeSecrets writes the changed secret fields of s, the settings of login
+// about to be saved, to the keyring and clears them so they stay out of the
+// config file. The caller must hold state.mu.
+func storeSecrets(s *Settings, login string) error {
+	keyringSecrets.mu.Lock()
+	defer keyringSecrets.mu.Unlock()
+
+	service := keyringService()
+	for field, value := range secretFields(s) {
+		if _, exists := state.substitutions[secretPath(login, field)]; exists {
+			continue
+		}
+		account := keyringAccount(login, field)
+		if stored, exists := keyringSecrets.values[account]; !exists || stored != *value {
+			var err error
+			if *value == "" {
+				err = keyring.Delete(service, account)
+				if errors.Is(err, keyring.ErrNotFound) {
+					err = nil
+				}
+			} else {
+				err = keyring.Set(service, account, *value)
+			}
+			if err != nil {
+				return fmt.Errorf("error storing %s in the keyring: %v", field, err)
+			}
+			keyringSecrets.values[account] = *value
+		}
+		*value = ""
+	}
+	return nil
+}
+
+// keyringSettings returns copies of the settings to save with their secrets
+// moved to the keyring. The caller must hold state.mu.
+func keyringSettings(settings Settings, users map[string]*Settings) (Settings, map[string]*Settings, error) {
+	// The webhooks are cleared in place, away from the running settings
+	settings.Webhooks = slices.Clone(settings.Webhooks)
+	if err := storeSecrets(&settings, ""); err != nil {
+		return settings, nil, err
+	}
+	copies := make(map[string]*Settings, len(users))
+	for login, s := range users {
+		c := *s
+		c.Webhooks = slices.Clone(c.Webhooks)
+		if err := storeSecrets(&c, login); err != nil {
+			return settings, nil, err
+		}
+		copies[login] = &c
+	}
+	return settings, copies, nil
+}
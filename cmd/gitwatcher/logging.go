@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// initLogging sets up the default structured logger. level is debug, info,
+// warn or error and format is text or json; the GITWATCHER_LOG_LEVEL and
+// GITWATCHER_LOG_FORMAT environment variables are used when they are empty.
+// Messages still written through the log package go to the same handler,
+// records about a repository are also streamed to its log followers and
+// records written with a request context carry its request ID.
+func initLogging(level, format string) error {
+	if level == "" {
+		level = os.Getenv("GITWATCHER_LOG_LEVEL")
+	}
+	if format == "" {
+		format = os.Getenv("GITWATCHER_LOG_FORMAT")
+	}
+
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	// Windows services have no console, they log to the event log
+	service, err := serviceLogHandler(opts)
+	if err != nil {
+		return err
+	}
+	if service != nil {
+		handler = service
+	}
+	slog.SetDefault(slog.New(requestIDHandler{newRepoLogHandler(handler)}))
+	return nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streamed responses working through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logRequests logs every request at debug level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		slog.DebugContext(r.Context(), "Request", "method", r.Method, "path", r.URL.Path, "repo", r.URL.Query().Get("path"),
+			"status", rec.status, "duration", time.Since(start))
+	})
+}
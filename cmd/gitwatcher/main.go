@@ -1,34 +1,73 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"gitwatcher/internal/configfile"
 	"gitwatcher/internal/gitops"
 	"gitwatcher/internal/scheduler"
+	"gitwatcher/internal/systemd"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"google.golang.org/grpc"
 )
 
 type Repository struct {
-	Path     string             `json:"path"`
-	Schedule string             `json:"schedule"`
-	LastSync time.Time          `json:"lastSync"`
-	Status   *gitops.RepoStatus `json:"status,omitempty"`
+	Path string `json:"path"`
+	// Schedule is empty for repositories that sync on the schedule of their
+	// group
+	Schedule string   `json:"schedule"`
+	Group    string   `json:"group,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Owner is the GitHub login of the user who added the repository, empty
+	// for repositories shared with every user
+	Owner string `json:"owner,omitempty"`
+	RepoOptions
+	StaleAfter   string             `json:"staleAfter,omitempty"`
+	LastSync     time.Time          `json:"lastSync"`
+	LastActivity time.Time          `json:"lastActivity"`
+	Stale        bool               `json:"stale"`
+	LastError    string             `json:"lastError,omitempty"`
+	Status       *gitops.RepoStatus `json:"status,omitempty"`
+	History      []Operation        `json:"history,omitempty"`
+	PendingPR    *PendingPR         `json:"pendingPR,omitempty"`
+	// RunState is idle, queued, running or error, and Step the step of a
+	// running repository. Neither is saved.
+	RunState string `json:"runState,omitempty"`
+	Step     string `json:"step,omitempty"`
+	// Failures counts the consecutive failed scheduled runs since
+	// GitWatcher started
+	Failures int `json:"failures,omitempty"`
+	// Missing is set while the working tree is gone from disk, which pauses
+	// the schedule
+	Missing bool `json:"missing,omitempty"`
+	// Incoming describes the upstream commits found by the last fetch
+	Incoming *gitops.IncomingChanges `json:"incoming,omitempty"`
+	// AIUsage totals the AI requests made for the repository per day
+	AIUsage map[string]*AIUsage `json:"aiUsage,omitempty"`
 }
 
 func (r *Repository) GetStatus() error {
-	status, err := gitops.GetRepoStatus(r.Path)
+	state.mu.RLock()
+	scopes := resolveOptions(r).Scopes
+	state.mu.RUnlock()
+	status, err := gitops.GetRepoStatus(r.Path, scopes)
 	if err != nil {
 		return err
 	}
@@ -44,130 +83,355 @@ type Settings struct {
 	AIService    string `json:"aiService"`
 	GeminiAPIKey string `json:"geminiAPIKey"`
 	GeminiModel  string `json:"geminiModel"`
+	OpenAIAPIKey string `json:"openaiAPIKey,omitempty"`
+	OpenAIModel  string `json:"openaiModel,omitempty"`
+	SSHKeyPath   string `json:"sshKeyPath"`
+	// SSHKeyPassphrase decrypts the SSH key when it is encrypted
+	SSHKeyPassphrase string `json:"sshKeyPassphrase,omitempty"`
+	// ExecCommand is run with the prompt on stdin by the exec AI service
+	ExecCommand string `json:"execCommand,omitempty"`
+	// APIToken is required by the UI and API when set, see requireAuth
+	APIToken string `json:"apiToken,omitempty"`
+	// GitHubClientID and GitHubClientSecret of the OAuth app enable GitHub login
+	GitHubClientID     string `json:"githubClientID,omitempty"`
+	GitHubClientSecret string `json:"githubClientSecret,omitempty"`
+	// ViewerToken grants read-only access like APIToken grants full access
+	ViewerToken string `json:"viewerToken,omitempty"`
+	// Roles maps GitHub logins to their role, DefaultRole applies to the
+	// others and is viewer when empty
+	Roles       map[string]string `json:"roles,omitempty"`
+	DefaultRole string            `json:"defaultRole,omitempty"`
+	// AllowedLogins and AllowedOrgs are the GitHub users, and the members of
+	// the organizations, who may sign in. GitHub login is refused to everyone
+	// while both are empty.
+	AllowedLogins []string `json:"allowedLogins,omitempty"`
+	AllowedOrgs   []string `json:"allowedOrgs,omitempty"`
+	// GitHubOAuthToken is the token of the user's latest GitHub login, which
+	// the scheduled tasks of their repositories use. The instance settings
+	// never hold one.
+	GitHubOAuthToken string `json:"githubOAuthToken,omitempty"`
+	// CommitFormat is "conventional" to enforce Conventional Commits messages
+	CommitFormat string `json:"commitFormat,omitempty"`
+	// Language is the language generated commit messages and PRs are written in
+	Language string `json:"language,omitempty"`
+	// DiffTokenBudget limits how much of the diff is sent to the AI
+	DiffTokenBudget int `json:"diffTokenBudget,omitempty"`
+	// AITimeout is the number of seconds an AI request may take
+	AITimeout int `json:"aiTimeout,omitempty"`
+	// Defaults are the instance-wide repository options that groups and
+	// repositories inherit
+	Defaults RepoOptions `json:"defaults"`
+	// UnpushedAuditSchedule is the cron schedule of the unpushed commit audit
+	UnpushedAuditSchedule string `json:"unpushedAuditSchedule,omitempty"`
+	// Webhooks receive the events of every repository
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// SMTPHost and the other SMTP settings are the server email is sent
+	// through, from EmailFrom to EmailTo
+	SMTPHost     string   `json:"smtpHost,omitempty"`
+	SMTPPort     int      `json:"smtpPort,omitempty"`
+	SMTPUsername string   `json:"smtpUsername,omitempty"`
+	SMTPPassword string   `json:"smtpPassword,omitempty"`
+	EmailFrom    string   `json:"emailFrom,omitempty"`
+	EmailTo      []string `json:"emailTo,omitempty"`
+	// EmailFailures mails every pipeline failure
+	EmailFailures bool `json:"emailFailures,omitempty"`
+	// DigestSchedule is the cron schedule of the email digest of the commits
+	// and PRs made, none is sent when empty
+	DigestSchedule string `json:"digestSchedule,omitempty"`
+	// NtfyURL is the ntfy topic pipeline failures are published to, with
+	// NtfyToken for protected topics
+	NtfyURL   string `json:"ntfyURL,omitempty"`
+	NtfyToken string `json:"ntfyToken,omitempty"`
+	// GotifyURL is the Gotify server failures are sent to with the
+	// application token GotifyToken
+	GotifyURL   string `json:"gotifyURL,omitempty"`
+	GotifyToken string `json:"gotifyToken,omitempty"`
+	// PushoverUserKey receives failures through the Pushover application
+	// PushoverToken
+	PushoverUserKey string `json:"pushoverUserKey,omitempty"`
+	PushoverToken   string `json:"pushoverToken,omitempty"`
+	// GitHubWebhookSecret checks the signature of the GitHub webhooks
+	// received on /hooks/github, which are refused while it is empty
+	GitHubWebhookSecret string `json:"githubWebhookSecret,omitempty"`
+	// MQTTBroker is the MQTT broker repository states and events are
+	// published to, such as tcp://broker:1883, under MQTTTopicPrefix
+	MQTTBroker      string `json:"mqttBroker,omitempty"`
+	MQTTUsername    string `json:"mqttUsername,omitempty"`
+	MQTTPassword    string `json:"mqttPassword,omitempty"`
+	MQTTTopicPrefix string `json:"mqttTopicPrefix,omitempty"`
+	// AirGappedAllow lists the services on the isolated network, smtp and
+	// mqtt, that stay enabled in air-gapped mode
+	AirGappedAllow []string `json:"airGappedAllow,omitempty"`
+	// FailureIssueAfter files a GitHub issue on repositories failing that
+	// many consecutive scheduled runs, 0 disables it
+	FailureIssueAfter int `json:"failureIssueAfter,omitempty"`
 }
 
 func (s *Settings) GetAIService() gitops.AIService {
 	if s.AIService == "gemini" {
 		return gitops.AIService{
-			Server: "",
-			Model:  s.GeminiModel,
-			Type:   s.AIService,
-			APIKey: s.GeminiAPIKey,
+			Server:          "",
+			Model:           s.GeminiModel,
+			Type:            s.AIService,
+			APIKey:          s.GeminiAPIKey,
+			CommitFormat:    s.CommitFormat,
+			Language:        s.Language,
+			DiffTokenBudget: s.DiffTokenBudget,
+			Timeout:         time.Duration(s.AITimeout) * time.Second,
+		}
+	}
+	if s.AIService == "openai" {
+		model := s.OpenAIModel
+		if model == "" {
+			model = gitops.DefaultOpenAIModel
+		}
+		return gitops.AIService{
+			Model:           model,
+			Type:            s.AIService,
+			APIKey:          s.OpenAIAPIKey,
+			CommitFormat:    s.CommitFormat,
+			Language:        s.Language,
+			DiffTokenBudget: s.DiffTokenBudget,
+			Timeout:         time.Duration(s.AITimeout) * time.Second,
+		}
+	}
+	if s.AIService == gitops.AIServiceExec {
+		return gitops.AIService{
+			Type:            s.AIService,
+			Command:         s.ExecCommand,
+			CommitFormat:    s.CommitFormat,
+			Language:        s.Language,
+			DiffTokenBudget: s.DiffTokenBudget,
+			Timeout:         time.Duration(s.AITimeout) * time.Second,
 		}
 	}
 	return gitops.AIService{
-		Server: s.OllamaServer,
-		Model:  s.OllamaModel,
-		Type:   s.AIService,
-		APIKey: "",
+		Server:          s.OllamaServer,
+		Model:           s.OllamaModel,
+		Type:            s.AIService,
+		APIKey:          "",
+		CommitFormat:    s.CommitFormat,
+		Language:        s.Language,
+		DiffTokenBudget: s.DiffTokenBudget,
+		Timeout:         time.Duration(s.AITimeout) * time.Second,
 	}
 }
 
 type AppState struct {
 	Repositories map[string]*Repository `json:"repositories"`
+	Groups       map[string]*RepoGroup  `json:"groups"`
 	Settings     Settings               `json:"settings"`
+	// UserSettings holds the settings of signed in users by GitHub login
+	UserSettings map[string]*Settings `json:"userSettings"`
 	scheduler    *scheduler.Scheduler
-	mu           sync.RWMutex
+	// substitutions are the config values read from environment variables,
+	// written back as references so secrets stay out of the file
+	substitutions configfile.Substitutions
+	mu            sync.RWMutex
 }
 
 var state *AppState
 
+// savedConfig is the content of the config file.
+type savedConfig struct {
+	Version      int                   `json:"version"`
+	Repositories map[string]Repository `json:"repositories"`
+	Groups       map[string]*RepoGroup `json:"groups"`
+	Settings     Settings              `json:"settings"`
+	UserSettings map[string]*Settings  `json:"userSettings,omitempty"`
+}
+
+// configFile is the config path given with -config or GITWATCHER_CONFIG,
+// empty for config.json in configDir.
+var configFile string
+
+// configPath returns the path of the config file, JSON unless it ends in
+// .yaml, .yml or .toml. The audit log is kept next to it, so instances with
+// separate configs don't share one.
+func configPath() (string, error) {
+	if configFile != "" {
+		return filepath.Abs(configFile)
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
 func loadConfig() error {
-	homeDir, err := os.UserHomeDir()
+	configPath, err := configPath()
 	if err != nil {
 		return err
 	}
-	configDir := filepath.Join(homeDir, ".config", "gitwatcher")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
 	}
-	configPath := filepath.Join(configDir, "config.json")
 
 	data, err := os.ReadFile(configPath)
+	rememberConfig(data)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Create default state if config doesn't exist
 			state = &AppState{
 				Repositories: make(map[string]*Repository),
+				Groups:       make(map[string]*RepoGroup),
+				UserSettings: make(map[string]*Settings),
 				Settings: Settings{
 					OllamaServer: "http://localhost:11434",
 					OllamaModel:  "llama2",
 				},
 				scheduler: scheduler.NewScheduler(),
 			}
-			return saveConfig()
+			fileSettings = state.Settings
+			if err := saveConfig(); err != nil {
+				slog.Warn("Error creating the config file, running with the defaults", "file", configPath, "error", err)
+			}
+			return nil
 		}
 		return err
 	}
 
-	var config struct {
-		Repositories map[string]Repository `json:"repositories"`
-		Settings     Settings              `json:"settings"`
+	config, substitutions, version, err := parseConfig(configPath, data)
+	if err != nil && configfile.WellFormed(configPath, data) {
+		// The file parses but its content is wrong, which a hand edit is
+		// more likely to fix than the backup
+		return fmt.Errorf("invalid %s: %v", configPath, err)
 	}
-	if err := json.Unmarshal(data, &config); err != nil {
-		return err
+	if err != nil {
+		// Fall back on the version before the last save, keeping the broken
+		// file aside for inspection
+		backupPath := configfile.BackupPath(configPath)
+		backup, backupErr := os.ReadFile(backupPath)
+		if backupErr != nil {
+			return fmt.Errorf("error reading %s: %v", configPath, err)
+		}
+		config, substitutions, version, backupErr = parseConfig(configPath, backup)
+		if backupErr != nil {
+			return fmt.Errorf("error reading %s: %v, and its backup: %v", configPath, err, backupErr)
+		}
+		if err := os.WriteFile(configPath+".corrupt", data, 0600); err != nil {
+			return err
+		}
+		slog.Warn("Config file is corrupt, recovered from its backup", "file", configPath, "error", err, "corrupt", configPath+".corrupt")
 	}
 	// Create state from config
 	state = &AppState{
-		Repositories: make(map[string]*Repository),
-		Settings:     config.Settings,
-		scheduler:    scheduler.NewScheduler(),
+		Repositories:  make(map[string]*Repository),
+		Groups:        config.Groups,
+		Settings:      config.Settings,
+		UserSettings:  config.UserSettings,
+		scheduler:     scheduler.NewScheduler(),
+		substitutions: substitutions,
 	}
+	fileSettings = state.Settings
 
 	// Set up repositories and their schedules
 	for path, repo := range config.Repositories {
 		r := &Repository{
-			Path:     repo.Path,
-			Schedule: repo.Schedule,
+			Path:        repo.Path,
+			Schedule:    repo.Schedule,
+			Group:       repo.Group,
+			Tags:        repo.Tags,
+			Owner:       repo.Owner,
+			RepoOptions: repo.RepoOptions,
+			StaleAfter:  repo.StaleAfter,
+			PendingPR:   repo.PendingPR,
+			History:     repo.History,
+			AIUsage:     repo.AIUsage,
+			RunState:    RunIdle,
+			Missing:     pathMissing(repo.Path),
 		}
-		err := r.GetStatus()
-		if err != nil {
-			log.Printf("Error getting repo status: %v", err)
+		if r.Missing {
+			slog.Warn("Repository is missing from disk, pausing its schedule", "repo", path)
+		} else if err := r.GetStatus(); err != nil {
+			slog.Warn("Error getting repo status", "repo", path, "error", err)
 		}
 		state.Repositories[path] = r
-		err = state.scheduler.AddTask(path, repo.Schedule, func() {
-			handleScheduledTask(path)
-		})
-		if err != nil {
-			log.Printf("Error setting up schedule for %s: %v", path, err)
+		if err := scheduleRepository(r); err != nil {
+			slog.Error("Error setting up schedule", "repo", path, "error", err)
+		}
+	}
+	state.updateSSHPassphrases()
+
+	if version < configVersion {
+		slog.Info("Migrating the config file", "file", configPath, "from", version, "to", configVersion)
+		if err := saveConfig(); err != nil {
+			// Read-only config files, as in containers, are migrated in
+			// memory on every start
+			slog.Warn("Error saving the migrated config file", "file", configPath, "error", err)
 		}
 	}
-
 	return nil
 }
 
 func saveConfig() error {
-	homeDir, err := os.UserHomeDir()
+	configPath, err := configPath()
 	if err != nil {
 		return err
 	}
-	configPath := filepath.Join(homeDir, ".config", "gitwatcher", "config.json")
 
 	state.mu.RLock()
 	defer state.mu.RUnlock()
+	state.updateSSHPassphrases()
 
 	// Create config from state
-	config := struct {
-		Repositories map[string]Repository `json:"repositories"`
-		Settings     Settings              `json:"settings"`
-	}{
+	config := savedConfig{
+		Version:      configVersion,
 		Repositories: make(map[string]Repository),
-		Settings:     state.Settings,
+		Groups:       state.Groups,
+		Settings:     withoutEnvironment(state.Settings),
+		UserSettings: state.UserSettings,
+	}
+
+	if keyringEnabled {
+		var err error
+		config.Settings, config.UserSettings, err = keyringSettings(config.Settings, config.UserSettings)
+		if err != nil {
+			return err
+		}
+	} else if secretBox != nil {
+		var err error
+		config.Settings, config.UserSettings, err = encryptedSettings(config.Settings, config.UserSettings)
+		if err != nil {
+			return err
+		}
 	}
 
 	for path, repo := range state.Repositories {
-		config.Repositories[path] = Repository{
-			Path:     repo.Path,
-			Schedule: repo.Schedule,
+		saved := Repository{
+			Path:        repo.Path,
+			Schedule:    repo.Schedule,
+			Group:       repo.Group,
+			Tags:        repo.Tags,
+			Owner:       repo.Owner,
+			RepoOptions: repo.RepoOptions,
+			StaleAfter:  repo.StaleAfter,
+		}
+		if stateDB == nil {
+			saved.PendingPR = repo.PendingPR
+			saved.History = repo.History
+			saved.AIUsage = repo.AIUsage
+		}
+		config.Repositories[path] = saved
+	}
+	if stateDB != nil {
+		if err := saveState(); err != nil {
+			return fmt.Errorf("error saving the state database: %v", err)
 		}
 	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	previous, _ := os.ReadFile(configPath)
+	data, err := configfile.Marshal(configPath, config, previous, state.substitutions)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	if err := configfile.Save(configPath, data, 0644); err != nil {
+		return err
+	}
+	rememberConfig(data)
+	return nil
 }
 
 //go:embed templates
@@ -177,34 +441,166 @@ var templates *template.Template
 
 func init() {
 	var err error
-	templates, err = template.ParseFS(templatesFS, "templates/*.html")
+	templates, err = template.New("").Funcs(template.FuncMap{
+		"isTrue": isTrue,
+		"join":   strings.Join,
+	}).ParseFS(templatesFS, "templates/*.html")
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// registerAPI adds the API routes to api.
+func registerAPI(api *mux.Router) {
+	api.HandleFunc("/repositories", handleListRepositories).Methods("GET")
+	api.HandleFunc("/repositories", requireAdmin(requireWritable(requireRepoEditable(handleAddRepository)))).Methods("POST")
+	api.HandleFunc("/repositories/bulk", requireAdmin(requireWritable(requireRepoEditable(handleBulkAddRepositories)))).Methods("POST")
+	api.HandleFunc("/repositories/sync-all", requireAdmin(requireWritable(handleSyncAll))).Methods("POST")
+	api.HandleFunc("/jobs/{id}", handleGetSyncJob).Methods("GET")
+	api.HandleFunc("/repositories/discover", requireAdmin(handleDiscoverRepositories)).Methods("GET")
+	api.HandleFunc("/repositories/detail", handleRepositoryDetail).Methods("GET")
+	api.HandleFunc("/repositories/update", requireAdmin(requireWritable(runExclusive(StepFetch, handleUpdateRepository)))).Methods("POST")
+	api.HandleFunc("/repositories/commit", requireAdmin(requireWritable(runExclusive(StepCommit, handleCommit)))).Methods("POST")
+	api.HandleFunc("/repositories/push", requireAdmin(requireWritable(runExclusive(StepPush, handlePush)))).Methods("POST")
+	api.HandleFunc("/repositories/pr", requireAdmin(requireWritable(runExclusive(StepPR, handleCreatePR)))).Methods("POST")
+	api.HandleFunc("/repositories/remote", requireAdmin(requireWritable(handleAddRemote))).Methods("POST")
+	api.HandleFunc("/repositories/preview-message", requireAdmin(handlePreviewMessage)).Methods("POST")
+	api.HandleFunc("/repositories/tag", requireAdmin(requireWritable(runExclusive(StepTag, handleCreateTag)))).Methods("POST")
+	api.HandleFunc("/repositories/version", requireAdmin(handleSuggestVersion)).Methods("GET")
+	api.HandleFunc("/repositories/settings", handleResolveSettings).Methods("GET")
+	api.HandleFunc("/repositories/prompt", handlePromptPreview).Methods("GET")
+	api.HandleFunc("/repositories/options", requireAdmin(requireWritable(requireRepoEditable(handleUpdateRepositoryOptions)))).Methods("POST")
+	api.HandleFunc("/repositories/move", requireAdmin(requireWritable(requireRepoEditable(handleMoveRepository)))).Methods("POST")
+	api.HandleFunc("/repositories/logs", handleRepoLogs).Methods("GET")
+	api.HandleFunc("/repositories/{path:.+}/activity", handleRepoActivity).Methods("GET")
+	api.HandleFunc("/activity", handleActivityFeed).Methods("GET")
+	api.HandleFunc("/events", handleEvents).Methods("GET")
+	api.HandleFunc("/repositories/pending-pr", handleGetPendingPR).Methods("GET")
+	api.HandleFunc("/repositories/pending-pr", requireAdmin(requireWritable(handleEditPendingPR))).Methods("POST")
+	api.HandleFunc("/repositories/pending-pr/approve", requireAdmin(requireWritable(runExclusive(StepPR, handleApprovePendingPR)))).Methods("POST")
+	api.HandleFunc("/repositories/pending-pr/reject", requireAdmin(requireWritable(handleRejectPendingPR))).Methods("POST")
+	api.HandleFunc("/groups", handleListGroups).Methods("GET")
+	api.HandleFunc("/groups", requireAdmin(requireWritable(handleSaveGroup))).Methods("POST")
+	api.HandleFunc("/groups/delete", requireAdmin(requireWritable(handleDeleteGroup))).Methods("POST")
+	api.HandleFunc("/settings", requireAdmin(handleGetSettings)).Methods("GET")
+	api.HandleFunc("/settings", requireAdmin(requireWritable(handleUpdateSettings))).Methods("POST")
+	api.HandleFunc("/notifications/test", requireAdmin(handleTestNotifications)).Methods("POST")
+	api.HandleFunc("/gemini/models", requireAdmin(handleGeminiModels)).Methods("GET")
+	api.HandleFunc("/openai/models", requireAdmin(handleOpenAIModels)).Methods("GET")
+	api.HandleFunc("/ollama/models", requireAdmin(handleOllamaModels)).Methods("GET")
+	api.HandleFunc("/reports/unpushed", handleUnpushedReport).Methods("GET")
+	api.HandleFunc("/stats", handleStats).Methods("GET")
+	api.HandleFunc("/stats/ai", handleAIStats).Methods("GET")
+	api.HandleFunc("/audit", requireAdmin(handleAuditLog)).Methods("GET")
+	api.HandleFunc("/scheduler/tasks", requireAdmin(handleListTasks)).Methods("GET")
+	api.HandleFunc("/admin/backup", requireAdmin(handleBackup)).Methods("GET")
+	api.HandleFunc("/admin/restore", requireAdmin(requireWritable(handleRestore))).Methods("POST")
+	api.HandleFunc("/admin/read-only", handleGetReadOnly).Methods("GET")
+	api.HandleFunc("/admin/read-only", requireAdmin(handleSetReadOnly)).Methods("POST")
+	api.HandleFunc("/graphql", handleGraphQL).Methods("GET", "POST")
+	api.HandleFunc("/openapi.json", handleOpenAPI).Methods("GET")
+	api.HandleFunc("/docs", handleAPIDocs).Methods("GET")
+}
+
 func main() {
+	readOnlyFlag := flag.Bool("read-only", false, "refuse all mutating git operations and settings changes")
+	airGappedFlag := flag.Bool("air-gapped", false, "only contact git remotes and the Ollama server; push branches instead of opening PRs")
+	pprofFlag := flag.Bool("pprof", false, "serve runtime profiles under /debug/pprof/")
+	publicBadgesFlag := flag.Bool("public-badges", false, "serve the status badges under /badge/ without authentication (or GITWATCHER_PUBLIC_BADGES)")
+	logLevelFlag := flag.String("log-level", "", "minimum log level: debug, info, warn or error")
+	logFormatFlag := flag.String("log-format", "", "log format: text or json")
+	noWebFlag := flag.Bool("no-web", false, "run only the scheduler and git operations, without the dashboard and REST API")
+	encryptFlag := flag.Bool("encrypt-secrets", false, "encrypt tokens, API keys and passphrases in the config file with GITWATCHER_SECRET_KEY, or a key derived from the machine ID")
+	keyringFlag := flag.Bool("keyring", false, "keep tokens, API keys and passphrases in the OS keyring instead of the config file")
+	configFlag := flag.String("config", "", "path of the config file (or GITWATCHER_CONFIG); the audit log is kept next to it")
+	stateDBFlag := flag.String("state-db", "", "SQLite file or postgres:// URL of the database keeping the history, pending PRs and task runs instead of the config file (or GITWATCHER_STATE_DB)")
+	reposFileFlag := flag.String("repos-file", "", "YAML file listing the repositories to watch, applied whenever it changes (or GITWATCHER_REPOS_FILE)")
+	listenFlag := flag.String("listen", "", "address of the dashboard and REST API, or GITWATCHER_LISTEN (default "+defaultListenAddress+")")
+	grpcAddrFlag := flag.String("grpc-addr", "", "also serve the gRPC API on this address, such as :9090 (or GITWATCHER_GRPC_ADDR)")
+	scanFlag := flag.String("scan", "", "print the git repositories found under this directory, one per line as POST /api/v1/repositories/bulk takes them, and exit")
+	serviceFlag := flag.String("service", "", "manage the Windows service: install, uninstall, start or stop; other arguments are passed to the service")
+	flag.Parse()
+
+	if *scanFlag != "" {
+		if err := printRepositories(*scanFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *serviceFlag != "" {
+		if err := controlService(*serviceFlag, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Hand over to the Windows service manager early, it expects to hear
+	// from the service within seconds
+	ctx, stopped := shutdownContext()
+	defer stopped()
+
+	if err := initLogging(*logLevelFlag, *logFormatFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	initReadOnly(*readOnlyFlag)
+	initAirGapped(*airGappedFlag)
+	initPublicBadges(*publicBadgesFlag)
+	headless := headlessMode(*noWebFlag)
+
+	configFile = flagOrEnv(*configFlag, "GITWATCHER_CONFIG", "")
 	if err := loadConfig(); err != nil {
 		log.Fatal(err)
 	}
+	if err := initStateDB(*stateDBFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := initEncryption(*encryptFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := initKeyring(*keyringFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyEnvironment(); err != nil {
+		log.Fatal(err)
+	}
+	if err := initReposFile(*reposFileFlag); err != nil {
+		log.Fatal(err)
+	}
+	watchConfig()
+	grpcAddr := flagOrEnv(*grpcAddrFlag, "GITWATCHER_GRPC_ADDR", "")
 
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(handleAPINotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(handleMethodNotAllowed)
 
 	// API routes
-	api := r.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/repositories", handleListRepositories).Methods("GET")
-	api.HandleFunc("/repositories", handleAddRepository).Methods("POST")
-	api.HandleFunc("/repositories/update", handleUpdateRepository).Methods("POST")
-	api.HandleFunc("/repositories/commit", handleCommit).Methods("POST")
-	api.HandleFunc("/repositories/push", handlePush).Methods("POST")
-	api.HandleFunc("/repositories/pr", handleCreatePR).Methods("POST")
-	api.HandleFunc("/settings", handleGetSettings).Methods("GET")
-	api.HandleFunc("/settings", handleUpdateSettings).Methods("POST")
-	api.HandleFunc("/gemini/models", handleGeminiModels).Methods("GET")
+	v1 := r.PathPrefix(apiPrefix).Subrouter()
+	v1.Use(auditRequests)
+	registerAPI(v1)
+	if err := initOpenAPI(v1); err != nil {
+		log.Fatal(err)
+	}
+	// The unversioned routes are kept for existing scripts
+	legacy := r.PathPrefix("/api").Subrouter()
+	legacy.Use(deprecatedAPI, auditRequests)
+	// Registered first so it wins over the v1 list, which returns pages
+	legacy.HandleFunc("/repositories", handleListRepositoryMap).Methods("GET")
+	registerAPI(legacy)
 
 	// Web routes
+	r.HandleFunc("/auth/github/login", handleGitHubLogin).Methods("GET")
+	r.HandleFunc("/auth/github/callback", handleGitHubCallback).Methods("GET")
+	r.HandleFunc("/auth/logout", handleLogout).Methods("GET")
+	if *pprofFlag {
+		registerPprof(r)
+	}
 	r.HandleFunc("/", handleHome).Methods("GET")
-	r.HandleFunc("/settings", handleSettingsPage).Methods("GET")
+	r.HandleFunc("/settings", requireAdmin(handleSettingsPage)).Methods("GET")
+	r.HandleFunc("/repository", handleRepositoryPage).Methods("GET")
+	r.HandleFunc("/badge/{path:.+}", handleBadge).Methods("GET")
+	r.HandleFunc("/hooks/github", requireWritable(handleGitHubHook)).Methods("POST")
 
 	// Configure CORS for API routes
 	c := cors.New(cors.Options{
@@ -213,27 +609,86 @@ func main() {
 		AllowedHeaders: []string{"*"},
 	})
 
+	err := state.scheduler.AddTask(staleCheckTask, "*/10 * * * *", checkStaleRepositories)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go checkStaleRepositories()
+
+	if err := state.scheduler.AddTask(missingCheckTask, "* * * * *", checkMissingRepositories); err != nil {
+		log.Fatal(err)
+	}
+
+	auditSchedule := state.Settings.UnpushedAuditSchedule
+	if auditSchedule == "" {
+		auditSchedule = defaultUnpushedAuditSchedule
+	}
+	if err := state.scheduler.AddTask(unpushedAuditTask, auditSchedule, runUnpushedAudit); err != nil {
+		slog.Error("Error scheduling unpushed commit audit", "error", err)
+	}
+	scheduleDigest()
+
+	scheduleWatchdog()
+
+	if err := restoreTaskRuns(); err != nil {
+		slog.Error("Error reading the last runs of the scheduled tasks", "error", err)
+	}
+
 	// Start the scheduler
 	state.scheduler.Start()
-	defer state.scheduler.Stop()
+	go broadcastRepoChanges()
+	go deliverWebhooks()
+	configureMQTT()
+
+	if apiToken() == "" && viewerToken() == "" && !oauthEnabled() && (!headless || grpcAddr != "") {
+		slog.Warn("No API token configured, the UI and API are open to anyone who can reach them")
+	}
+
+	var server *http.Server
+	if headless {
+		slog.Info("Running headless, the dashboard and REST API are disabled")
+	} else {
+		server = &http.Server{
+			Addr:    flagOrEnv(*listenFlag, "GITWATCHER_LISTEN", defaultListenAddress),
+			Handler: tagRequests(logRequests(recoverPanics(c.Handler(requireAuth(requireRepoAccess(r)))))),
+		}
+		go func() {
+			slog.Info("Server starting", "address", "http://"+server.Addr)
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if grpcAddr != "" {
+		if grpcServer, err = startGRPC(grpcAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	handler := c.Handler(r)
-	log.Printf("Server starting on http://0.0.0.0:8082")
-	log.Fatal(http.ListenAndServe("0.0.0.0:8082", handler))
+	notifySystemd(systemd.Ready)
+	waitForShutdown(ctx, server, grpcServer)
 }
 
 type PageData struct {
 	Page         string
 	Repositories map[string]*Repository
 	Settings     Settings
+	// User is the GitHub login of the signed in user
+	User string
+	Role string
 }
 
 func handleHome(w http.ResponseWriter, r *http.Request) {
+	user := contextUser(r.Context())
 	state.mu.RLock()
 	data := PageData{
 		Page:         "home",
-		Repositories: state.Repositories,
-		Settings:     state.Settings,
+		Repositories: userRepositories(user),
+		Settings:     state.ownSettings(user),
+		User:         user,
+		Role:         contextRole(r.Context()),
 	}
 	state.mu.RUnlock()
 
@@ -244,11 +699,14 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleSettingsPage(w http.ResponseWriter, r *http.Request) {
+	user := contextUser(r.Context())
 	state.mu.RLock()
 	data := PageData{
 		Page:         "settings",
-		Repositories: state.Repositories,
-		Settings:     state.Settings,
+		Repositories: userRepositories(user),
+		Settings:     state.ownSettings(user),
+		User:         user,
+		Role:         contextRole(r.Context()),
 	}
 	state.mu.RUnlock()
 
@@ -258,71 +716,90 @@ func handleSettingsPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleListRepositories(w http.ResponseWriter, r *http.Request) {
-	state.mu.RLock()
-	defer state.mu.RUnlock()
-
-	json.NewEncoder(w).Encode(state.Repositories)
-}
-
 func handleAddRepository(w http.ResponseWriter, r *http.Request) {
 	var repo Repository
-	log.Printf("Adding repository: %v", r.Body)
 
 	if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	absPath, err := filepath.Abs(repo.Path)
+	repo.Path = absRequestPath(repo.Path)
+	repo.Owner = contextUser(r.Context())
+
+	errs, err := addRepository(r.Context(), &repo)
+	if writeFieldErrors(w, errs) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	repo.Path = absPath
 
-	_, err = git.PlainOpen(repo.Path)
+	err = saveConfig()
 	if err != nil {
-		http.Error(w, "Invalid git repository path", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error saving config", "error", err)
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Getting repo status for %s", repo.Path)
+	w.WriteHeader(http.StatusCreated)
+	slog.InfoContext(r.Context(), "Repository added", "repo", repo.Path, "user", repo.Owner)
+}
+
+// addRepository validates repo and starts watching it, without saving the
+// config. Its path must already be absolute. Invalid fields are returned as
+// errs, other failures as err.
+func addRepository(ctx context.Context, repo *Repository) (errs FieldErrors, err error) {
+	// Validate everything before touching the repository or the scheduler
+	if errs := validateRepository(repo); len(errs) > 0 {
+		return errs, nil
+	}
 
-	status, err := gitops.GetRepoStatus(repo.Path)
+	slog.DebugContext(ctx, "Getting repo status", "repo", repo.Path)
+
+	state.mu.RLock()
+	_, exists := state.Repositories[repo.Path]
+	scopes := resolveOptions(repo).Scopes
+	state.mu.RUnlock()
+	if exists {
+		return alreadyWatched(), nil
+	}
+	status, err := gitops.GetRepoStatus(repo.Path, scopes)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Error getting repo status: %v", err)
 	}
 	repo.Status = status
+	repo.RunState = RunIdle
 
 	state.mu.Lock()
+	// Another request may have added the same path while we read its status
+	if _, exists := state.Repositories[repo.Path]; exists {
+		state.mu.Unlock()
+		return alreadyWatched(), nil
+	}
 
-	state.Repositories[repo.Path] = &repo
-
-	state.mu.Unlock()
-
-	log.Printf("Adding scheduler task for %s", repo.Path)
+	state.Repositories[repo.Path] = repo
+	slog.DebugContext(ctx, "Adding scheduler task", "repo", repo.Path, "schedule", effectiveSchedule(repo))
 
 	// Set up scheduler for the repository
-	err = state.scheduler.AddTask(repo.Path, repo.Schedule, func() {
-		handleScheduledTask(repo.Path)
-	})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error setting up schedule: %v", err), http.StatusInternalServerError)
-		return
-	}
+	err = scheduleRepository(repo)
+
+	state.mu.Unlock()
+	notifyRepoChanged(repo.Path)
 
-	log.Printf("Saving config")
-	err = saveConfig()
 	if err != nil {
-		log.Printf("Error saving config: %v", err)
-		http.Error(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("Error setting up schedule: %v", err)
 	}
+	return nil, nil
+}
 
-	w.WriteHeader(http.StatusCreated)
-	log.Printf("Repository added successfully")
+// alreadyWatched is the field error for adding a path that is already
+// watched, which would otherwise replace its history and pending PR.
+func alreadyWatched() FieldErrors {
+	errs := FieldErrors{}
+	errs.add("path", "is already watched")
+	return errs
 }
 
 func handleUpdateRepository(w http.ResponseWriter, r *http.Request) {
@@ -330,37 +807,23 @@ func handleUpdateRepository(w http.ResponseWriter, r *http.Request) {
 		Path string `json:"path"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	path := req.Path
 
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apiError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	// Perform fetch
-	err = gitops.FetchRepository(absPath)
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		log.Printf("Warning: fetch error: %v", err)
-	}
-
-	// Get updated status
-	status, err := gitops.GetRepoStatus(absPath)
+	status, err := refreshRemote(r.Context(), absPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
+		apiError(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	state.mu.Lock()
-	if repo, exists := state.Repositories[absPath]; exists {
-		repo.Status = status
-		repo.LastSync = time.Now()
-	}
-	state.mu.Unlock()
-
 	json.NewEncoder(w).Encode(status)
 }
 
@@ -369,32 +832,32 @@ func handleCommit(w http.ResponseWriter, r *http.Request) {
 		Path string `json:"path"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	path := req.Path
 
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apiError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	state.mu.RLock()
-	defer state.mu.RUnlock()
-
-	settings := &state.Settings
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
 
-	err = gitops.CommitChanges(absPath, settings.GetAIService())
+	before, _ := gitops.HeadHash(absPath)
+	err = gitops.CommitChanges(absPath, opts.AIService(&settings).WithContext(r.Context()), opts.CommitOptions())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error committing changes: %v", err), http.StatusInternalServerError)
+		apiError(w, fmt.Sprintf("Error committing changes: %v", err), http.StatusInternalServerError)
 		return
 	}
+	recordCommits(absPath, before, Operation{Trigger: TriggerManual, User: contextUser(r.Context())})
 
 	// Get updated status
-	status, err := gitops.GetRepoStatus(absPath)
+	status, err := repoStatus(absPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
+		apiError(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -406,145 +869,566 @@ func handlePush(w http.ResponseWriter, r *http.Request) {
 		Path string `json:"path"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	path := req.Path
 
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apiError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	err = gitops.PushChanges(absPath)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error pushing changes: %v", err), http.StatusInternalServerError)
+	pushOptions := gitops.PushOptions{SSHKeyPath: repoSettings(absPath).SSHKeyPath}
+	pushOptions.Force = repoOptions(absPath).ForcePush
+
+	err = gitops.PushChanges(absPath, pushOptions)
+	if errors.Is(err, gitops.ErrNonFastForward) || errors.Is(err, gitops.ErrNoRemote) {
+		apiError(w, fmt.Sprintf("Error pushing changes: %v", err), http.StatusConflict)
+		return
+	}
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		apiError(w, fmt.Sprintf("Error pushing changes: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if err == nil {
+		recordPush(absPath, Operation{Trigger: TriggerManual, User: contextUser(r.Context())})
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func handleCreatePR(w http.ResponseWriter, r *http.Request) {
+// handleAddRemote configures a remote on a repository that was created
+// without one, so the push and PR stages can run.
+func handleAddRemote(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Path string `json:"path"`
+		Name string `json:"name"`
+		URL  string `json:"url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		apiError(w, "Remote URL is required", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = "origin"
+	}
+	// Pushes, PRs and the incoming check all go through origin
+	if req.Name != "origin" {
+		apiError(w, "Only the origin remote is supported, push and PRs use it", http.StatusBadRequest)
 		return
 	}
 
 	absPath, err := filepath.Abs(req.Path)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		apiError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	state.mu.RLock()
-	defer state.mu.RUnlock()
+	if err := gitops.AddRemote(absPath, req.Name, req.URL); err != nil {
+		apiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status, err := repoStatus(absPath)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-	settings := &state.Settings
+	state.mu.Lock()
+	if repo, exists := state.Repositories[absPath]; exists {
+		repo.Status = status
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(absPath)
 
-	err = gitops.CreateDraftPR(absPath, settings.GetAIService(), settings.GitHubToken)
+	json.NewEncoder(w).Encode(status)
+}
+
+// PRResult describes the PR that was opened, or why none was needed when
+// Skipped is set.
+type PRResult struct {
+	Number  int    `json:"number,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func handleCreatePR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath, err := filepath.Abs(req.Path)
 	if err != nil {
-		log.Printf("Error creating PR: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating PR: %v", err), http.StatusInternalServerError)
+		apiError(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if r.URL.Query().Get("stream") == "true" {
+		streamCreatePR(w, r, absPath)
+		return
+	}
+
+	result, status, err := createPR(r.Context(), absPath, nil)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error creating PR: %v", err), status)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// createPR opens a PR for the repository at absPath, reporting generation
+// progress to progress when it is set. On failure it also returns the HTTP
+// status describing the error.
+func createPR(ctx context.Context, absPath string, progress gitops.ProgressFunc) (*PRResult, int, error) {
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	aiService := opts.AIService(&settings).WithContext(ctx)
+	aiService.Progress = progress
+
+	if gitops.AirGapped() {
+		return airGappedPR(absPath, settings.SSHKeyPath)
+	}
+
+	githubToken := settings.githubToken(ctx)
+	pr, err := gitops.CreateDraftPR(absPath, aiService, githubToken, opts.PROptions(&settings))
+	var nothing *gitops.NothingToPRError
+	if errors.As(err, &nothing) {
+		slog.Info("Not creating PR", "repo", absPath, "reason", err)
+		return &PRResult{Skipped: true, Reason: nothing.Error()}, http.StatusOK, nil
+	}
+	if errors.Is(err, gitops.ErrNoRemote) {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		slog.Error("Error creating PR", "repo", absPath, "operation", "pr", "error", err)
+		return nil, http.StatusInternalServerError, err
+	}
+
+	recordOperation(absPath, Operation{
+		Type:     "pr",
+		Trigger:  TriggerManual,
+		User:     contextUser(ctx),
+		PRNumber: pr.Number,
+		PRURL:    pr.HTMLURL,
+		Title:    pr.Title,
+	})
+
+	if opts.AutoMerge {
+		if err := gitops.EnableAutoMerge(absPath, pr, githubToken); err != nil {
+			slog.Error("Error enabling auto-merge", "repo", absPath, "error", err)
+		}
+	}
+
+	return &PRResult{
+		Number: pr.Number,
+		URL:    pr.HTMLURL,
+		Title:  pr.Title,
+	}, http.StatusOK, nil
+}
+
+// airGappedPR pushes the branch a PR would be opened for, since GitHub cannot
+// be reached in air-gapped mode.
+func airGappedPR(absPath string, sshKeyPath string) (*PRResult, int, error) {
+	err := gitops.EnsurePRBranch(absPath, "main", sshKeyPath)
+	var nothing *gitops.NothingToPRError
+	switch {
+	case errors.As(err, &nothing):
+		return &PRResult{Skipped: true, Reason: nothing.Error()}, http.StatusOK, nil
+	case errors.Is(err, gitops.ErrNoRemote):
+		return nil, http.StatusConflict, err
+	case err != nil:
+		return nil, http.StatusInternalServerError, fmt.Errorf("error pushing branch: %v", err)
+	}
+
+	slog.Info("Pushed the branch, not creating a PR in air-gapped mode", "repo", absPath)
+	return &PRResult{Skipped: true, Reason: "branch pushed, PRs are not created in air-gapped mode"}, http.StatusOK, nil
 }
 
+// checksTimeout bounds how long the scheduled pipeline waits for CI before
+// giving up on opening a PR.
+const checksTimeout = 30 * time.Minute
+
+// pushAttempts is the number of times the scheduled pipeline tries to push
+// before saving the commits to a recovery branch.
+const pushAttempts = 3
+
 func handleScheduledTask(repoPath string) {
-	state.mu.RLock()
-	defer state.mu.RUnlock()
+	trackScheduledRun(repoPath, syncRepository(repoPath))
+}
 
+// syncRepository runs the pipeline of the repository: commit, push and PR.
+// It returns the error recorded on the repository, nil when it synced or had
+// nothing to sync.
+func syncRepository(repoPath string) error {
+	state.mu.RLock()
 	repo, exists := state.Repositories[repoPath]
-	settings := &state.Settings
+	settings := state.settingsFor(repoPath)
+	var opts ResolvedOptions
+	if exists {
+		opts = resolveOptions(repo)
+	}
+	state.mu.RUnlock()
+	pushOptions := gitops.PushOptions{SSHKeyPath: settings.SSHKeyPath, Force: opts.ForcePush}
+	logger := slog.With("repo", repoPath, "operation", "sync")
 
 	if !exists {
-		log.Printf("Repository not found for scheduled task: %s", repoPath)
-		return
+		logger.Warn("Repository not found for scheduled task")
+		return fmt.Errorf("repository %s is not watched", repoPath)
+	}
+
+	if readOnly.Load() {
+		logger.Info("Skipping scheduled task in read-only mode")
+		return nil
 	}
 
-	status, err := gitops.GetRepoStatus(repoPath)
+	if err := beginRun(repoPath, StepStatus); err != nil {
+		logger.Info("Skipping scheduled task", "reason", err)
+		return err
+	}
+	defer endRun(repoPath)
+
+	status, err := gitops.GetRepoStatus(repoPath, opts.Scopes)
 	if err != nil {
-		log.Printf("Error getting repo status: %v", err)
-		return
+		if pathMissing(repoPath) {
+			setMissing(repoPath, true)
+			return fmt.Errorf("repository %s is missing from disk", repoPath)
+		}
+		logger.Error("Error getting repo status", "error", err)
+		return setRepoError(repoPath, fmt.Errorf("error getting repo status: %v", err))
 	}
 
 	if !status.HasChanges {
-		return
+		return nil
 	}
 
+	// Every path below ends in setRepoSynced or setRepoError
+	start := time.Now()
+	defer func() {
+		state.mu.RLock()
+		lastError := repo.LastError
+		state.mu.RUnlock()
+		recordOperation(repoPath, Operation{
+			Type:       "sync",
+			Trigger:    TriggerScheduler,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      lastError,
+		})
+	}()
+
 	// Commit changes
-	err = gitops.CommitChanges(repoPath, settings.GetAIService())
+	setRunStep(repoPath, StepCommit)
+	before, _ := gitops.HeadHash(repoPath)
+	err = gitops.CommitChanges(repoPath, opts.AIService(&settings), opts.CommitOptions())
 	if err != nil {
-		log.Printf("Error committing changes: %v", err)
-		return
+		logger.Error("Error committing changes", "error", err)
+		return setRepoError(repoPath, fmt.Errorf("error committing changes: %v", err))
+	}
+	recordCommits(repoPath, before, Operation{Trigger: TriggerScheduler})
+
+	recordAudit(AuditEntry{Actor: ActorScheduler, Action: "commit", Repo: repoPath})
+
+	if !status.HasRemote {
+		logger.Info("No remote configured, skipping push and PR")
+		setRepoSynced(repoPath, status)
+		return nil
+	}
+
+	if opts.SquashCommits {
+		setRunStep(repoPath, StepSquash)
+		squashed, err := gitops.SquashCommits(repoPath, opts.AIService(&settings), "main", opts.CommitOptions())
+		if err != nil {
+			logger.Error("Error squashing commits", "error", err)
+			return setRepoError(repoPath, fmt.Errorf("error squashing commits: %v", err))
+		}
+		// Earlier auto-commits may already be on the remote, so the rewritten
+		// branch has to be force pushed (still guarded by the lease)
+		if squashed > 0 {
+			pushOptions.Force = true
+		}
 	}
 
 	// Push changes
-	err = gitops.PushChanges(repoPath)
+	setRunStep(repoPath, StepPush)
+	err = gitops.PushChangesWithRetry(repoPath, pushOptions, pushAttempts)
 	if err != nil {
-		log.Printf("Error pushing changes: %v", err)
-		return
+		logger.Error("Error pushing changes", "error", err)
+		branch, rerr := gitops.CreateRecoveryBranch(repoPath)
+		if rerr != nil {
+			logger.Error("Error creating recovery branch", "error", rerr)
+		} else if branch != "" {
+			err = fmt.Errorf("%v (unpushed commits saved to %s)", err, branch)
+			if status, serr := gitops.GetRepoStatus(repoPath, opts.Scopes); serr == nil {
+				state.mu.Lock()
+				repo.Status = status
+				state.mu.Unlock()
+			}
+		}
+		return setRepoError(repoPath, fmt.Errorf("error pushing changes: %v", err))
 	}
+	recordAudit(AuditEntry{Actor: ActorScheduler, Action: "push", Repo: repoPath})
+	recordPush(repoPath, Operation{Trigger: TriggerScheduler})
 
-	err = gitops.CreateDraftPR(repoPath, settings.GetAIService(), settings.GitHubToken)
-	if err != nil {
-		log.Printf("Error creating PR: %v", err)
-		return
+	if opts.WaitForChecks && !gitops.AirGapped() {
+		setRunStep(repoPath, StepChecks)
+		err = gitops.WaitForChecks(repoPath, settings.githubToken(context.Background()), checksTimeout)
+		if err != nil {
+			logger.Info("Not creating PR", "reason", err)
+			return setRepoError(repoPath, err)
+		}
 	}
 
+	setRunStep(repoPath, StepPR)
+	err = gitops.EnsurePRBranch(repoPath, "main", settings.SSHKeyPath)
+	var nothing *gitops.NothingToPRError
+	switch {
+	case errors.As(err, &nothing):
+		logger.Info("Not creating PR", "reason", err)
+	case err != nil:
+		logger.Error("Error preparing PR branch", "error", err)
+		return setRepoError(repoPath, fmt.Errorf("error preparing PR branch: %v", err))
+	case gitops.AirGapped():
+		logger.Info("Pushed the branch, not creating a PR in air-gapped mode")
+	case opts.RequireApproval:
+		draft, err := gitops.GeneratePRDraft(repoPath, opts.AIService(&settings), opts.PROptions(&settings))
+		if err != nil {
+			logger.Error("Error generating PR", "error", err)
+			return setRepoError(repoPath, fmt.Errorf("error generating PR: %v", err))
+		}
+		setPendingPR(repoPath, draft)
+		recordAudit(AuditEntry{Actor: ActorScheduler, Action: "pending-pr", Repo: repoPath, Detail: draft.Title})
+		if err := saveConfig(); err != nil {
+			logger.Error("Error saving config", "error", err)
+		}
+	default:
+		githubToken := settings.githubToken(context.Background())
+		pr, err := gitops.CreateDraftPR(repoPath, opts.AIService(&settings), githubToken, opts.PROptions(&settings))
+		if err != nil {
+			logger.Error("Error creating PR", "error", err)
+			return setRepoError(repoPath, fmt.Errorf("error creating PR: %v", err))
+		}
+
+		recordAudit(AuditEntry{Actor: ActorScheduler, Action: "pr", Repo: repoPath, Detail: pr.HTMLURL})
+		recordOperation(repoPath, Operation{
+			Type:     "pr",
+			Trigger:  TriggerScheduler,
+			PRNumber: pr.Number,
+			PRURL:    pr.HTMLURL,
+			Title:    pr.Title,
+		})
+
+		if opts.AutoMerge {
+			if err := gitops.EnableAutoMerge(repoPath, pr, githubToken); err != nil {
+				logger.Error("Error enabling auto-merge", "error", err)
+			}
+		}
+	}
+
+	setRepoSynced(repoPath, status)
+	return nil
+}
+
+// setRepoSynced records a successful pipeline run on the repository.
+func setRepoSynced(repoPath string, status *gitops.RepoStatus) {
 	state.mu.Lock()
 	defer state.mu.Unlock()
 
-	repo.LastSync = time.Now()
-	repo.Status = status
-	state.Repositories[repoPath] = repo
+	if repo, exists := state.Repositories[repoPath]; exists {
+		repo.LastSync = time.Now()
+		repo.LastError = ""
+		repo.Status = status
+	}
+	notifyRepoChanged(repoPath)
+}
+
+// setRepoError records the failure of the last pipeline run on the
+// repository, and returns err.
+func setRepoError(repoPath string, err error) error {
+	step := ""
+	state.mu.Lock()
+	if repo, exists := state.Repositories[repoPath]; exists {
+		repo.LastError = err.Error()
+		step = repo.Step
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(repoPath)
+
+	recordOperation(repoPath, Operation{Type: "error", Trigger: TriggerScheduler, Error: err.Error(), Step: step})
+	return err
 }
 
 func handleGetSettings(w http.ResponseWriter, r *http.Request) {
 	state.mu.RLock()
 	defer state.mu.RUnlock()
 
-	json.NewEncoder(w).Encode(state.Settings)
+	json.NewEncoder(w).Encode(state.ownSettings(contextUser(r.Context())))
 }
 
+// handleUpdateSettings changes the instance settings, or the caller's own
+// settings when they are signed in. It answers 409 when they changed since
+// they were read, rather than losing the other change.
 func handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
-	var settings Settings
+	user := contextUser(r.Context())
+	state.mu.RLock()
+	current := state.ownSettings(user)
+	state.mu.RUnlock()
+	settings := current
+
+	// Decode on top of the current settings so omitted fields are kept
 	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if settings.CommitFormat != "" && settings.CommitFormat != gitops.CommitFormatConventional {
+		apiError(w, "Invalid commit format", http.StatusBadRequest)
+		return
+	}
+	if err := settings.Defaults.validate(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validateRoles(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validateWebhooks(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validateEmail(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validatePush(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validateMQTT(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := settings.validateAirGap(); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settings.FailureIssueAfter < 0 {
+		apiError(w, "Invalid failureIssueAfter, it must be 0 or more", http.StatusBadRequest)
 		return
 	}
 
 	state.mu.Lock()
-	state.Settings = settings
+	if len(diffSettings(current, state.ownSettings(user))) > 0 {
+		state.mu.Unlock()
+		apiError(w, "Settings changed while updating them, reload and retry", http.StatusConflict)
+		return
+	}
+	if user != "" {
+		settings.clearInstanceFields()
+	}
+	changes := diffSettings(current, settings)
+	resp := SettingsUpdateResponse{Changes: changes}
+
+	if r.URL.Query().Get("preview") == "true" {
+		state.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if hasDangerousChange(changes) && r.URL.Query().Get("confirm") != "true" {
+		state.mu.Unlock()
+		apiErrorDetails(w, "Changes require confirmation, resend with ?confirm=true", http.StatusConflict, resp)
+		return
+	}
+
+	if user != "" {
+		state.UserSettings[user] = &settings
+	} else {
+		state.Settings = settings
+	}
 	state.mu.Unlock()
 
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	auditDetail(r, "changed "+strings.Join(fields, ", "))
+	scheduleDigest()
+	configureMQTT()
+
 	if err := saveConfig(); err != nil {
-		http.Error(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	resp.Applied = true
+	json.NewEncoder(w).Encode(resp)
 }
 
 func handleGeminiModels(w http.ResponseWriter, r *http.Request) {
 	state.mu.RLock()
-	settings := state.Settings
+	settings := state.settingsOf(contextUser(r.Context()))
 	state.mu.RUnlock()
 
 	if settings.GeminiAPIKey == "" {
-		http.Error(w, "Gemini API key not configured", http.StatusBadRequest)
+		apiError(w, "Gemini API key not configured", http.StatusBadRequest)
 		return
 	}
 
 	models, err := gitops.GetGeminiModels(settings.GeminiAPIKey)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error fetching Gemini models: %v", err), http.StatusInternalServerError)
+		apiError(w, fmt.Sprintf("Error fetching Gemini models: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models)
+}
+
+func handleOllamaModels(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	settings := state.settingsOf(contextUser(r.Context()))
+	state.mu.RUnlock()
+
+	if settings.OllamaServer == "" {
+		apiError(w, "Ollama server not configured", http.StatusBadRequest)
+		return
+	}
+
+	models, err := gitops.GetOllamaModels(settings.OllamaServer)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error fetching Ollama models: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models)
+}
+
+func handleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	settings := state.settingsOf(contextUser(r.Context()))
+	state.mu.RUnlock()
+
+	if settings.OpenAIAPIKey == "" {
+		apiError(w, "OpenAI API key not configured", http.StatusBadRequest)
+		return
+	}
+
+	models, err := gitops.GetOpenAIModels(settings.OpenAIAPIKey)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error fetching OpenAI models: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gitwatcher/internal/gitops"
+)
+
+const missingCheckTask = "missing-check"
+
+// pathMissing reports whether the working tree at path is gone. A repository
+// on an unmounted drive leaves its mount point behind, so the .git entry is
+// what is looked for.
+func pathMissing(path string) bool {
+	_, err := os.Lstat(filepath.Join(path, ".git"))
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// setMissing marks the repository at path as missing from disk, pausing its
+// schedule, or as back, scheduling it again.
+func setMissing(path string, missing bool) {
+	state.mu.RLock()
+	repo, exists := state.Repositories[path]
+	changed := exists && repo.Missing != missing
+	state.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	// The status from before the repository went missing is stale
+	var status *gitops.RepoStatus
+	if !missing {
+		var err error
+		if status, err = repoStatus(path); err != nil {
+			slog.Warn("Error getting repo status", "repo", path, "error", err)
+		}
+	}
+
+	state.mu.Lock()
+	if repo, exists = state.Repositories[path]; !exists || repo.Missing == missing {
+		state.mu.Unlock()
+		return
+	}
+	repo.Missing = missing
+	if missing {
+		slog.Warn("Repository is missing from disk, pausing its schedule", "repo", path)
+	} else {
+		slog.Info("Repository is back on disk, resuming its schedule", "repo", path)
+		if status != nil {
+			repo.Status = status
+		}
+	}
+	if err := scheduleRepository(repo); err != nil {
+		slog.Error("Error setting up schedule", "repo", path, "error", err)
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+}
+
+// checkMissingRepositories looks for repositories that disappeared from disk
+// or came back.
+func checkMissingRepositories() {
+	state.mu.RLock()
+	paths := make([]string, 0, len(state.Repositories))
+	for path := range state.Repositories {
+		paths = append(paths, path)
+	}
+	state.mu.RUnlock()
+
+	for _, path := range paths {
+		setMissing(path, pathMissing(path))
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// MoveRepositoryRequest is the body of POST /repositories/move.
+type MoveRepositoryRequest struct {
+	Path string `json:"path"`
+	// NewPath is where the working tree was moved to
+	NewPath string `json:"newPath"`
+}
+
+// handleMoveRepository re-keys a repository whose working tree was moved or
+// renamed on disk, keeping its configuration, history, pending PR and
+// schedule.
+func handleMoveRepository(w http.ResponseWriter, r *http.Request) {
+	var req MoveRepositoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from := absRequestPath(req.Path)
+	to := absRequestPath(expandHome(req.NewPath))
+
+	// validateRepoPath reports under path, the field is newPath here
+	errs, pathErrs := FieldErrors{}, FieldErrors{}
+	validateRepoPath(to, pathErrs)
+	for _, message := range pathErrs {
+		errs.add("newPath", message)
+	}
+	if to != "" && to == from {
+		errs.add("newPath", "is the current path")
+	}
+	if writeFieldErrors(w, errs) {
+		return
+	}
+
+	status, err := gitops.GetRepoStatus(to, repoOptions(from).Scopes)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error getting repo status: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	state.mu.Lock()
+	repo, exists := state.Repositories[from]
+	if !exists {
+		state.mu.Unlock()
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	if _, taken := state.Repositories[to]; taken {
+		state.mu.Unlock()
+		errs.add("newPath", "is already watched")
+		writeFieldErrors(w, errs)
+		return
+	}
+	if repo.RunState == RunRunning {
+		state.mu.Unlock()
+		apiError(w, fmt.Sprintf("%v running %s", errRepositoryBusy, repo.Step), http.StatusConflict)
+		return
+	}
+	if stateDB != nil {
+		if err := moveStoredRepository(from, to); err != nil {
+			state.mu.Unlock()
+			apiError(w, fmt.Sprintf("Error moving the stored state: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	task, scheduled := state.scheduler.Task(from)
+	state.scheduler.RemoveTask(from)
+	stopWatch(from)
+	delete(state.Repositories, from)
+	repo.Path = to
+	repo.Status = status
+	repo.Missing = false
+	state.Repositories[to] = repo
+	err = scheduleRepository(repo)
+	if scheduled && !task.LastRun.IsZero() {
+		state.scheduler.SetLastRun(to, task.LastRun, time.Duration(task.LastDurationMs)*time.Millisecond)
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(from)
+	notifyRepoChanged(to)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error setting up schedule: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Repository moved", "from", from, "to", to)
+
+	if err := saveConfig(); err != nil {
+		apiError(w, fmt.Sprintf("Error saving config: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
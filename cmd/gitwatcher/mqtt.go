@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// defaultMQTTTopicPrefix is the topic prefix used when the mqttTopicPrefix
+// setting is empty.
+const defaultMQTTTopicPrefix = "gitwatcher"
+
+// MQTTRepositoryState is the retained message published on
+// <prefix>/repositories/<id>/state whenever a repository changes.
+type MQTTRepositoryState struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	RunState  string    `json:"runState"`
+	Step      string    `json:"step,omitempty"`
+	Branch    string    `json:"branch,omitempty"`
+	Clean     bool      `json:"clean"`
+	Changes   int       `json:"changes"`
+	Incoming  int       `json:"incoming"`
+	Stale     bool      `json:"stale"`
+	Missing   bool      `json:"missing"`
+	LastSync  time.Time `json:"lastSync"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type mqttConfig struct {
+	broker   string
+	username string
+	password string
+	prefix   string
+}
+
+// mqttClient is the connection to the broker of the settings, nil when no
+// broker is set.
+var mqttClient struct {
+	mu     sync.Mutex
+	client mqtt.Client
+	config mqttConfig
+}
+
+// configureMQTT connects to the broker of the MQTT settings, reconnecting
+// when they changed, or disconnects when no broker is set.
+func configureMQTT() {
+	state.mu.RLock()
+	settings := state.Settings
+	state.mu.RUnlock()
+	config := mqttConfig{
+		broker:   settings.MQTTBroker,
+		username: settings.MQTTUsername,
+		password: settings.MQTTPassword,
+		prefix:   settings.MQTTTopicPrefix,
+	}
+	if config.prefix == "" {
+		config.prefix = defaultMQTTTopicPrefix
+	}
+	if config.broker != "" && !settings.airGapAllows(airGapMQTT) {
+		slog.Info("Not connecting to the MQTT broker in air-gapped mode", "broker", webhookHost(config.broker))
+		config = mqttConfig{prefix: config.prefix}
+	}
+
+	mqttClient.mu.Lock()
+	defer mqttClient.mu.Unlock()
+	if config == mqttClient.config {
+		return
+	}
+	disconnectMQTT()
+	mqttClient.config = config
+	if config.broker == "" {
+		return
+	}
+
+	statusTopic := config.prefix + "/status"
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.broker).
+		SetClientID("gitwatcher-"+newRequestID()).
+		SetUsername(config.username).
+		SetPassword(config.password).
+		SetWill(statusTopic, "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			slog.Info("Connected to the MQTT broker", "broker", webhookHost(config.broker))
+			c.Publish(statusTopic, 1, true, "online")
+			publishMQTTStates(c, config.prefix)
+		}).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			slog.Warn("Lost the connection to the MQTT broker", "broker", webhookHost(config.broker), "error", err)
+		})
+	mqttClient.client = mqtt.NewClient(opts)
+	// Connections are retried in the background until the broker answers
+	mqttClient.client.Connect()
+}
+
+// stopMQTT marks GitWatcher offline and disconnects from the broker on
+// shutdown.
+func stopMQTT() {
+	mqttClient.mu.Lock()
+	defer mqttClient.mu.Unlock()
+	disconnectMQTT()
+}
+
+// disconnectMQTT publishes the offline status and disconnects. The caller
+// must hold mqttClient.mu.
+func disconnectMQTT() {
+	if mqttClient.client == nil {
+		return
+	}
+	if mqttClient.client.IsConnectionOpen() {
+		mqttClient.client.Publish(mqttClient.config.prefix+"/status", 1, true, "offline").WaitTimeout(time.Second)
+	}
+	mqttClient.client.Disconnect(250)
+	mqttClient.client = nil
+}
+
+// publishMQTT publishes payload on the topic under the prefix, when
+// connected.
+func publishMQTT(topic string, retained bool, payload interface{}) {
+	mqttClient.mu.Lock()
+	client, prefix := mqttClient.client, mqttClient.config.prefix
+	mqttClient.mu.Unlock()
+	if client == nil || !client.IsConnectionOpen() {
+		return
+	}
+	client.Publish(prefix+"/"+topic, 1, retained, payload)
+}
+
+// publishMQTTState publishes the state of repo, a copy the caller owns.
+func publishMQTTState(repo *Repository) {
+	payload, err := json.Marshal(mqttState(repo))
+	if err != nil {
+		return
+	}
+	publishMQTT(mqttRepoTopic(repo.Path, "state"), true, payload)
+}
+
+// clearMQTTState removes the retained state of a repository that is no
+// longer watched.
+func clearMQTTState(path string) {
+	publishMQTT(mqttRepoTopic(path, "state"), true, []byte{})
+}
+
+// publishMQTTEvent publishes the event payload of an operation recorded on
+// the repository at path, the same as the webhooks receive.
+func publishMQTTEvent(path string, payload []byte) {
+	publishMQTT(mqttRepoTopic(path, "events"), false, payload)
+}
+
+// publishMQTTStates publishes the state of every repository through c, so
+// the retained messages are current after a reconnection.
+func publishMQTTStates(c mqtt.Client, prefix string) {
+	state.mu.RLock()
+	states := make([]MQTTRepositoryState, 0, len(state.Repositories))
+	for _, repo := range state.Repositories {
+		states = append(states, mqttState(repo))
+	}
+	state.mu.RUnlock()
+
+	for _, s := range states {
+		payload, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		c.Publish(prefix+"/"+mqttRepoTopic(s.Path, "state"), 1, true, payload)
+	}
+}
+
+// mqttState returns the MQTT state of repo. The caller must hold state.mu
+// or own repo.
+func mqttState(repo *Repository) MQTTRepositoryState {
+	s := MQTTRepositoryState{
+		Path:      repo.Path,
+		Name:      filepath.Base(repo.Path),
+		RunState:  repo.RunState,
+		Step:      repo.Step,
+		Stale:     repo.Stale,
+		Missing:   repo.Missing,
+		LastSync:  repo.LastSync,
+		LastError: repo.LastError,
+	}
+	if repo.Status != nil {
+		s.Branch = repo.Status.CurrentBranch
+		s.Clean = repo.Status.IsClean
+		s.Changes = len(repo.Status.ChangedFiles)
+	}
+	if repo.Incoming != nil {
+		s.Incoming = repo.Incoming.Count
+	}
+	return s
+}
+
+// mqttRepoTopic returns the topic of a repository, named after its path with
+// the separators and MQTT wildcards replaced, such as
+// repositories/home_me_notes/state.
+func mqttRepoTopic(path, kind string) string {
+	id := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '+', '#', ' ':
+			return '_'
+		}
+		return r
+	}, strings.TrimLeft(path, "/"))
+	return "repositories/" + id + "/" + kind
+}
+
+// validateMQTT checks the broker URL and the topic prefix.
+func (s *Settings) validateMQTT() error {
+	if s.MQTTBroker != "" {
+		u, err := url.Parse(s.MQTTBroker)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("Invalid MQTT broker URL")
+		}
+		switch u.Scheme {
+		case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+		default:
+			return fmt.Errorf("Invalid MQTT broker URL, the scheme must be tcp, ssl, ws or wss")
+		}
+	}
+	prefix := s.MQTTTopicPrefix
+	if strings.ContainsAny(prefix, "+#") || strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") || strings.HasPrefix(prefix, "$") {
+		return fmt.Errorf("Invalid MQTT topic prefix %s", prefix)
+	}
+	return nil
+}
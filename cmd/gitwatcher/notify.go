@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/mailer"
+	"gitwatcher/internal/push"
+	"gitwatcher/internal/scheduler"
+)
+
+// Notification is a message for the people watching the repositories.
+// Urgent ones are sent with a high priority by the push channels.
+type Notification struct {
+	Title   string
+	Message string
+	Urgent  bool
+}
+
+// notificationChannel is a way of sending notifications. configured
+// reports whether the settings enable it, and failures whether it takes the
+// notifications of pipeline failures.
+type notificationChannel struct {
+	name       string
+	configured func(s *Settings) bool
+	failures   func(s *Settings) bool
+	send       func(s *Settings, n Notification) error
+}
+
+var notificationChannels = []notificationChannel{
+	{
+		name:       "email",
+		configured: func(s *Settings) bool { return s.SMTPHost != "" },
+		failures:   func(s *Settings) bool { return s.EmailFailures },
+		send:       sendEmail,
+	},
+	{
+		name:       "ntfy",
+		configured: func(s *Settings) bool { return s.NtfyURL != "" },
+		failures:   func(s *Settings) bool { return true },
+		send: func(s *Settings, n Notification) error {
+			return push.Ntfy(context.Background(), s.NtfyURL, s.NtfyToken, n.pushMessage())
+		},
+	},
+	{
+		name:       "gotify",
+		configured: func(s *Settings) bool { return s.GotifyURL != "" },
+		failures:   func(s *Settings) bool { return true },
+		send: func(s *Settings, n Notification) error {
+			return push.Gotify(context.Background(), s.GotifyURL, s.GotifyToken, n.pushMessage())
+		},
+	},
+	{
+		name:       "pushover",
+		configured: func(s *Settings) bool { return s.PushoverUserKey != "" },
+		failures:   func(s *Settings) bool { return true },
+		send: func(s *Settings, n Notification) error {
+			return push.Pushover(context.Background(), s.PushoverUserKey, s.PushoverToken, n.pushMessage())
+		},
+	},
+}
+
+func (n Notification) pushMessage() push.Message {
+	return push.Message{Title: n.Title, Body: n.Message, Urgent: n.Urgent}
+}
+
+// NotificationTestResult is the outcome of a test notification on a
+// channel.
+type NotificationTestResult struct {
+	Channel string `json:"channel"`
+	Error   string `json:"error,omitempty"`
+}
+
+// notifyOperation notifies the channels taking failures of a pipeline
+// failure or staleness recorded on the repository at repoPath.
+func notifyOperation(repoPath string, op Operation) {
+	if op.Type == "stale" {
+		notifyFailureChannels(Notification{
+			Title:   fmt.Sprintf("GitWatcher: %s is stale", filepath.Base(repoPath)),
+			Message: fmt.Sprintf("%s: %s\n", repoPath, op.Message),
+		}, repoPath)
+		return
+	}
+	if op.Type != "error" {
+		return
+	}
+	step := op.Step
+	if step == "" {
+		step = "sync"
+	}
+	n := Notification{
+		Title:   fmt.Sprintf("GitWatcher: %s failed on %s", step, filepath.Base(repoPath)),
+		Message: fmt.Sprintf("The %s step failed on %s at %s:\n\n%s\n", step, repoPath, op.Timestamp.Format(time.RFC1123), op.Error),
+		Urgent:  true,
+	}
+	notifyFailureChannels(n, repoPath)
+}
+
+// notifyFailureChannels sends n through the channels taking failures, in the
+// background. repoPath is the repository it is about, if a single one.
+func notifyFailureChannels(n Notification, repoPath string) {
+	state.mu.RLock()
+	settings := state.Settings
+	state.mu.RUnlock()
+	for _, channel := range notificationChannels {
+		if !channel.configured(&settings) || !channel.failures(&settings) {
+			continue
+		}
+		go func(channel notificationChannel) {
+			if err := channel.send(&settings, n); err != nil {
+				slog.Warn("Error sending notification", "channel", channel.name, "repo", repoPath, "error", err)
+			}
+		}(channel)
+	}
+}
+
+// handleTestNotifications sends a test notification through every
+// configured channel and reports how each went.
+func handleTestNotifications(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	settings := state.Settings
+	state.mu.RUnlock()
+
+	n := Notification{
+		Title:   "GitWatcher test notification",
+		Message: "Notifications from GitWatcher reach you through this channel.\n",
+	}
+	results := []NotificationTestResult{}
+	for _, channel := range notificationChannels {
+		if !channel.configured(&settings) {
+			continue
+		}
+		result := NotificationTestResult{Channel: channel.name}
+		if err := channel.send(&settings, n); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		apiError(w, "No notification channel is configured", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+// sendEmail mails n to the EmailTo recipients, unless air-gapped mode
+// leaves the SMTP server out.
+func sendEmail(s *Settings, n Notification) error {
+	if !s.airGapAllows(airGapSMTP) {
+		return gitops.ErrAirGapped
+	}
+	server := mailer.Server{Host: s.SMTPHost, Port: s.SMTPPort, Username: s.SMTPUsername, Password: s.SMTPPassword}
+	return mailer.Send(server, mailer.Message{From: s.EmailFrom, To: s.EmailTo, Subject: n.Title, Body: n.Message})
+}
+
+// The services airGappedAllow can keep enabled in air-gapped mode.
+const (
+	airGapSMTP = "smtp"
+	airGapMQTT = "mqtt"
+)
+
+// airGapAllows reports whether service may be contacted: always, unless
+// air-gapped mode is on and airGappedAllow leaves it out.
+func (s *Settings) airGapAllows(service string) bool {
+	return !gitops.AirGapped() || slices.Contains(s.AirGappedAllow, service)
+}
+
+// validateAirGap checks the airGappedAllow setting.
+func (s *Settings) validateAirGap() error {
+	for _, service := range s.AirGappedAllow {
+		if service != airGapSMTP && service != airGapMQTT {
+			return fmt.Errorf("Invalid airGappedAllow service %s, it must be smtp or mqtt", service)
+		}
+	}
+	return nil
+}
+
+// validatePush checks the settings of the push channels.
+func (s *Settings) validatePush() error {
+	for _, service := range []struct{ name, url string }{{"ntfy", s.NtfyURL}, {"Gotify", s.GotifyURL}} {
+		if service.url == "" {
+			continue
+		}
+		if u, err := url.Parse(service.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid %s URL", service.name)
+		}
+	}
+	if s.GotifyURL != "" && s.GotifyToken == "" {
+		return fmt.Errorf("Gotify needs an application token")
+	}
+	if s.PushoverUserKey != "" && s.PushoverToken == "" {
+		return fmt.Errorf("Pushover needs an application token")
+	}
+	return nil
+}
+
+// validateEmail checks the email settings, which need a sender and a
+// recipient once an SMTP server is set.
+func (s *Settings) validateEmail() error {
+	if s.DigestSchedule != "" {
+		if err := scheduler.ValidateSchedule(s.DigestSchedule); err != nil {
+			return fmt.Errorf("Invalid digest schedule: %v", err)
+		}
+	}
+	if s.SMTPHost == "" {
+		if s.EmailFailures || s.DigestSchedule != "" {
+			return fmt.Errorf("Email notifications need an SMTP host")
+		}
+		return nil
+	}
+	if s.SMTPPort < 0 || s.SMTPPort > 65535 {
+		return fmt.Errorf("Invalid SMTP port %d", s.SMTPPort)
+	}
+	if _, err := mail.ParseAddress(s.EmailFrom); err != nil {
+		return fmt.Errorf("Invalid email sender %q: %v", s.EmailFrom, err)
+	}
+	if len(s.EmailTo) == 0 {
+		return fmt.Errorf("Email notifications need a recipient")
+	}
+	for _, to := range s.EmailTo {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("Invalid email recipient %q: %v", to, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+const (
+	sessionCookie    = "gitwatcher_session"
+	oauthStateCookie = "gitwatcher_oauth_state"
+	sessionTTL       = 7 * 24 * time.Hour
+	// oauthScope lets the login token open PRs and releases
+	oauthScope = "repo"
+)
+
+// Session is a user signed in through GitHub.
+type Session struct {
+	Login   string
+	Token   string
+	Expires time.Time
+}
+
+var sessions = struct {
+	mu sync.Mutex
+	m  map[string]*Session
+}{m: make(map[string]*Session)}
+
+type sessionKey struct{}
+
+// oauthEnabled reports whether the GitHub OAuth app is configured.
+func oauthEnabled() bool {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.Settings.GitHubClientID != "" && state.Settings.GitHubClientSecret != ""
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestSession returns the valid session of the request's cookie, if any.
+func requestSession(r *http.Request) *Session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	session, exists := sessions.m[cookie.Value]
+	if !exists {
+		return nil
+	}
+	if time.Now().After(session.Expires) {
+		delete(sessions.m, cookie.Value)
+		return nil
+	}
+	return session
+}
+
+// contextUser returns the GitHub login of the user behind ctx, empty for
+// API tokens and scheduled tasks.
+func contextUser(ctx context.Context) string {
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		return session.Login
+	}
+	return ""
+}
+
+// githubToken returns the token GitHub calls made for ctx use: the signed in
+// user's own token, else the configured token, else for a user's settings
+// their latest login's token.
+func (s *Settings) githubToken(ctx context.Context) string {
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok && session.Token != "" {
+		return session.Token
+	}
+	if s.GitHubToken != "" {
+		return s.GitHubToken
+	}
+	return s.GitHubOAuthToken
+}
+
+func handleGitHubLogin(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	clientID := state.Settings.GitHubClientID
+	state.mu.RUnlock()
+	if !oauthEnabled() {
+		http.Error(w, "GitHub login is not configured", http.StatusNotFound)
+		return
+	}
+	if gitops.AirGapped() {
+		http.Error(w, "GitHub login is unavailable in air-gapped mode", http.StatusServiceUnavailable)
+		return
+	}
+	state.mu.RLock()
+	restricted := len(state.Settings.AllowedLogins) > 0 || len(state.Settings.AllowedOrgs) > 0
+	state.mu.RUnlock()
+	if !restricted {
+		http.Error(w, "GitHub login needs the allowedLogins or allowedOrgs setting", http.StatusForbidden)
+		return
+	}
+
+	oauthState, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    oauthState,
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	params := url.Values{
+		"client_id":    {clientID},
+		"redirect_uri": {callbackURL(r)},
+		"scope":        {oauthScope},
+		"state":        {oauthState},
+	}
+	http.Redirect(w, r, "https://github.com/login/oauth/authorize?"+params.Encode(), http.StatusFound)
+}
+
+func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || cookie.Value == "" || cookie.Value != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid OAuth state, please sign in again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/", MaxAge: -1})
+
+	token, err := exchangeOAuthCode(r.URL.Query().Get("code"), callbackURL(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "GitHub login failed", "error", err)
+		http.Error(w, fmt.Sprintf("GitHub login failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	login, err := githubLogin(token)
+	if err != nil {
+		slog.WarnContext(r.Context(), "GitHub login failed", "error", err)
+		http.Error(w, fmt.Sprintf("GitHub login failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	allowed, err := loginAllowed(token, login)
+	if err != nil {
+		slog.WarnContext(r.Context(), "GitHub login failed", "user", login, "error", err)
+		http.Error(w, fmt.Sprintf("GitHub login failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	if !allowed {
+		slog.WarnContext(r.Context(), "Refused GitHub login", "user", login)
+		recordAudit(AuditEntry{Actor: login, Action: "login", Status: http.StatusForbidden})
+		http.Error(w, fmt.Sprintf("The GitHub account %s is not allowed to sign in", login), http.StatusForbidden)
+		return
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sessions.mu.Lock()
+	sessions.m[id] = &Session{Login: login, Token: token, Expires: time.Now().Add(sessionTTL)}
+	sessions.mu.Unlock()
+
+	// Scheduled tasks have no user, those of the user's repositories use
+	// their latest login's token when they configured none. Shared
+	// repositories need the configured token.
+	state.mu.Lock()
+	settings, exists := state.UserSettings[login]
+	if !exists {
+		own := state.ownSettings(login)
+		settings = &own
+		state.UserSettings[login] = settings
+	}
+	settings.GitHubOAuthToken = token
+	state.mu.Unlock()
+	if err := saveConfig(); err != nil {
+		slog.ErrorContext(r.Context(), "Error saving config", "error", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	slog.InfoContext(r.Context(), "Signed in through GitHub", "user", login)
+	recordAudit(AuditEntry{Actor: login, Action: "login"})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessions.mu.Lock()
+		delete(sessions.m, cookie.Value)
+		sessions.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func callbackURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/auth/github/callback"
+}
+
+// exchangeOAuthCode trades the authorization code for an access token.
+func exchangeOAuthCode(code string, redirectURI string) (string, error) {
+	state.mu.RLock()
+	params := url.Values{
+		"client_id":     {state.Settings.GitHubClientID},
+		"client_secret": {state.Settings.GitHubClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+	}
+	state.mu.RUnlock()
+
+	req, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding token response: %v", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("%s: %s", result.Error, result.ErrorDescription)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token in response")
+	}
+	return result.AccessToken, nil
+}
+
+// githubLogin returns the login of the user token belongs to.
+func githubLogin(token string) (string, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error getting user: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error getting user: GitHub API returned %d", resp.StatusCode)
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", fmt.Errorf("error decoding user: %v", err)
+	}
+	return user.Login, nil
+}
+
+// loginAllowed reports whether login is in the allowedLogins setting or a
+// member of one of the allowedOrgs. Memberships are looked up with the
+// user's own token, which sees their private memberships too.
+func loginAllowed(token, login string) (bool, error) {
+	state.mu.RLock()
+	logins, orgs := state.Settings.AllowedLogins, state.Settings.AllowedOrgs
+	state.mu.RUnlock()
+
+	for _, allowed := range logins {
+		if strings.EqualFold(strings.TrimSpace(allowed), login) {
+			return true, nil
+		}
+	}
+	for _, org := range orgs {
+		member, err := githubOrgMember(token, strings.TrimSpace(org), login)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// githubOrgMember reports whether login is a member of org.
+func githubOrgMember(token, org, login string) (bool, error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/orgs/"+url.PathEscape(org)+"/members/"+url.PathEscape(login), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error checking membership of %s: %v", org, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		// Non-members are also redirected to the public members, which
+		// answer 404 for them
+		return false, nil
+	}
+	return false, fmt.Errorf("error checking membership of %s: GitHub API returned %d", org, resp.StatusCode)
+}
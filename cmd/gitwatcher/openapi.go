@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/graphql"
+	"gitwatcher/internal/scheduler"
+
+	"github.com/gorilla/mux"
+)
+
+// apiOperation documents one API route for the OpenAPI document.
+type apiOperation struct {
+	summary string
+	query   []string
+	// body and response are values of the types sent and returned as JSON,
+	// nil when there are none
+	body     interface{}
+	response interface{}
+	// stream marks Server-Sent Events endpoints
+	stream bool
+	// created marks endpoints answering 201 without a body
+	created bool
+}
+
+// RepoPathRequest is the body of the operations that only take a repository.
+type RepoPathRequest struct {
+	Path string `json:"path"`
+}
+
+// apiOperations documents the routes added by registerAPI, keyed by method
+// and path template relative to the API prefix.
+var apiOperations = map[string]apiOperation{
+	"GET /repositories": {summary: "List a page of the watched repositories, filtered by path substring, group, tag or status (dirty, clean, error, stale, missing) and sorted by path, lastSync or lastActivity (- to reverse)",
+		query: []string{"name", "group", "tag", "status", "sort", "offset", "limit"}, response: RepositoryPage{}},
+	"POST /repositories": {summary: "Watch a repository",
+		body: Repository{}, created: true},
+	"POST /repositories/bulk": {summary: "Watch many repositories, from a JSON array or a text/plain list of paths with optional group and tags, reporting each one",
+		query: []string{"group", "tags"}, body: []Repository{}, response: BulkAddResponse{}},
+	"POST /repositories/sync-all": {summary: "Start running the pipeline of every repository, optionally only those of a group or with a tag; poll the job it returns",
+		query: []string{"group", "tag"}, response: SyncJob{}},
+	"GET /jobs/{id}": {summary: "Return the progress of a sync job",
+		response: SyncJob{}},
+	"GET /repositories/discover": {summary: "List the git repositories under a directory, to add them in bulk",
+		query: []string{"root", "depth"}, response: []DiscoveredRepository{}},
+	"GET /repositories/detail": {summary: "Return the status, schedule, next run, recent history and open PRs of a repository",
+		query: []string{"path", "history"}, response: RepositoryDetail{}},
+	"POST /repositories/update": {summary: "Fetch a repository and refresh its status",
+		body: RepoPathRequest{}, response: gitops.RepoStatus{}},
+	"POST /repositories/commit": {summary: "Commit the changes of a repository with an AI message",
+		body: RepoPathRequest{}, response: gitops.RepoStatus{}},
+	"POST /repositories/push": {summary: "Push a repository",
+		body: RepoPathRequest{}},
+	"POST /repositories/pr": {summary: "Open a PR for the branch of a repository; stream=true streams its generation",
+		query: []string{"stream"}, body: RepoPathRequest{}, response: PRResult{}},
+	"POST /repositories/remote": {summary: "Add a remote to a repository",
+		body: struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		}{}, response: gitops.RepoStatus{}},
+	"POST /repositories/preview-message": {summary: "Preview the commit message, and with pr the PR draft, without committing",
+		body: struct {
+			Path string `json:"path"`
+			PR   bool   `json:"pr"`
+		}{}, response: gitops.MessagePreview{}},
+	"POST /repositories/tag": {summary: "Create an annotated tag on HEAD, optionally pushing it and publishing a release",
+		body: struct {
+			Path    string `json:"path"`
+			Tag     string `json:"tag"`
+			Message string `json:"message"`
+			Push    bool   `json:"push"`
+			Release bool   `json:"release"`
+		}{}, response: TagResult{}},
+	"GET /repositories/version": {summary: "Propose the next semantic version of a repository",
+		query: []string{"path"}, response: gitops.VersionSuggestion{}},
+	"GET /repositories/settings": {summary: "List the settings that apply to a repository with their source",
+		query: []string{"path"}, response: []ResolvedSetting{}},
+	"GET /repositories/prompt": {summary: "Return the commit message prompt for the current changes",
+		query: []string{"path"}, response: gitops.PromptPreview{}},
+	"POST /repositories/options": {summary: "Set the group, tags, schedule and options of a repository",
+		body: struct {
+			Path     string   `json:"path"`
+			Group    string   `json:"group"`
+			Schedule *string  `json:"schedule,omitempty"`
+			Tags     []string `json:"tags"`
+			RepoOptions
+		}{}, response: Repository{}},
+	"POST /repositories/move": {summary: "Re-key a repository after its working tree was moved on disk, keeping its history",
+		body: MoveRepositoryRequest{}},
+	"GET /repositories/logs": {summary: "Stream the log lines of a repository as log events",
+		query: []string{"path"}, response: LogLine{}, stream: true},
+	"GET /repositories/{path}/activity": {summary: "List the operations of a repository, newest first",
+		query: []string{"type", "before", "limit"}, response: []Operation{}},
+	"GET /activity": {summary: "List the operations of every repository, newest first",
+		query: []string{"before", "limit", "type"}, response: ActivityFeed{}},
+	"GET /events": {summary: "Stream repository events whenever a repository changes",
+		response: Repository{}, stream: true},
+	"GET /repositories/pending-pr": {summary: "Return the PR draft awaiting approval",
+		query: []string{"path"}, response: PendingPR{}},
+	"POST /repositories/pending-pr": {summary: "Edit the PR draft awaiting approval",
+		body: struct {
+			Path  string  `json:"path"`
+			Title *string `json:"title"`
+			Body  *string `json:"body"`
+		}{}, response: PendingPR{}},
+	"POST /repositories/pending-pr/approve": {summary: "Open the PR awaiting approval",
+		body: RepoPathRequest{}, response: PRResult{}},
+	"POST /repositories/pending-pr/reject": {summary: "Discard the PR draft awaiting approval",
+		body: RepoPathRequest{}},
+	"GET /groups": {summary: "List the repository groups, keyed by name",
+		response: map[string]*RepoGroup{}},
+	"POST /groups": {summary: "Create or replace a repository group",
+		body: RepoGroup{}, response: RepoGroup{}},
+	"POST /groups/delete": {summary: "Delete an empty repository group",
+		body: struct {
+			Name string `json:"name"`
+		}{}},
+	"GET /settings": {summary: "Return the settings",
+		response: Settings{}},
+	"POST /settings": {summary: "Update the settings; preview=true only lists the changes, confirm=true allows dangerous ones",
+		query: []string{"preview", "confirm"}, body: Settings{}, response: SettingsUpdateResponse{}},
+	"POST /notifications/test": {summary: "Send a test notification through every configured channel",
+		response: []NotificationTestResult{}},
+	"GET /gemini/models": {summary: "List the Gemini models",
+		response: []string{}},
+	"GET /openai/models": {summary: "List the OpenAI models",
+		response: []string{}},
+	"GET /ollama/models": {summary: "List the models installed on the Ollama server",
+		response: []string{}},
+	"GET /reports/unpushed": {summary: "Report the local commits that exist on no remote",
+		query: []string{"refresh"}, response: UnpushedReport{}},
+	"GET /stats": {summary: "Aggregate the operation history per repository",
+		query: []string{"from", "to"}, response: Stats{}},
+	"GET /stats/ai": {summary: "Report the AI token usage per repository and day",
+		query: []string{"path"}, response: AIStats{}},
+	"GET /audit": {summary: "List the audit log entries, newest first",
+		query: []string{"repo", "actor", "action", "since", "limit"}, response: []AuditEntry{}},
+	"GET /scheduler/tasks": {summary: "List the scheduled tasks with their next and last run",
+		response: []scheduler.TaskInfo{}},
+	"GET /admin/backup": {summary: "Download a tar.gz of the config, history and audit log; bundles=true adds git bundles of the repositories",
+		query: []string{"bundles"}},
+	"POST /admin/restore": {summary: "Restore a backup sent as the tar.gz body, cloning missing repositories from their bundle",
+		response: RestoreResult{}},
+	"GET /admin/read-only": {summary: "Return whether read-only mode is enabled",
+		response: ReadOnlyState{}},
+	"POST /admin/read-only": {summary: "Enable or disable read-only mode",
+		body: ReadOnlyState{}, response: ReadOnlyState{}},
+	"GET /graphql": {summary: "Run a GraphQL query over repositories, history, groups, activity and settings",
+		query: []string{"query", "operationName", "variables"}, response: graphql.Response{}},
+	"POST /graphql": {summary: "Run a GraphQL query over repositories, history, groups, activity and settings",
+		body: graphql.Request{}, response: graphql.Response{}},
+	"GET /openapi.json": {summary: "Return this document"},
+	"GET /docs":         {summary: "Browse this document in Swagger UI"},
+}
+
+// openAPIDocument is built once the routes are registered.
+var openAPIDocument []byte
+
+// pathVariable matches the variables of mux path templates, whose regexp
+// OpenAPI does not allow.
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// initOpenAPI builds the OpenAPI document describing the routes of api.
+func initOpenAPI(api *mux.Router) error {
+	schemas := map[string]interface{}{
+		"APIError": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"error": schemaFor(reflect.TypeOf(APIError{}), nil),
+			},
+		},
+	}
+	paths := map[string]map[string]interface{}{}
+
+	err := api.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := pathVariable.ReplaceAllString(strings.TrimPrefix(tmpl, apiPrefix), "{$1}")
+		for _, method := range methods {
+			op, documented := apiOperations[method+" "+path]
+			if !documented {
+				slog.Warn("API route missing from the OpenAPI document", "method", method, "path", path)
+			}
+			if paths[path] == nil {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(method)] = op.document(path, schemas)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	openAPIDocument, err = json.Marshal(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "GitWatcher API",
+			"version":     "v1",
+			"description": "Errors are returned as {\"error\": {\"code\", \"message\", \"details\"}}.",
+		},
+		"servers": []map[string]string{{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string][]string{{"bearerAuth": {}}},
+	})
+	return err
+}
+
+// document returns the OpenAPI operation object of op, adding the schemas it
+// refers to.
+func (op apiOperation) document(path string, schemas map[string]interface{}) map[string]interface{} {
+	var params []map[string]interface{}
+	for _, match := range pathVariable.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true,
+			"schema": map[string]string{"type": "string"},
+		})
+	}
+	for _, name := range op.query {
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query",
+			"schema": map[string]string{"type": "string"},
+		})
+	}
+
+	doc := map[string]interface{}{"summary": op.summary}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+	if op.body != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(op.body), schemas)},
+			},
+		}
+	}
+
+	success := map[string]interface{}{"description": "OK"}
+	status := "200"
+	if op.created {
+		status = "201"
+		success["description"] = "Created"
+	}
+	if op.response != nil {
+		contentType := "application/json"
+		if op.stream {
+			contentType = "text/event-stream"
+			success["description"] = "Server-Sent Events whose data is the schema"
+		}
+		success["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": schemaFor(reflect.TypeOf(op.response), schemas)},
+		}
+	}
+	doc["responses"] = map[string]interface{}{
+		status: success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]string{"$ref": "#/components/schemas/APIError"},
+				},
+			},
+		},
+	}
+	return doc
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema of values of t as encoding/json writes
+// them. Named structs are added to schemas and referenced, unless schemas is
+// nil.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" || schemas == nil {
+			return structSchema(t, schemas)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, exists := schemas[t.Name()]; !exists {
+			// Reserve the name first so recursive types terminate
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return ref
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		if t.Kind() == reflect.Int64 && t.PkgPath() == "time" {
+			// time.Duration
+			return map[string]interface{}{"type": "integer", "description": "nanoseconds"}
+		}
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema lists the JSON fields of t, flattening embedded structs.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaFor(field.Type, schemas)
+		}
+	}
+	addFields(t)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// handleOpenAPI returns the OpenAPI document of the API.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+var swaggerUITemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>GitWatcher API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+        SwaggerUIBundle({url: {{.}}, dom_id: '#swagger-ui'});
+    </script>
+</body>
+</html>
+`))
+
+// handleAPIDocs serves Swagger UI on the OpenAPI document. It loads from a
+// CDN, so it needs internet access unlike the rest of the app.
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	swaggerUITemplate.Execute(w, apiPrefix+"/openapi.json")
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// configDir is where the config and audit log are kept by default:
+// $XDG_CONFIG_HOME/gitwatcher, or ~/.config/gitwatcher when it is not set.
+func configDir() (string, error) {
+	// The XDG spec says relative paths are invalid and must be ignored
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "gitwatcher"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "gitwatcher"), nil
+}
+
+// serviceContext is ctx outside of Windows services.
+func serviceContext(ctx context.Context, stop context.CancelFunc) (context.Context, func()) {
+	return ctx, stop
+}
+
+// serviceLogHandler is nil outside of Windows services.
+func serviceLogHandler(opts *slog.HandlerOptions) (slog.Handler, error) {
+	return nil, nil
+}
+
+func controlService(command string, args []string) error {
+	return fmt.Errorf("-service is only supported on Windows")
+}
@@ -0,0 +1,226 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is both the name of the Windows service and the source of its
+// event log entries.
+const serviceName = "GitWatcher"
+
+// configDir is where the config and audit log are kept by default:
+// %APPDATA%\gitwatcher.
+// A service running as LocalSystem uses the AppData of the system profile.
+func configDir() (string, error) {
+	appData, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appData, "gitwatcher"), nil
+}
+
+func isService() bool {
+	service, err := svc.IsWindowsService()
+	return err == nil && service
+}
+
+// serviceHandler reports the service running and cancels the shutdown
+// context when the service manager asks it to stop.
+type serviceHandler struct {
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32((shutdownTimeout + 5*time.Second) / time.Millisecond)}
+				h.cancel()
+				<-h.stopped
+				return false, 0
+			}
+		case <-h.stopped:
+			// Shut down without a stop request
+			return false, 0
+		}
+	}
+}
+
+// serviceContext extends ctx to be cancelled when the service manager stops
+// the service. The returned function must be called once shut down, so the
+// service is reported stopped only after the state is saved.
+func serviceContext(ctx context.Context, stop context.CancelFunc) (context.Context, func()) {
+	if !isService() {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	handler := &serviceHandler{cancel: cancel, stopped: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := svc.Run(serviceName, handler); err != nil {
+			slog.Error("Error running as a Windows service", "error", err)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		stop()
+		close(handler.stopped)
+		<-done
+	}
+}
+
+// eventLogHandler writes log records to the Windows event log, formatted as
+// key=value pairs after the message.
+type eventLogHandler struct {
+	log    *eventlog.Log
+	level  slog.Leveler
+	attrs  []string
+	prefix string
+}
+
+// serviceLogHandler returns an event log handler when running as a service,
+// which has no console to write to, and nil otherwise.
+func serviceLogHandler(opts *slog.HandlerOptions) (slog.Handler, error) {
+	if !isService() {
+		return nil, nil
+	}
+	log, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the event log: %v", err)
+	}
+	return &eventLogHandler{log: log, level: opts.Level}, nil
+}
+
+func (h *eventLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	min := slog.LevelInfo
+	if h.level != nil {
+		min = h.level.Level()
+	}
+	return level >= min
+}
+
+func (h *eventLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	parts := append([]string{r.Message}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		parts = append(parts, formatAttr(h.prefix, a)...)
+		return true
+	})
+	msg := strings.Join(parts, " ")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.log.Error(1, msg)
+	case r.Level >= slog.LevelWarn:
+		return h.log.Warning(1, msg)
+	}
+	return h.log.Info(1, msg)
+}
+
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]string(nil), h.attrs...)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, formatAttr(h.prefix, a)...)
+	}
+	return &clone
+}
+
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func formatAttr(prefix string, a slog.Attr) []string {
+	value := a.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		var parts []string
+		for _, member := range value.Group() {
+			parts = append(parts, formatAttr(prefix+a.Key+".", member)...)
+		}
+		return parts
+	}
+	if a.Key == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s%s=%q", prefix, a.Key, value.String())}
+}
+
+// controlService installs, uninstalls, starts or stops the Windows service.
+// args are passed to the service on every start.
+func controlService(command string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	if command == "install" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "GitWatcher",
+			Description: "Commits and pushes changes to git repositories on a schedule",
+			StartType:   mgr.StartAutomatic,
+		}, args...)
+		if err != nil {
+			return fmt.Errorf("error installing service: %v", err)
+		}
+		defer s.Close()
+		if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+			s.Delete()
+			return fmt.Errorf("error registering the event log source: %v", err)
+		}
+		fmt.Printf("Installed service %s\n", serviceName)
+		return nil
+	}
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("error opening service %s: %v", serviceName, err)
+	}
+	defer s.Close()
+	switch command {
+	case "uninstall":
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("error uninstalling service: %v", err)
+		}
+		if err := eventlog.Remove(serviceName); err != nil {
+			return fmt.Errorf("error removing the event log source: %v", err)
+		}
+		fmt.Printf("Uninstalled service %s\n", serviceName)
+	case "start":
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("error starting service: %v", err)
+		}
+	case "stop":
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("error stopping service: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown service command %q, expected install, uninstall, start or stop", command)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log/slog"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+)
+
+// registerPprof serves the runtime profiles under /debug/pprof/ to admins.
+func registerPprof(r *mux.Router) {
+	debug := r.PathPrefix("/debug/pprof").Subrouter()
+	debug.HandleFunc("/cmdline", requireAdmin(pprof.Cmdline))
+	debug.HandleFunc("/profile", requireAdmin(pprof.Profile))
+	debug.HandleFunc("/symbol", requireAdmin(pprof.Symbol))
+	debug.HandleFunc("/trace", requireAdmin(pprof.Trace))
+	// Index also serves the named profiles such as heap and goroutine
+	debug.PathPrefix("/").HandlerFunc(requireAdmin(pprof.Index))
+	slog.Info("Profiling endpoints enabled under /debug/pprof/")
+}
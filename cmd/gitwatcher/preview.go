@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"gitwatcher/internal/gitops"
+)
+
+// handlePreviewMessage generates the commit message, and optionally the PR,
+// GitWatcher would create for a repository without committing anything.
+func handlePreviewMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+		PR   bool   `json:"pr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	absPath, err := filepath.Abs(req.Path)
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	preview, err := gitops.PreviewCommitMessage(absPath, opts.AIService(&settings).WithContext(r.Context()),
+		opts.CommitOptions(), opts.PROptions(&settings), req.PR)
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error generating preview: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(preview)
+}
+
+// handlePromptPreview returns the prompt that would be sent to the AI for
+// the current changes of a repository.
+func handlePromptPreview(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs(r.URL.Query().Get("path"))
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	preview, err := gitops.PreviewPrompt(absPath, opts.AIService(&settings), opts.CommitOptions())
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error building prompt: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(preview)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"gitwatcher/internal/gitops"
+)
+
+// readOnly refuses every mutating git operation and settings change while set.
+var readOnly atomic.Bool
+
+const readOnlyMessage = "GitWatcher is in read-only mode, mutating operations are disabled"
+
+// initReadOnly enables read-only mode when requested by flag or by the
+// GITWATCHER_READ_ONLY environment variable.
+func initReadOnly(flagValue bool) {
+	enabled := flagValue
+	if env := os.Getenv("GITWATCHER_READ_ONLY"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_READ_ONLY value", "value", env)
+		} else {
+			enabled = enabled || v
+		}
+	}
+	readOnly.Store(enabled)
+	if enabled {
+		slog.Info("Starting in read-only mode")
+	}
+}
+
+// initAirGapped enables air-gapped mode when requested by flag or by the
+// GITWATCHER_AIR_GAPPED environment variable. Only git remotes and the
+// Ollama server are contacted then; PRs are left to be opened by hand.
+func initAirGapped(flagValue bool) {
+	enabled := flagValue
+	if env := os.Getenv("GITWATCHER_AIR_GAPPED"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_AIR_GAPPED value", "value", env)
+		} else {
+			enabled = enabled || v
+		}
+	}
+	gitops.SetAirGapped(enabled)
+	if enabled {
+		slog.Info("Starting in air-gapped mode: GitHub and cloud AI services are disabled")
+	}
+}
+
+// requireWritable wraps handlers that mutate repositories or settings.
+func requireWritable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly.Load() {
+			apiError(w, readOnlyMessage, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type ReadOnlyState struct {
+	Enabled bool `json:"enabled"`
+}
+
+func handleGetReadOnly(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(ReadOnlyState{Enabled: readOnly.Load()})
+}
+
+func handleSetReadOnly(w http.ResponseWriter, r *http.Request) {
+	var req ReadOnlyState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	readOnly.Store(req.Enabled)
+	slog.InfoContext(r.Context(), "Read-only mode changed", "enabled", req.Enabled, "user", contextUser(r.Context()))
+
+	json.NewEncoder(w).Encode(req)
+}
+
+// headlessMode reports whether to run without the HTTP server, from the
+// -no-web flag or the GITWATCHER_NO_WEB environment variable.
+func headlessMode(flagValue bool) bool {
+	if env := os.Getenv("GITWATCHER_NO_WEB"); env != "" {
+		v, err := strconv.ParseBool(env)
+		if err != nil {
+			slog.Warn("Ignoring invalid GITWATCHER_NO_WEB value", "value", env)
+		} else {
+			return flagValue || v
+		}
+	}
+	return flagValue
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"gitwatcher/internal/gitops"
+)
+
+type TagResult struct {
+	Tag        string `json:"tag"`
+	Pushed     bool   `json:"pushed"`
+	ReleaseURL string `json:"releaseUrl,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+// handleCreateTag creates an annotated tag on HEAD, optionally pushing it and
+// publishing a GitHub release with AI-generated notes.
+func handleCreateTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path    string `json:"path"`
+		Tag     string `json:"tag"`
+		Message string `json:"message"`
+		Push    bool   `json:"push"`
+		Release bool   `json:"release"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Tag == "" {
+		apiError(w, "Tag name is required", http.StatusBadRequest)
+		return
+	}
+
+	absPath, err := filepath.Abs(req.Path)
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	result := TagResult{Tag: req.Tag}
+
+	// Notes have to be generated before tagging, while HEAD is still ahead of
+	// the previous tag
+	if req.Release {
+		result.Notes, err = gitops.GenerateReleaseNotes(absPath, req.Tag, opts.AIService(&settings).WithContext(r.Context()))
+		if err != nil {
+			apiError(w, fmt.Sprintf("Error generating release notes: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := gitops.CreateTag(absPath, req.Tag, req.Message); err != nil {
+		apiError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordOperation(absPath, Operation{Type: "tag", Trigger: TriggerManual, User: contextUser(r.Context()), Title: req.Tag})
+
+	if req.Push || req.Release {
+		if err := gitops.PushTag(absPath, req.Tag, settings.SSHKeyPath); err != nil {
+			apiError(w, fmt.Sprintf("Error pushing tag: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result.Pushed = true
+	}
+
+	if req.Release {
+		release, err := gitops.CreateGitHubRelease(absPath, req.Tag, result.Notes, settings.githubToken(r.Context()))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating release", "repo", absPath, "operation", "release", "tag", req.Tag, "error", err)
+			apiError(w, fmt.Sprintf("Error creating release: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result.ReleaseURL = release.HTMLURL
+		recordOperation(absPath, Operation{Type: "release", Trigger: TriggerManual, User: contextUser(r.Context()), Title: req.Tag, URL: release.HTMLURL})
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleSuggestVersion proposes the next version for a repository so it can be
+// confirmed before calling handleCreateTag.
+func handleSuggestVersion(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs(r.URL.Query().Get("path"))
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	settings := repoSettings(absPath)
+	opts := repoOptions(absPath)
+
+	suggestion, err := gitops.SuggestVersion(absPath, opts.AIService(&settings).WithContext(r.Context()))
+	if err != nil {
+		apiError(w, fmt.Sprintf("Error suggesting version: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(suggestion)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// configReloadInterval is how often the config file is checked for edits.
+const configReloadInterval = 5 * time.Second
+
+// configDigest is the digest of the config file as last read or written, to
+// tell external edits from our own saves.
+var configDigest struct {
+	mu  sync.Mutex
+	sum [sha256.Size]byte
+}
+
+func rememberConfig(data []byte) {
+	configDigest.mu.Lock()
+	configDigest.sum = sha256.Sum256(data)
+	configDigest.mu.Unlock()
+}
+
+// watchConfig reloads the config file from the scheduler whenever it is
+// edited outside of GitWatcher.
+func watchConfig() {
+	state.scheduler.Heartbeat(configReloadInterval, func() {
+		if err := reloadConfig(); err != nil {
+			path, _ := configPath()
+			slog.Error("Error reloading the config file, keeping the running config", "file", path, "error", err)
+		}
+	})
+}
+
+// reloadConfig applies the config file when it changed: the settings and
+// groups are replaced, and repositories are added, removed or rescheduled
+// to match, keeping their history and status. Repositories are left alone
+// when a repositories file manages them.
+func reloadConfig() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	configDigest.mu.Lock()
+	unchanged := sum == configDigest.sum
+	// Remember failed versions too so they are reported once
+	configDigest.sum = sum
+	configDigest.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	config, substitutions, version, err := parseConfig(path, data)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	previous := state.substitutions
+	state.substitutions = substitutions
+	migrate, err := prepareSecrets(config)
+	if err != nil {
+		state.substitutions = previous
+		state.mu.Unlock()
+		return err
+	}
+
+	if err := overrideSettings(&config.Settings); err != nil {
+		state.substitutions = previous
+		state.mu.Unlock()
+		return err
+	}
+
+	changes := diffSettings(state.Settings, config.Settings)
+	auditScheduleChanged := config.Settings.UnpushedAuditSchedule != state.Settings.UnpushedAuditSchedule
+	state.Settings = config.Settings
+	state.UserSettings = config.UserSettings
+	state.Groups = config.Groups
+	state.updateSSHPassphrases()
+
+	var added, updated, removed []string
+	if reposFile.path == "" {
+		added, updated, removed = reconcileRepositories(config.Repositories)
+	}
+	// Group schedules may have changed as well as those of repositories
+	rescheduleRepositories()
+	state.mu.Unlock()
+
+	if auditScheduleChanged {
+		schedule := config.Settings.UnpushedAuditSchedule
+		if schedule == "" {
+			schedule = defaultUnpushedAuditSchedule
+		}
+		if err := state.scheduler.AddTask(unpushedAuditTask, schedule, runUnpushedAudit); err != nil {
+			slog.Error("Error scheduling unpushed commit audit", "error", err)
+		}
+	}
+	scheduleDigest()
+	configureMQTT()
+	for _, path := range added {
+		refreshRepoStatus(path)
+	}
+	for _, path := range append(append(added, updated...), removed...) {
+		notifyRepoChanged(path)
+	}
+
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	slog.Info("Reloaded the config file", "file", path, "settings", fields, "added", added, "updated", updated, "removed", removed)
+	if migrate || version < configVersion {
+		return saveConfig()
+	}
+	return nil
+}
+
+// prepareSecrets decrypts the secrets of a reloaded config or reads them
+// from the keyring, and reports whether some should be moved out of the
+// file. The caller must hold state.mu.
+func prepareSecrets(config *savedConfig) (bool, error) {
+	all := map[string]*Settings{"": &config.Settings}
+	for login, settings := range config.UserSettings {
+		all[login] = settings
+	}
+	migrate := false
+	for login, settings := range all {
+		plaintext, err := decryptSecrets(settings, login)
+		if err != nil {
+			return false, err
+		}
+		migrate = migrate || plaintext && secretBox != nil
+		if keyringEnabled {
+			plaintext, err := loadSecrets(settings, login)
+			if err != nil {
+				return false, fmt.Errorf("error reading secrets from the keyring: %v", err)
+			}
+			migrate = migrate || plaintext
+		}
+	}
+	return migrate, nil
+}
+
+// reconcileRepositories makes the watched repositories match those of a
+// reloaded config, leaving their schedules to rescheduleRepositories.
+// Existing repositories keep their history, status and pending PR. The
+// caller must hold state.mu.
+func reconcileRepositories(repos map[string]Repository) (added, updated, removed []string) {
+	for path := range state.Repositories {
+		if _, exists := repos[path]; !exists {
+			delete(state.Repositories, path)
+			state.scheduler.RemoveTask(path)
+			stopWatch(path)
+			removed = append(removed, path)
+		}
+	}
+	for path, repo := range repos {
+		current, exists := state.Repositories[path]
+		if !exists {
+			state.Repositories[path] = &Repository{
+				Path:        repo.Path,
+				Schedule:    repo.Schedule,
+				Group:       repo.Group,
+				Tags:        repo.Tags,
+				Owner:       repo.Owner,
+				RepoOptions: repo.RepoOptions,
+				StaleAfter:  repo.StaleAfter,
+				PendingPR:   repo.PendingPR,
+				History:     repo.History,
+				AIUsage:     repo.AIUsage,
+				RunState:    RunIdle,
+			}
+			added = append(added, path)
+		} else if !configEqual(current, &repo) {
+			current.Schedule = repo.Schedule
+			current.Group = repo.Group
+			current.Tags = repo.Tags
+			current.Owner = repo.Owner
+			current.StaleAfter = repo.StaleAfter
+			current.RepoOptions = repo.RepoOptions
+			updated = append(updated, path)
+		}
+	}
+	return added, updated, removed
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultRepositoryLimit is the page size of the repository list.
+const defaultRepositoryLimit = 100
+
+// RepositoryPage is a page of the repository list.
+type RepositoryPage struct {
+	Repositories []*Repository `json:"repositories"`
+	// Total counts the repositories matching the filters, on every page
+	Total int `json:"total"`
+	// Next is the offset of the next page, omitted on the last one
+	Next int `json:"next,omitempty"`
+}
+
+// repositoryStatuses match the repositories with a status filter.
+var repositoryStatuses = map[string]func(*Repository) bool{
+	"dirty":   func(repo *Repository) bool { return repo.Status != nil && repo.Status.HasChanges },
+	"clean":   func(repo *Repository) bool { return repo.Status != nil && !repo.Status.HasChanges },
+	"error":   func(repo *Repository) bool { return repo.LastError != "" },
+	"stale":   func(repo *Repository) bool { return repo.Stale },
+	"missing": func(repo *Repository) bool { return repo.Missing },
+}
+
+// repositorySortKeys order the repositories by a sort key, ascending.
+var repositorySortKeys = map[string]func(a, b *Repository) bool{
+	"path":         func(a, b *Repository) bool { return a.Path < b.Path },
+	"lastSync":     func(a, b *Repository) bool { return a.LastSync.Before(b.LastSync) },
+	"lastActivity": func(a, b *Repository) bool { return a.LastActivity.Before(b.LastActivity) },
+}
+
+// repositoryQuery is the filters, sort and page of a repository list.
+type repositoryQuery struct {
+	name, group, tag, status string
+	sort                     string
+	descending               bool
+	offset, limit            int
+}
+
+// parseRepositoryQuery reads the query parameters of the repository list.
+func parseRepositoryQuery(values url.Values) (repositoryQuery, FieldErrors) {
+	errs := FieldErrors{}
+	q := repositoryQuery{
+		name:   values.Get("name"),
+		group:  values.Get("group"),
+		tag:    values.Get("tag"),
+		status: values.Get("status"),
+		sort:   "path",
+		limit:  defaultRepositoryLimit,
+	}
+	if _, known := repositoryStatuses[q.status]; q.status != "" && !known {
+		errs.add("status", "must be dirty, clean, error, stale or missing")
+	}
+	if value := values.Get("sort"); value != "" {
+		q.sort = strings.TrimPrefix(value, "-")
+		q.descending = q.sort != value
+		if _, known := repositorySortKeys[q.sort]; !known {
+			errs.add("sort", "must be path, lastSync or lastActivity, with a - prefix to reverse it")
+		}
+	}
+	if value := values.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			errs.add("offset", "must be a positive integer")
+		}
+		q.offset = n
+	}
+	if value := values.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			errs.add("limit", "must be a positive integer")
+		}
+		q.limit = n
+	}
+	return q, errs
+}
+
+// page filters, sorts and pages repos. The caller must hold state.mu.
+func (q repositoryQuery) page(repos map[string]*Repository) RepositoryPage {
+	name := strings.ToLower(q.name)
+	matches := repositoryStatuses[q.status]
+	list := []*Repository{}
+	for path, repo := range filterRepositories(repos, q.group, q.tag) {
+		if name != "" && !strings.Contains(strings.ToLower(path), name) {
+			continue
+		}
+		if matches != nil && !matches(repo) {
+			continue
+		}
+		list = append(list, repo)
+	}
+
+	less := repositorySortKeys[q.sort]
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if q.descending {
+			a, b = b, a
+		}
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		}
+		// Keep pages stable when the sort key is equal
+		return list[i].Path < list[j].Path
+	})
+
+	page := RepositoryPage{Total: len(list), Repositories: []*Repository{}}
+	if q.offset < len(list) {
+		end := min(q.offset+q.limit, len(list))
+		page.Repositories = list[q.offset:end]
+		if end < len(list) {
+			page.Next = end
+		}
+	}
+	return page
+}
+
+// handleListRepositories returns a page of the visible repositories. name
+// keeps those whose path contains it, status those that are dirty, clean,
+// failing, stale or missing, and sort orders them by path, lastSync or lastActivity.
+func handleListRepositories(w http.ResponseWriter, r *http.Request) {
+	q, errs := parseRepositoryQuery(r.URL.Query())
+	if writeFieldErrors(w, errs) {
+		return
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	json.NewEncoder(w).Encode(q.page(userRepositories(contextUser(r.Context()))))
+}
+
+// handleListRepositoryMap is the repository list of the unversioned API: every
+// visible repository keyed by path, optionally only those of a group or with
+// a tag.
+func handleListRepositoryMap(w http.ResponseWriter, r *http.Request) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	repos := userRepositories(contextUser(r.Context()))
+	json.NewEncoder(w).Encode(filterRepositories(repos, r.URL.Query().Get("group"), r.URL.Query().Get("tag")))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recentLogLines is the number of log lines kept per repository for clients
+// that connect during an operation.
+const recentLogLines = 200
+
+// LogLine is a log record about one repository.
+type LogLine struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// repoLogs fans the log records carrying a repo field out to the clients
+// following that repository.
+var repoLogs = struct {
+	mu          sync.Mutex
+	recent      map[string][]LogLine
+	subscribers map[string]map[chan LogLine]struct{}
+}{
+	recent:      make(map[string][]LogLine),
+	subscribers: make(map[string]map[chan LogLine]struct{}),
+}
+
+func publishRepoLog(repo string, line LogLine) {
+	repoLogs.mu.Lock()
+	defer repoLogs.mu.Unlock()
+
+	recent := append(repoLogs.recent[repo], line)
+	if len(recent) > recentLogLines {
+		recent = recent[len(recent)-recentLogLines:]
+	}
+	repoLogs.recent[repo] = recent
+
+	for ch := range repoLogs.subscribers[repo] {
+		// Drop lines for clients that cannot keep up rather than blocking
+		// the operation that logs
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// subscribeRepoLogs returns the recent lines of repo and a channel receiving
+// the new ones until unsubscribe is called.
+func subscribeRepoLogs(repo string) (recent []LogLine, lines chan LogLine, unsubscribe func()) {
+	lines = make(chan LogLine, 64)
+
+	repoLogs.mu.Lock()
+	defer repoLogs.mu.Unlock()
+	recent = append(recent, repoLogs.recent[repo]...)
+	if repoLogs.subscribers[repo] == nil {
+		repoLogs.subscribers[repo] = make(map[chan LogLine]struct{})
+	}
+	repoLogs.subscribers[repo][lines] = struct{}{}
+
+	return recent, lines, func() {
+		repoLogs.mu.Lock()
+		defer repoLogs.mu.Unlock()
+		delete(repoLogs.subscribers[repo], lines)
+		if len(repoLogs.subscribers[repo]) == 0 {
+			delete(repoLogs.subscribers, repo)
+		}
+	}
+}
+
+// repoLogHandler passes records to next and publishes those that carry a
+// repo field, directly or through Logger.With.
+type repoLogHandler struct {
+	next   slog.Handler
+	repo   string
+	fields map[string]string
+}
+
+func newRepoLogHandler(next slog.Handler) slog.Handler {
+	return &repoLogHandler{next: next}
+}
+
+func (h *repoLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *repoLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	repo := h.repo
+	fields := make(map[string]string, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "repo" {
+			repo = a.Value.String()
+		} else {
+			fields[a.Key] = a.Value.String()
+		}
+		return true
+	})
+
+	if repo != "" {
+		publishRepoLog(repo, LogLine{Time: r.Time, Level: r.Level.String(), Message: r.Message, Fields: fields})
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *repoLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &repoLogHandler{next: h.next.WithAttrs(attrs), repo: h.repo, fields: make(map[string]string)}
+	for k, v := range h.fields {
+		clone.fields[k] = v
+	}
+	for _, a := range attrs {
+		if a.Key == "repo" {
+			clone.repo = a.Value.String()
+		} else {
+			clone.fields[a.Key] = a.Value.String()
+		}
+	}
+	return clone
+}
+
+func (h *repoLogHandler) WithGroup(name string) slog.Handler {
+	return &repoLogHandler{next: h.next.WithGroup(name), repo: h.repo, fields: h.fields}
+}
+
+// handleRepoLogs streams the log lines of a repository as Server-Sent
+// Events: a "log" event per line, starting with the recent ones.
+func handleRepoLogs(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs(r.URL.Query().Get("path"))
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	state.mu.RLock()
+	_, exists := state.Repositories[absPath]
+	state.mu.RUnlock()
+	if !exists {
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(line LogLine) {
+		payload, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: log\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+
+	recent, lines, unsubscribe := subscribeRepoLogs(absPath)
+	defer unsubscribe()
+
+	for _, line := range recent {
+		send(line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamsDone:
+			return
+		case line := <-lines:
+			send(line)
+		}
+	}
+}
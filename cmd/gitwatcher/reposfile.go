@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reposFileInterval is how often the repositories file is checked for changes.
+const reposFileInterval = 10 * time.Second
+
+// reposFile is the declarative list of repositories set with -repos-file or
+// GITWATCHER_REPOS_FILE. When set it is the source of truth: repositories
+// are added, updated and removed to match it and cannot be added or
+// reconfigured through the API.
+var reposFile struct {
+	path   string
+	mu     sync.Mutex
+	digest [sha256.Size]byte
+}
+
+// declaredRepository is an entry of the repositories file: the fields of a
+// repository that are configuration rather than state.
+type declaredRepository struct {
+	Path     string   `json:"path"`
+	Schedule string   `json:"schedule,omitempty"`
+	Group    string   `json:"group,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	RepoOptions
+	StaleAfter string `json:"staleAfter,omitempty"`
+}
+
+// parseReposFile reads the repositories of a YAML file such as
+//
+//	repositories:
+//	  - path: ~/notes
+//	    schedule: "*/15 * * * *"
+//	    autoMerge: true
+//
+// Keys are the JSON names of the repository fields. It fails on unknown keys
+// so typos are not silently ignored.
+func parseReposFile(data []byte) ([]declaredRepository, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	// Go through JSON to reuse the json tags of the options
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Repositories []declaredRepository `json:"repositories"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return file.Repositories, nil
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
+
+// initReposFile enables the repositories file when requested by flag or by
+// the GITWATCHER_REPOS_FILE environment variable, applies it and checks it
+// for changes from the scheduler.
+func initReposFile(flagValue string) error {
+	path := flagOrEnv(flagValue, "GITWATCHER_REPOS_FILE", "")
+	if path == "" {
+		return nil
+	}
+	absPath, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return err
+	}
+	reposFile.path = absPath
+	if err := reconcileReposFile(); err != nil {
+		return fmt.Errorf("error applying %s: %v", absPath, err)
+	}
+	slog.Info("Repositories are managed by the repositories file", "file", absPath)
+	state.scheduler.Heartbeat(reposFileInterval, func() {
+		if err := reconcileReposFile(); err != nil {
+			slog.Error("Error applying the repositories file, keeping the current repositories", "file", reposFile.path, "error", err)
+		}
+	})
+	return nil
+}
+
+// reconcileReposFile makes the repositories match the repositories file when
+// it changed since the last call. Nothing is applied unless every entry is
+// valid.
+func reconcileReposFile() error {
+	reposFile.mu.Lock()
+	defer reposFile.mu.Unlock()
+
+	data, err := os.ReadFile(reposFile.path)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	if digest == reposFile.digest {
+		return nil
+	}
+	// Remember failed versions too so they are reported once
+	reposFile.digest = digest
+
+	entries, err := parseReposFile(data)
+	if err != nil {
+		return err
+	}
+	declared := make(map[string]*Repository, len(entries))
+	for i, entry := range entries {
+		repo := &Repository{
+			Path:        absRequestPath(expandHome(entry.Path)),
+			Schedule:    entry.Schedule,
+			Group:       entry.Group,
+			Tags:        entry.Tags,
+			Owner:       entry.Owner,
+			RepoOptions: entry.RepoOptions,
+			StaleAfter:  entry.StaleAfter,
+			RunState:    RunIdle,
+		}
+		if err := validateRepository(repo).err(); err != nil {
+			return fmt.Errorf("repositories[%d]: %v", i, err)
+		}
+		if _, exists := declared[repo.Path]; exists {
+			return fmt.Errorf("repositories[%d]: %s is listed twice", i, repo.Path)
+		}
+		declared[repo.Path] = repo
+	}
+
+	var added, updated, removed []string
+	state.mu.Lock()
+	for path := range state.Repositories {
+		if _, exists := declared[path]; !exists {
+			delete(state.Repositories, path)
+			state.scheduler.RemoveTask(path)
+			stopWatch(path)
+			removed = append(removed, path)
+		}
+	}
+	for path, repo := range declared {
+		current, exists := state.Repositories[path]
+		if !exists {
+			state.Repositories[path] = repo
+			added = append(added, path)
+		} else if !configEqual(current, repo) {
+			current.Schedule = repo.Schedule
+			current.Group = repo.Group
+			current.Tags = repo.Tags
+			current.Owner = repo.Owner
+			current.StaleAfter = repo.StaleAfter
+			current.RepoOptions = repo.RepoOptions
+			updated = append(updated, path)
+		}
+	}
+	rescheduleRepositories()
+	state.mu.Unlock()
+
+	if len(added)+len(updated)+len(removed) == 0 {
+		return nil
+	}
+	// Status is read outside the lock, git can be slow on large repositories
+	for _, path := range added {
+		refreshRepoStatus(path)
+	}
+	for _, path := range append(append(added, updated...), removed...) {
+		notifyRepoChanged(path)
+	}
+	slog.Info("Applied the repositories file", "file", reposFile.path, "added", added, "updated", updated, "removed", removed)
+	return saveConfig()
+}
+
+// refreshRepoStatus refreshes the status of the repository at path.
+func refreshRepoStatus(path string) {
+	state.mu.RLock()
+	repo, exists := state.Repositories[path]
+	state.mu.RUnlock()
+	if !exists {
+		return
+	}
+	status, err := repoStatus(path)
+	if err != nil {
+		slog.Warn("Error getting repo status", "repo", path, "error", err)
+		return
+	}
+	state.mu.Lock()
+	repo.Status = status
+	state.mu.Unlock()
+}
+
+// configEqual reports whether a and b have the same configuration, ignoring
+// their state.
+func configEqual(a, b *Repository) bool {
+	return a.Schedule == b.Schedule && a.Group == b.Group && slices.Equal(a.Tags, b.Tags) &&
+		a.Owner == b.Owner && a.StaleAfter == b.StaleAfter && optionsEqual(a.RepoOptions, b.RepoOptions)
+}
+
+func optionsEqual(a, b RepoOptions) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+// requireRepoEditable wraps handlers that add or reconfigure repositories,
+// which the repositories file owns when it is set.
+func requireRepoEditable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if reposFile.path != "" {
+			apiError(w, fmt.Sprintf("Repositories are managed by %s, edit it instead", reposFile.path), http.StatusConflict)
+			return
+		}
+		next(w, r)
+	}
+}
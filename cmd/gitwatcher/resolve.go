@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Sources of a resolved setting, from the lowest to the highest precedence.
+const (
+	SourceDefault    = "default"
+	SourceInstance   = "instance"
+	SourceGroup      = "group"
+	SourceRepository = "repository"
+)
+
+// ResolvedSetting is the effective value of one setting of a repository and
+// the layer it comes from.
+type ResolvedSetting struct {
+	Field  string      `json:"field"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// Group names the group the value is inherited from
+	Group string `json:"group,omitempty"`
+}
+
+type settingsLayer struct {
+	source  string
+	options RepoOptions
+}
+
+// explainSettings lists every setting that applies to repo with its effective
+// value and source. The caller must hold state.mu.
+func explainSettings(repo *Repository) []ResolvedSetting {
+	var settings []ResolvedSetting
+
+	// Instance-only settings cannot be overridden
+	instance := reflect.ValueOf(state.settingsFor(repo.Path))
+	for i := 0; i < instance.NumField(); i++ {
+		field := jsonName(instance.Type().Field(i))
+		if field == "" || field == "defaults" {
+			continue
+		}
+		value := instance.Field(i).Interface()
+		if secretSettings[field] {
+			value = maskSecret(value)
+		}
+		settings = append(settings, ResolvedSetting{Field: field, Value: value, Source: SourceInstance})
+	}
+
+	layers := []settingsLayer{{SourceInstance, state.settingsFor(repo.Path).Defaults}}
+	if group, exists := state.Groups[repo.Group]; exists {
+		layers = append(layers, settingsLayer{SourceGroup, group.RepoOptions})
+	}
+	layers = append(layers, settingsLayer{SourceRepository, repo.RepoOptions})
+
+	t := reflect.TypeOf(RepoOptions{})
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		setting := ResolvedSetting{
+			Field:  jsonName(t.Field(i)),
+			Value:  reflect.Zero(ft).Interface(),
+			Source: SourceDefault,
+		}
+
+		// Mirrors RepoOptions.apply: set pointers, non-empty strings and
+		// non-nil slices override the lower layers
+		for _, layer := range layers {
+			v := reflect.ValueOf(layer.options).Field(i)
+			switch v.Kind() {
+			case reflect.Ptr, reflect.Slice:
+				if v.IsNil() {
+					continue
+				}
+			case reflect.String:
+				if v.String() == "" {
+					continue
+				}
+			}
+			if v.Kind() == reflect.Ptr {
+				v = v.Elem()
+			}
+			setting.Value = v.Interface()
+			setting.Source = layer.source
+			setting.Group = ""
+			if layer.source == SourceGroup {
+				setting.Group = repo.Group
+			}
+		}
+		settings = append(settings, setting)
+	}
+
+	schedule := ResolvedSetting{Field: "schedule", Value: repo.Schedule, Source: SourceRepository}
+	if repo.Schedule == "" {
+		schedule = ResolvedSetting{Field: "schedule", Value: effectiveSchedule(repo), Source: SourceGroup, Group: repo.Group}
+	}
+	settings = append(settings, schedule)
+
+	return settings
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func handleResolveSettings(w http.ResponseWriter, r *http.Request) {
+	absPath, err := filepath.Abs(r.URL.Query().Get("path"))
+	if err != nil {
+		apiError(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	repo, exists := state.Repositories[absPath]
+	if !exists {
+		apiError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(explainSettings(repo))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// RoleAdmin may add repositories, change settings and trigger git
+	// operations
+	RoleAdmin = "admin"
+	// RoleViewer may only view repository status
+	RoleViewer = "viewer"
+)
+
+// viewerTokenEnv overrides the viewerToken setting.
+const viewerTokenEnv = "GITWATCHER_VIEWER_TOKEN"
+
+type roleKey struct{}
+
+// validRole reports whether role is a known role, empty meaning the default.
+func validRole(role string) bool {
+	return role == "" || role == RoleAdmin || role == RoleViewer
+}
+
+// viewerToken returns the token granting read-only access, empty when there
+// is none.
+func viewerToken() string {
+	if token := os.Getenv(viewerTokenEnv); token != "" {
+		return token
+	}
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.Settings.ViewerToken
+}
+
+// userRole returns the role of a GitHub login: its entry in the roles
+// setting, else the default role, else the least privileged viewer.
+func userRole(login string) string {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if role, exists := state.Settings.Roles[login]; exists && role != "" {
+		return role
+	}
+	if state.Settings.DefaultRole != "" {
+		return state.Settings.DefaultRole
+	}
+	return RoleViewer
+}
+
+// withRole attaches role to the request context.
+func withRole(r *http.Request, role string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), roleKey{}, role))
+}
+
+// contextRole returns the role of the caller behind ctx. Requests made while
+// authentication is disabled and scheduled tasks are admins.
+func contextRole(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey{}).(string); ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// requireAdmin wraps handlers that only admins may call.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if role := contextRole(r.Context()); role != RoleAdmin {
+			apiError(w, fmt.Sprintf("Forbidden for the %s role", role), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validateRoles checks the roles settings.
+func (s *Settings) validateRoles() error {
+	if !validRole(s.DefaultRole) {
+		return fmt.Errorf("Invalid default role %s", s.DefaultRole)
+	}
+	for login, role := range s.Roles {
+		if !validRole(role) {
+			return fmt.Errorf("Invalid role %s for %s", role, login)
+		}
+	}
+	for _, login := range s.AllowedLogins {
+		if strings.TrimSpace(login) == "" {
+			return fmt.Errorf("Invalid allowed login, it is empty")
+		}
+	}
+	for _, org := range s.AllowedOrgs {
+		if strings.TrimSpace(org) == "" || strings.Contains(org, "/") {
+			return fmt.Errorf("Invalid allowed organization %q", org)
+		}
+	}
+	return nil
+}
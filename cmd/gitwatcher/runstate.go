@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Run states of a repository. Only running repositories have a step.
+const (
+	RunIdle    = "idle"
+	RunQueued  = "queued"
+	RunRunning = "running"
+	RunError   = "error"
+)
+
+// Steps of a run, from the pipeline or a manual action.
+const (
+	StepStatus = "status"
+	StepFetch  = "fetch"
+	StepCommit = "commit"
+	StepSquash = "squash"
+	StepPush   = "push"
+	StepChecks = "checks"
+	StepPR     = "pr"
+	StepTag    = "tag"
+)
+
+// errRepositoryBusy is returned when a repository is already running.
+var errRepositoryBusy = errors.New("the repository is busy")
+
+// beginRun marks the repository at path as running step, failing with
+// errRepositoryBusy when it already runs. Unknown paths are left to the
+// caller to report.
+func beginRun(path, step string) error {
+	state.mu.Lock()
+	repo, exists := state.Repositories[path]
+	if !exists {
+		state.mu.Unlock()
+		return nil
+	}
+	if repo.RunState == RunRunning {
+		state.mu.Unlock()
+		return fmt.Errorf("%w running %s", errRepositoryBusy, repo.Step)
+	}
+	repo.RunState, repo.Step = RunRunning, step
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+	return nil
+}
+
+// setRunStep records the step a running repository moved to.
+func setRunStep(path, step string) {
+	state.mu.Lock()
+	if repo, exists := state.Repositories[path]; exists && repo.RunState == RunRunning {
+		repo.Step = step
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+}
+
+// endRun marks the repository at path as idle, or errored when its last
+// pipeline run failed.
+func endRun(path string) {
+	state.mu.Lock()
+	if repo, exists := state.Repositories[path]; exists {
+		repo.RunState, repo.Step = idleState(repo), ""
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+}
+
+// setQueued marks the repositories at paths that are not running as queued.
+func setQueued(paths []string) {
+	state.mu.Lock()
+	for _, path := range paths {
+		if repo, exists := state.Repositories[path]; exists && repo.RunState != RunRunning {
+			repo.RunState = RunQueued
+		}
+	}
+	state.mu.Unlock()
+	for _, path := range paths {
+		notifyRepoChanged(path)
+	}
+}
+
+// unqueue returns a queued repository that will not run to its idle state.
+func unqueue(path string) {
+	state.mu.Lock()
+	if repo, exists := state.Repositories[path]; exists && repo.RunState == RunQueued {
+		repo.RunState = idleState(repo)
+	}
+	state.mu.Unlock()
+	notifyRepoChanged(path)
+}
+
+// idleState is the state of repo when it does not run. The caller must hold
+// state.mu.
+func idleState(repo *Repository) string {
+	if repo.LastError != "" {
+		return RunError
+	}
+	return RunIdle
+}
+
+// runExclusive wraps the handlers of manual actions on a repository, marking
+// it as running step meanwhile. Actions on a repository that already runs are
+// refused with a 409.
+func runExclusive(step string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := absRequestPath(requestPath(r))
+		if err := beginRun(path, step); err != nil {
+			apiError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		defer endRun(path)
+		next(w, r)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"gitwatcher/internal/gitops"
+)
+
+// secretSettings lists the settings whose values are never echoed back in diffs.
+var secretSettings = map[string]bool{
+	"githubToken":         true,
+	"geminiAPIKey":        true,
+	"openaiAPIKey":        true,
+	"apiToken":            true,
+	"githubClientSecret":  true,
+	"githubOAuthToken":    true,
+	"viewerToken":         true,
+	"sshKeyPassphrase":    true,
+	"smtpPassword":        true,
+	"ntfyToken":           true,
+	"gotifyToken":         true,
+	"pushoverUserKey":     true,
+	"pushoverToken":       true,
+	"githubWebhookSecret": true,
+	"mqttPassword":        true,
+	// The URLs of some services, such as chat webhooks, embed a token
+	"webhooks": true,
+}
+
+// dangerousSettings lists the settings that require an explicit confirmation
+// before they are changed on a running instance.
+var dangerousSettings = map[string]bool{
+	"aiService":     true,
+	"sshKeyPath":    true,
+	"execCommand":   true,
+	"apiToken":      true,
+	"roles":         true,
+	"defaultRole":   true,
+	"allowedLogins": true,
+	"allowedOrgs":   true,
+}
+
+// aiServices are the supported values of the aiService setting.
+var aiServices = map[string]bool{
+	"ollama": true,
+	"gemini": true,
+	"openai": true,
+	"exec":   true,
+	"none":   true,
+}
+
+type SettingChange struct {
+	Field     string      `json:"field"`
+	Old       interface{} `json:"old"`
+	New       interface{} `json:"new"`
+	Dangerous bool        `json:"dangerous"`
+}
+
+type SettingsUpdateResponse struct {
+	Changes []SettingChange `json:"changes"`
+	Applied bool            `json:"applied"`
+}
+
+func diffSettings(oldSettings, newSettings Settings) []SettingChange {
+	changes := []SettingChange{}
+
+	oldValue := reflect.ValueOf(oldSettings)
+	newValue := reflect.ValueOf(newSettings)
+	t := oldValue.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if field == "" || field == "-" {
+			continue
+		}
+
+		o := oldValue.Field(i).Interface()
+		n := newValue.Field(i).Interface()
+		if reflect.DeepEqual(o, n) {
+			continue
+		}
+
+		if secretSettings[field] {
+			o = maskSecret(o)
+			n = maskSecret(n)
+		}
+
+		changes = append(changes, SettingChange{
+			Field:     field,
+			Old:       o,
+			New:       n,
+			Dangerous: dangerousSettings[field],
+		})
+	}
+
+	return changes
+}
+
+// clearSecrets empties the secret settings.
+func (s *Settings) clearSecrets() {
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if secretSettings[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+}
+
+func hasDangerousChange(changes []SettingChange) bool {
+	for _, change := range changes {
+		if change.Dangerous {
+			return true
+		}
+	}
+	return false
+}
+
+func maskSecret(value interface{}) interface{} {
+	if v := reflect.ValueOf(value); !v.IsValid() || v.IsZero() {
+		return ""
+	}
+	return "********"
+}
+
+// updateSSHPassphrases hands the SSH key passphrases of the instance and
+// user settings to gitops. The caller must hold state.mu.
+func (s *AppState) updateSSHPassphrases() {
+	passphrases := make(map[string]string)
+	all := []*Settings{&s.Settings}
+	for _, settings := range s.UserSettings {
+		all = append(all, settings)
+	}
+	for _, settings := range all {
+		if _, exists := passphrases[settings.SSHKeyPath]; !exists && settings.SSHKeyPassphrase != "" {
+			passphrases[settings.SSHKeyPath] = settings.SSHKeyPassphrase
+		}
+	}
+	gitops.SetSSHPassphrases(passphrases)
+}
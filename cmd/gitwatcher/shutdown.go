@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gitwatcher/internal/systemd"
+
+	"google.golang.org/grpc"
+)
+
+// shutdownTimeout bounds how long running requests and scheduled tasks may
+// take to finish once a shutdown is requested.
+const shutdownTimeout = 30 * time.Second
+
+// streamsDone is closed on shutdown so open event streams let the server stop.
+var streamsDone = make(chan struct{})
+
+func closeStreams() {
+	close(streamsDone)
+}
+
+// shutdownContext is cancelled on SIGINT or SIGTERM, or when the Windows
+// service manager stops the service. stopped must be called once the
+// shutdown is complete.
+func shutdownContext() (ctx context.Context, stopped func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	return serviceContext(ctx, stop)
+}
+
+// waitForShutdown blocks until ctx is done, then stops accepting requests
+// and scheduling tasks, waits for the running ones to finish and saves the
+// state. server is nil in headless mode and grpcServer when the gRPC API is
+// disabled.
+func waitForShutdown(ctx context.Context, server *http.Server, grpcServer *grpc.Server) {
+	<-ctx.Done()
+	notifySystemd(systemd.Stopping)
+	slog.Info("Shutting down, waiting for running operations", "timeout", shutdownTimeout)
+
+	timeout, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop the scheduler first so no task starts while requests drain
+	tasks := state.scheduler.Stop()
+	watched := stopWatches()
+	jobs := stopSyncJobs()
+	if server != nil {
+		server.RegisterOnShutdown(closeStreams)
+		if err := server.Shutdown(timeout); err != nil {
+			slog.Error("Error shutting down server", "error", err)
+		}
+	} else {
+		closeStreams()
+	}
+	if grpcServer != nil {
+		// Event streams end once streamsDone is closed, but a unary sync can
+		// wait on checks for much longer than the timeout
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-timeout.Done():
+			slog.Warn("Timed out waiting for gRPC calls to finish")
+			grpcServer.Stop()
+		}
+	}
+	select {
+	case <-tasks.Done():
+	case <-timeout.Done():
+		slog.Warn("Timed out waiting for scheduled tasks to finish")
+	}
+	select {
+	case <-jobs:
+	case <-timeout.Done():
+		slog.Warn("Timed out waiting for sync jobs to finish")
+	}
+	select {
+	case <-watched:
+	case <-timeout.Done():
+		slog.Warn("Timed out waiting for the syncs of watched repositories to finish")
+	}
+
+	if err := saveConfig(); err != nil {
+		slog.Error("Error saving config", "error", err)
+	}
+	stopMQTT()
+	closeStateDB()
+	slog.Info("Shutdown complete")
+}
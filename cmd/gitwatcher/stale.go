@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+const staleCheckTask = "stale-check"
+
+// checkStaleRepositories refreshes the last activity of every repository and
+// records a stale operation when one with a StaleAfter period has been silent
+// for longer, once until it becomes active again.
+func checkStaleRepositories() {
+	state.mu.RLock()
+	staleAfter := make(map[string]string)
+	for path, repo := range state.Repositories {
+		if !repo.Missing {
+			staleAfter[path] = repo.StaleAfter
+		}
+	}
+	state.mu.RUnlock()
+
+	for path, period := range staleAfter {
+		lastActivity, err := gitops.GetLastActivity(path)
+		if err != nil {
+			slog.Warn("Error getting last activity", "repo", path, "error", err)
+			continue
+		}
+
+		stale := false
+		if period != "" {
+			d, err := time.ParseDuration(period)
+			if err != nil {
+				slog.Warn("Invalid stale period", "repo", path, "period", period, "error", err)
+			} else {
+				stale = time.Since(lastActivity) > d
+			}
+		}
+
+		state.mu.Lock()
+		repo, exists := state.Repositories[path]
+		alert := exists && stale && !repo.Stale && !staleRecorded(repo, lastActivity)
+		if exists {
+			repo.LastActivity = lastActivity
+			repo.Stale = stale
+		}
+		state.mu.Unlock()
+		notifyRepoChanged(path)
+
+		if alert {
+			slog.Warn("Repository has had no committed activity", "repo", path,
+				"lastActivity", lastActivity.Format(time.RFC3339), "staleAfter", period)
+			recordOperation(path, Operation{
+				Type:    "stale",
+				Trigger: TriggerScheduler,
+				Message: fmt.Sprintf("No committed activity since %s, longer than %s", lastActivity.Format(time.RFC1123), period),
+			})
+		}
+	}
+}
+
+// staleRecorded reports whether repo already has a stale operation since its
+// last activity, which Stale does not tell after a restart.
+func staleRecorded(repo *Repository, lastActivity time.Time) bool {
+	for i := len(repo.History) - 1; i >= 0; i-- {
+		if op := repo.History[i]; op.Type == "stale" && op.Timestamp.After(lastActivity) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// stateDB keeps the runtime state of the repositories, set with -state-db or
+// GITWATCHER_STATE_DB: their whole operation history, pending PR and AI
+// usage, and the last runs of the scheduled tasks. The config file then only
+// holds their configuration, and memory only the last maxHistory operations
+// of each repository.
+var stateDB *stateStore
+
+// stateStore is a database keeping the runtime state. Queries are written
+// with ? placeholders and go through bind for the dialect.
+type stateStore struct {
+	*sql.DB
+	dialect *stateDialect
+
+	// saved holds the columns of the repositories as last read or written,
+	// so instances sharing a database only write what they changed and only
+	// delete the repositories they removed
+	mu    sync.Mutex
+	saved map[string]repositoryColumns
+}
+
+// stateDialect is what differs between the databases the state can be kept
+// in.
+type stateDialect struct {
+	name   string
+	driver string
+	schema []string
+	// numbered uses $1, $2... placeholders instead of ?
+	numbered bool
+}
+
+// sqliteDialect keeps the state in an embedded SQLite file, for single
+// instances. Operations are kept as JSON with the columns they are queried
+// by.
+var sqliteDialect = &stateDialect{
+	name:   "sqlite",
+	driver: "sqlite",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS repositories (
+			path TEXT PRIMARY KEY,
+			pending_pr TEXT,
+			ai_usage TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS operations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			repo TEXT NOT NULL REFERENCES repositories(path) ON DELETE CASCADE,
+			timestamp INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS operations_repo_timestamp ON operations(repo, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS operations_timestamp ON operations(timestamp)`,
+		`CREATE TABLE IF NOT EXISTS scheduled_tasks (
+			key TEXT PRIMARY KEY,
+			last_run INTEGER NOT NULL,
+			last_duration_ms INTEGER NOT NULL
+		)`,
+	},
+}
+
+// postgresDialect keeps the state in PostgreSQL, shared by the instances of
+// a deployment so it survives the loss of one.
+var postgresDialect = &stateDialect{
+	name:   "postgres",
+	driver: "pgx",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS repositories (
+			path TEXT PRIMARY KEY,
+			pending_pr TEXT,
+			ai_usage TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS operations (
+			id BIGSERIAL PRIMARY KEY,
+			repo TEXT NOT NULL REFERENCES repositories(path) ON DELETE CASCADE,
+			timestamp BIGINT NOT NULL,
+			type TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS operations_repo_timestamp ON operations(repo, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS operations_timestamp ON operations(timestamp)`,
+		`CREATE TABLE IF NOT EXISTS scheduled_tasks (
+			key TEXT PRIMARY KEY,
+			last_run BIGINT NOT NULL,
+			last_duration_ms BIGINT NOT NULL
+		)`,
+	},
+	numbered: true,
+}
+
+// repositoryColumns are the runtime state columns of a repository, NULL when
+// unset.
+type repositoryColumns struct {
+	pendingPR, aiUsage sql.NullString
+}
+
+// bind rewrites the ? placeholders of query for the dialect.
+func (s *stateStore) bind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// openStateStore opens the database at location, a postgres:// or
+// postgresql:// URL or else the path of a SQLite file, and creates its
+// tables. It also returns the location to log, without credentials.
+func openStateStore(location string) (*stateStore, string, error) {
+	dialect, dsn, display := sqliteDialect, "", ""
+	if strings.HasPrefix(location, "postgres://") || strings.HasPrefix(location, "postgresql://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid database URL: %v", err)
+		}
+		dialect, dsn, display = postgresDialect, location, u.Redacted()
+	} else {
+		absPath, err := filepath.Abs(expandHome(location))
+		if err != nil {
+			return nil, "", err
+		}
+		// WAL lets the dashboard read while operations are written, and the
+		// busy timeout with immediate transactions queues concurrent writers
+		// instead of failing them
+		dsn, display = absPath+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate", absPath
+	}
+
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, display, err
+	}
+	for _, statement := range dialect.schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, display, fmt.Errorf("error creating the tables of %s: %v", display, err)
+		}
+	}
+	return &stateStore{DB: db, dialect: dialect, saved: make(map[string]repositoryColumns)}, display, nil
+}
+
+// initStateDB opens the state database when requested by flag or by the
+// GITWATCHER_STATE_DB environment variable. State still in the config file,
+// from before the database was enabled, is moved into it.
+func initStateDB(flagValue string) error {
+	location := flagOrEnv(flagValue, "GITWATCHER_STATE_DB", "")
+	if location == "" {
+		return nil
+	}
+	store, display, err := openStateStore(location)
+	if err != nil {
+		return err
+	}
+	stateDB = store
+
+	imported, err := importState()
+	if err != nil {
+		return fmt.Errorf("error moving the state into %s: %v", display, err)
+	}
+	if err := loadState(); err != nil {
+		return fmt.Errorf("error reading %s: %v", display, err)
+	}
+	state.scheduler.OnRun(recordTaskRun)
+	slog.Info("Runtime state is kept in the state database", "database", store.dialect.name, "location", display)
+	if imported {
+		slog.Info("Moved the history, pending PRs and AI usage of the config file into the state database")
+		return saveConfig()
+	}
+	return nil
+}
+
+// importState copies the runtime state loaded from the config file into the
+// database, and reports whether there was any. The file only holds state
+// written while the database was disabled, so it is newer than the
+// database's.
+func importState() (bool, error) {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	tx, err := stateDB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	imported := false
+	for path, repo := range state.Repositories {
+		if len(repo.History) == 0 && repo.PendingPR == nil && len(repo.AIUsage) == 0 {
+			continue
+		}
+		imported = true
+		if _, err := tx.Exec(stateDB.bind(`INSERT INTO repositories (path) VALUES (?) ON CONFLICT (path) DO NOTHING`), path); err != nil {
+			return false, err
+		}
+		if repo.PendingPR != nil || len(repo.AIUsage) > 0 {
+			columns, err := runtimeColumns(repo)
+			if err != nil {
+				return false, err
+			}
+			if _, err := tx.Exec(stateDB.bind(`UPDATE repositories SET pending_pr = ?, ai_usage = ? WHERE path = ?`),
+				columns.pendingPR, columns.aiUsage, path); err != nil {
+				return false, err
+			}
+		}
+		var latest sql.NullInt64
+		if err := tx.QueryRow(stateDB.bind(`SELECT MAX(timestamp) FROM operations WHERE repo = ?`), path).Scan(&latest); err != nil {
+			return false, err
+		}
+		for _, op := range repo.History {
+			if latest.Valid && op.Timestamp.UnixNano() <= latest.Int64 {
+				continue
+			}
+			if err := insertOperation(tx, path, op); err != nil {
+				return false, err
+			}
+		}
+	}
+	return imported, tx.Commit()
+}
+
+// loadState replaces the runtime state of the repositories with the one of
+// the database.
+func loadState() error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	stateDB.mu.Lock()
+	defer stateDB.mu.Unlock()
+
+	for path, repo := range state.Repositories {
+		var columns repositoryColumns
+		err := stateDB.QueryRow(stateDB.bind(`SELECT pending_pr, ai_usage FROM repositories WHERE path = ?`), path).
+			Scan(&columns.pendingPR, &columns.aiUsage)
+		if err == nil {
+			stateDB.saved[path] = columns
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		repo.PendingPR, repo.AIUsage = nil, nil
+		if columns.pendingPR.Valid {
+			if err := json.Unmarshal([]byte(columns.pendingPR.String), &repo.PendingPR); err != nil {
+				return fmt.Errorf("%s: pending PR: %v", path, err)
+			}
+		}
+		if columns.aiUsage.Valid {
+			if err := json.Unmarshal([]byte(columns.aiUsage.String), &repo.AIUsage); err != nil {
+				return fmt.Errorf("%s: AI usage: %v", path, err)
+			}
+		}
+
+		events, err := queryOperations([]string{path}, "", time.Time{}, maxHistory)
+		if err != nil {
+			return err
+		}
+		repo.History = make([]Operation, len(events))
+		for i, event := range events {
+			repo.History[len(events)-1-i] = event.Operation
+		}
+	}
+	return nil
+}
+
+// restoreTaskRuns gives the scheduled tasks their last run from before the
+// restart. It is called once every task is added.
+func restoreTaskRuns() error {
+	if stateDB == nil {
+		return nil
+	}
+	rows, err := stateDB.Query(`SELECT key, last_run, last_duration_ms FROM scheduled_tasks`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var lastRun, durationMs int64
+		if err := rows.Scan(&key, &lastRun, &durationMs); err != nil {
+			return err
+		}
+		state.scheduler.SetLastRun(key, time.Unix(0, lastRun), time.Duration(durationMs)*time.Millisecond)
+	}
+	return rows.Err()
+}
+
+// runtimeColumns encodes the pending PR and AI usage of repo.
+func runtimeColumns(repo *Repository) (repositoryColumns, error) {
+	var columns repositoryColumns
+	if repo.PendingPR != nil {
+		data, err := json.Marshal(repo.PendingPR)
+		if err != nil {
+			return columns, err
+		}
+		columns.pendingPR = sql.NullString{String: string(data), Valid: true}
+	}
+	if len(repo.AIUsage) > 0 {
+		data, err := json.Marshal(repo.AIUsage)
+		if err != nil {
+			return columns, err
+		}
+		columns.aiUsage = sql.NullString{String: string(data), Valid: true}
+	}
+	return columns, nil
+}
+
+// saveState writes the pending PRs and AI usage that changed, and deletes
+// the rows and history of the repositories removed since they were loaded.
+// Rows of repositories other instances added are left alone. saveConfig
+// calls it with state.mu held.
+func saveState() error {
+	stateDB.mu.Lock()
+	defer stateDB.mu.Unlock()
+
+	changed := make(map[string]repositoryColumns)
+	for path, repo := range state.Repositories {
+		columns, err := runtimeColumns(repo)
+		if err != nil {
+			return err
+		}
+		if saved, exists := stateDB.saved[path]; !exists || saved != columns {
+			changed[path] = columns
+		}
+	}
+	var removed []string
+	for path := range stateDB.saved {
+		if _, exists := state.Repositories[path]; !exists {
+			removed = append(removed, path)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	tx, err := stateDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for path, columns := range changed {
+		if _, err := tx.Exec(stateDB.bind(`INSERT INTO repositories (path, pending_pr, ai_usage) VALUES (?, ?, ?)
+			ON CONFLICT (path) DO UPDATE SET pending_pr = excluded.pending_pr, ai_usage = excluded.ai_usage`),
+			path, columns.pendingPR, columns.aiUsage); err != nil {
+			return err
+		}
+	}
+	for _, path := range removed {
+		if _, err := tx.Exec(stateDB.bind(`DELETE FROM repositories WHERE path = ?`), path); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for path, columns := range changed {
+		stateDB.saved[path] = columns
+	}
+	for _, path := range removed {
+		delete(stateDB.saved, path)
+	}
+	return nil
+}
+
+func insertOperation(tx *sql.Tx, repoPath string, op Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(stateDB.bind(`INSERT INTO operations (repo, timestamp, type, data) VALUES (?, ?, ?, ?)`),
+		repoPath, op.Timestamp.UnixNano(), op.Type, string(data))
+	return err
+}
+
+// storeOperation adds op to the history of the repository in the database.
+func storeOperation(repoPath string, op Operation) error {
+	tx, err := stateDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The repository row may not be saved yet when it was just added
+	if _, err := tx.Exec(stateDB.bind(`INSERT INTO repositories (path) VALUES (?) ON CONFLICT (path) DO NOTHING`), repoPath); err != nil {
+		return err
+	}
+	if err := insertOperation(tx, repoPath, op); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryOperations returns up to limit operations of the repositories at
+// paths, newest first, optionally only of type opType and from before the
+// given time.
+func queryOperations(paths []string, opType string, before time.Time, limit int) ([]ActivityEvent, error) {
+	events := []ActivityEvent{}
+	if len(paths) == 0 {
+		return events, nil
+	}
+	query := `SELECT repo, data FROM operations WHERE repo IN (` + placeholders(len(paths)) + `)`
+	args := make([]interface{}, 0, len(paths)+3)
+	for _, path := range paths {
+		args = append(args, path)
+	}
+	if opType != "" {
+		query += ` AND type = ?`
+		args = append(args, opType)
+	}
+	if !before.IsZero() {
+		query += ` AND timestamp < ?`
+		args = append(args, before.UnixNano())
+	}
+	query += ` ORDER BY timestamp DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := stateDB.Query(stateDB.bind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event ActivityEvent
+		var data string
+		if err := rows.Scan(&event.Repo, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &event.Operation); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// moveStoredRepository moves the row, history and task runs of the
+// repository at from to the path to. It is called with state.mu held, so
+// saveState does not delete the row meanwhile.
+func moveStoredRepository(from, to string) error {
+	stateDB.mu.Lock()
+	defer stateDB.mu.Unlock()
+
+	tx, err := stateDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The new row comes first, the operations reference it
+	statements := []string{
+		`INSERT INTO repositories (path, pending_pr, ai_usage) SELECT ?, pending_pr, ai_usage FROM repositories WHERE path = ?
+			ON CONFLICT (path) DO NOTHING`,
+		`UPDATE operations SET repo = ? WHERE repo = ?`,
+		`UPDATE scheduled_tasks SET key = ? WHERE key = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(stateDB.bind(statement), to, from); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(stateDB.bind(`DELETE FROM repositories WHERE path = ?`), from); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if columns, exists := stateDB.saved[from]; exists {
+		stateDB.saved[to] = columns
+		delete(stateDB.saved, from)
+	}
+	return nil
+}
+
+// recordTaskRun saves when a scheduled task last ran.
+func recordTaskRun(key string, started time.Time, duration time.Duration) {
+	_, err := stateDB.Exec(stateDB.bind(`INSERT INTO scheduled_tasks (key, last_run, last_duration_ms) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET last_run = excluded.last_run, last_duration_ms = excluded.last_duration_ms`),
+		key, started.UnixNano(), duration.Milliseconds())
+	if err != nil {
+		slog.Error("Error saving the last run of a task", "task", key, "error", err)
+	}
+}
+
+// closeStateDB closes the state database, if any, on shutdown.
+func closeStateDB() {
+	if stateDB == nil {
+		return
+	}
+	if err := stateDB.Close(); err != nil {
+		slog.Error("Error closing the state database", "error", err)
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultStatsRange is the period covered by the stats when no from is given.
+const defaultStatsRange = 30 * 24 * time.Hour
+
+// RepoStats aggregates the operations of a repository over a period.
+type RepoStats struct {
+	// CommitsPerDay counts commits by YYYY-MM-DD day
+	CommitsPerDay map[string]int `json:"commitsPerDay"`
+	Commits       int            `json:"commits"`
+	Pushes        int            `json:"pushes"`
+	PRsOpened     int            `json:"prsOpened"`
+	Syncs         int            `json:"syncs"`
+	FailedSyncs   int            `json:"failedSyncs"`
+	// FailureRate is the share of syncs that failed, between 0 and 1
+	FailureRate   float64 `json:"failureRate"`
+	AvgSyncMs     int64   `json:"avgSyncMs"`
+	totalSyncTime int64
+}
+
+func newRepoStats() *RepoStats {
+	return &RepoStats{CommitsPerDay: make(map[string]int)}
+}
+
+func (s *RepoStats) add(op Operation) {
+	switch op.Type {
+	case "commit":
+		s.Commits++
+		s.CommitsPerDay[op.Timestamp.Format("2006-01-02")]++
+	case "push":
+		s.Pushes++
+	case "pr":
+		s.PRsOpened++
+	case "sync":
+		s.Syncs++
+		if op.Error != "" {
+			s.FailedSyncs++
+		}
+		s.totalSyncTime += op.DurationMs
+	}
+}
+
+func (s *RepoStats) finish() {
+	if s.Syncs > 0 {
+		s.FailureRate = float64(s.FailedSyncs) / float64(s.Syncs)
+		s.AvgSyncMs = s.totalSyncTime / int64(s.Syncs)
+	}
+}
+
+type Stats struct {
+	From         time.Time             `json:"from"`
+	To           time.Time             `json:"to"`
+	Total        *RepoStats            `json:"total"`
+	Repositories map[string]*RepoStats `json:"repositories"`
+}
+
+// parseStatsTime accepts RFC 3339 times and YYYY-MM-DD days.
+func parseStatsTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// handleStats aggregates the operation history of every visible repository
+// between the from and to query parameters, the last 30 days by default.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	from := to.Add(-defaultStatsRange)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := parseStatsTime(v)
+		if err != nil {
+			apiError(w, fmt.Sprintf("Invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := parseStatsTime(v)
+		if err != nil {
+			apiError(w, fmt.Sprintf("Invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		apiError(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	stats := Stats{
+		From:         from,
+		To:           to,
+		Total:        newRepoStats(),
+		Repositories: make(map[string]*RepoStats),
+	}
+
+	state.mu.RLock()
+	for path, repo := range userRepositories(contextUser(r.Context())) {
+		repoStats := newRepoStats()
+		for _, op := range repo.History {
+			if op.Timestamp.Before(from) || op.Timestamp.After(to) {
+				continue
+			}
+			repoStats.add(op)
+			stats.Total.add(op)
+		}
+		repoStats.finish()
+		stats.Repositories[path] = repoStats
+	}
+	state.mu.RUnlock()
+	stats.Total.finish()
+
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// streamCreatePR opens a PR like handleCreatePR, but answers with
+// Server-Sent Events: "start" before each AI request, "token" with the
+// generated text as it is produced, and finally "result" with the PRResult
+// or "error" with the failure.
+func streamCreatePR(w http.ResponseWriter, r *http.Request, absPath string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event string, data interface{}) {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	result, _, err := createPR(r.Context(), absPath, func(event, text string) {
+		send(event, text)
+	})
+	if err != nil {
+		send("error", err.Error())
+		return
+	}
+	send("result", result)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// syncJobWorkers is how many repositories of a sync job run the pipeline at
+// the same time. AI servers, local ones especially, handle few requests at
+// once.
+const syncJobWorkers = 2
+
+// maxSyncJobs is how many finished sync jobs are kept for polling.
+const maxSyncJobs = 20
+
+// Status of a repository in a sync job.
+const (
+	SyncPending = "pending"
+	SyncRunning = "running"
+	SyncDone    = "done"
+	SyncFailed  = "failed"
+	// SyncCancelled repositories had not started when the server shut down
+	SyncCancelled = "cancelled"
+)
+
+// SyncJobItem is the progress of one repository of a sync job.
+type SyncJobItem struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SyncJob runs the pipeline of many repositories in the background.
+type SyncJob struct {
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished"`
+	Done     bool      `json:"done"`
+	// Completed counts the repositories that ran, successfully or not
+	Completed    int           `json:"completed"`
+	Failed       int           `json:"failed"`
+	Repositories []SyncJobItem `json:"repositories"`
+	// owner is the user who started the job, the only one who can poll it
+	owner string
+}
+
+// syncJobs holds the running and recently finished sync jobs. They are lost
+// on restart.
+var syncJobs = struct {
+	mu   sync.Mutex
+	jobs map[string]*SyncJob
+	// stopping is set on shutdown, running tracks the pipelines in progress
+	stopping bool
+	running  sync.WaitGroup
+}{jobs: make(map[string]*SyncJob)}
+
+// startSyncJob queues the pipeline of every repository of paths for owner and
+// returns the job to poll.
+func startSyncJob(owner string, paths []string) *SyncJob {
+	job := &SyncJob{ID: newRequestID(), Created: time.Now(), Repositories: make([]SyncJobItem, len(paths)), owner: owner}
+	for i, path := range paths {
+		job.Repositories[i] = SyncJobItem{Path: path, Status: SyncPending}
+	}
+
+	syncJobs.mu.Lock()
+	pruneSyncJobs()
+	syncJobs.jobs[job.ID] = job
+	syncJobs.mu.Unlock()
+	setQueued(paths)
+
+	queue := make(chan int, len(paths))
+	for i := range paths {
+		queue <- i
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(syncJobWorkers, len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				runSyncJobItem(job, i)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		syncJobs.mu.Lock()
+		job.Done = true
+		job.Finished = time.Now()
+		syncJobs.mu.Unlock()
+		slog.Info("Sync job finished", "job", job.ID, "repositories", len(paths), "failed", job.Failed)
+	}()
+	return job
+}
+
+func runSyncJobItem(job *SyncJob, i int) {
+	syncJobs.mu.Lock()
+	item := &job.Repositories[i]
+	if syncJobs.stopping {
+		item.Status = SyncCancelled
+		syncJobs.mu.Unlock()
+		unqueue(item.Path)
+		return
+	}
+	item.Status = SyncRunning
+	syncJobs.running.Add(1)
+	syncJobs.mu.Unlock()
+
+	err := syncRepository(item.Path)
+	// Skipped repositories, read-only mode for one, never started running
+	unqueue(item.Path)
+
+	syncJobs.mu.Lock()
+	defer syncJobs.mu.Unlock()
+	syncJobs.running.Done()
+	job.Completed++
+	if err != nil {
+		item.Status = SyncFailed
+		item.Error = err.Error()
+		job.Failed++
+	} else {
+		item.Status = SyncDone
+	}
+}
+
+// stopSyncJobs cancels the repositories of sync jobs that have not started.
+// The returned channel is closed once those running have finished.
+func stopSyncJobs() <-chan struct{} {
+	syncJobs.mu.Lock()
+	syncJobs.stopping = true
+	syncJobs.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		syncJobs.running.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// pruneSyncJobs drops the oldest finished jobs beyond maxSyncJobs. The caller
+// must hold syncJobs.mu.
+func pruneSyncJobs() {
+	var finished []*SyncJob
+	for _, job := range syncJobs.jobs {
+		if job.Done {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.Before(finished[j].Finished) })
+	for len(finished) >= maxSyncJobs {
+		delete(syncJobs.jobs, finished[0].ID)
+		finished = finished[1:]
+	}
+}
+
+// handleSyncAll starts a sync job for the repositories of the user,
+// optionally only those of a group or with a tag, and replies 202 with the
+// job.
+func handleSyncAll(w http.ResponseWriter, r *http.Request) {
+	user := contextUser(r.Context())
+	state.mu.RLock()
+	repos := filterRepositories(userRepositories(user), r.URL.Query().Get("group"), r.URL.Query().Get("tag"))
+	paths := make([]string, 0, len(repos))
+	for path := range repos {
+		paths = append(paths, path)
+	}
+	state.mu.RUnlock()
+	if len(paths) == 0 {
+		apiError(w, "No repositories match", http.StatusNotFound)
+		return
+	}
+	sort.Strings(paths)
+
+	job := startSyncJob(user, paths)
+	slog.InfoContext(r.Context(), "Sync job started", "job", job.ID, "repositories", len(paths))
+
+	syncJobs.mu.Lock()
+	defer syncJobs.mu.Unlock()
+	w.Header().Set("Location", apiPrefix+"/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func handleGetSyncJob(w http.ResponseWriter, r *http.Request) {
+	syncJobs.mu.Lock()
+	defer syncJobs.mu.Unlock()
+
+	job, exists := syncJobs.jobs[mux.Vars(r)["id"]]
+	if !exists || job.owner != contextUser(r.Context()) {
+		apiError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog"
+
+	"gitwatcher/internal/systemd"
+)
+
+// notifySystemd sends state to systemd when running as a Type=notify service.
+func notifySystemd(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		slog.Warn("Error notifying systemd", "state", state, "error", err)
+	}
+}
+
+// scheduleWatchdog heartbeats the systemd watchdog from the scheduler, twice
+// per timeout, when WatchdogSec is set on the service.
+func scheduleWatchdog() {
+	interval := systemd.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	slog.Info("Heartbeating the systemd watchdog", "timeout", interval)
+	state.scheduler.Heartbeat(interval/2, pingWatchdog)
+}
+
+// pingWatchdog only reports the process alive when the scheduler still runs
+// tasks and the state lock can be taken, so a deadlock gets it restarted.
+func pingWatchdog() {
+	state.mu.RLock()
+	state.mu.RUnlock()
+	notifySystemd(systemd.Watchdog)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleListTasks returns the scheduled tasks with their next and last run.
+// Last runs survive restarts with a state database.
+func handleListTasks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(state.scheduler.Tasks())
+}
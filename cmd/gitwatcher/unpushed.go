@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+const unpushedAuditTask = "unpushed-audit"
+
+// defaultUnpushedAuditSchedule runs the audit every morning.
+const defaultUnpushedAuditSchedule = "0 9 * * *"
+
+type UnpushedReport struct {
+	GeneratedAt  time.Time                          `json:"generatedAt"`
+	Repositories map[string][]gitops.UnpushedBranch `json:"repositories"`
+	Errors       map[string]string                  `json:"errors,omitempty"`
+}
+
+var (
+	unpushedReport   UnpushedReport
+	unpushedReportMu sync.RWMutex
+)
+
+// runUnpushedAudit is the scheduled audit, which notifies the channels
+// taking failures when it finds unpushed commits.
+func runUnpushedAudit() {
+	if report := auditUnpushedCommits(); len(report.Repositories) > 0 {
+		notifyUnpushed(report)
+	}
+}
+
+// auditUnpushedCommits scans every watched repository for local commits that
+// exist on no remote, and returns the report it keeps for the API and the
+// digest.
+func auditUnpushedCommits() UnpushedReport {
+	state.mu.RLock()
+	var paths []string
+	for path := range state.Repositories {
+		paths = append(paths, path)
+	}
+	state.mu.RUnlock()
+
+	report := UnpushedReport{
+		GeneratedAt:  time.Now(),
+		Repositories: make(map[string][]gitops.UnpushedBranch),
+		Errors:       make(map[string]string),
+	}
+
+	for _, path := range paths {
+		branches, err := gitops.FindUnpushedCommits(path)
+		if err != nil {
+			slog.Warn("Error auditing unpushed commits", "repo", path, "error", err)
+			report.Errors[path] = err.Error()
+			continue
+		}
+		if len(branches) == 0 {
+			continue
+		}
+		report.Repositories[path] = branches
+		for _, b := range branches {
+			slog.Warn("ALERT: unpushed commits", "repo", path, "commits", b.Count, "branch", b.Branch)
+		}
+	}
+
+	unpushedReportMu.Lock()
+	unpushedReport = report
+	unpushedReportMu.Unlock()
+	return report
+}
+
+// notifyUnpushed notifies the channels taking failures of the unpushed
+// commits in report.
+func notifyUnpushed(report UnpushedReport) {
+	paths := make([]string, 0, len(report.Repositories))
+	for path := range report.Repositories {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The audit of %s found commits that exist on no remote:\n", report.GeneratedAt.Format(time.RFC1123))
+	for _, path := range paths {
+		fmt.Fprintf(&b, "\n%s\n", path)
+		for _, branch := range report.Repositories[path] {
+			fmt.Fprintf(&b, "  %d commits on %s\n", branch.Count, branch.Branch)
+		}
+	}
+	notifyFailureChannels(Notification{
+		Title:   fmt.Sprintf("GitWatcher: unpushed commits in %d repositories", len(paths)),
+		Message: b.String(),
+		Urgent:  true,
+	}, "")
+}
+
+func handleUnpushedReport(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("refresh") == "true" {
+		auditUnpushedCommits()
+	}
+
+	unpushedReportMu.RLock()
+	report := unpushedReport
+	unpushedReportMu.RUnlock()
+
+	if user := contextUser(r.Context()); user != "" {
+		state.mu.RLock()
+		visible := userRepositories(user)
+		state.mu.RUnlock()
+
+		filtered := UnpushedReport{
+			GeneratedAt:  report.GeneratedAt,
+			Repositories: make(map[string][]gitops.UnpushedBranch),
+			Errors:       make(map[string]string),
+		}
+		for path, branches := range report.Repositories {
+			if _, ok := visible[path]; ok {
+				filtered.Repositories[path] = branches
+			}
+		}
+		for path, message := range report.Errors {
+			if _, ok := visible[path]; ok {
+				filtered.Errors[path] = message
+			}
+		}
+		report = filtered
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// usageDays bounds the number of days of AI usage kept per repository.
+const usageDays = 90
+
+const usageDayFormat = "2006-01-02"
+
+// AIUsage totals the AI requests made over some period.
+type AIUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	EstimatedCost    float64 `json:"estimatedCost"`
+}
+
+func (u *AIUsage) add(other AIUsage) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.EstimatedCost += other.EstimatedCost
+}
+
+// recordAIUsage adds the usage of one AI request to today's totals of the
+// repository at repoPath.
+func recordAIUsage(repoPath string, usage gitops.Usage) {
+	day := time.Now().Format(usageDayFormat)
+
+	state.mu.Lock()
+	repo, exists := state.Repositories[repoPath]
+	if !exists {
+		state.mu.Unlock()
+		return
+	}
+	if repo.AIUsage == nil {
+		repo.AIUsage = make(map[string]*AIUsage)
+	}
+	if repo.AIUsage[day] == nil {
+		repo.AIUsage[day] = &AIUsage{}
+	}
+	repo.AIUsage[day].add(AIUsage{
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		EstimatedCost:    usage.EstimatedCost(),
+	})
+
+	// Day keys sort chronologically, so the oldest are dropped first
+	if len(repo.AIUsage) > usageDays {
+		days := make([]string, 0, len(repo.AIUsage))
+		for d := range repo.AIUsage {
+			days = append(days, d)
+		}
+		sort.Strings(days)
+		for _, d := range days[:len(days)-usageDays] {
+			delete(repo.AIUsage, d)
+		}
+	}
+	state.mu.Unlock()
+
+	if err := saveConfig(); err != nil {
+		slog.Error("Error saving AI usage", "repo", repoPath, "error", err)
+	}
+}
+
+// RepoAIUsage is the AI usage of one repository, in total and per day.
+type RepoAIUsage struct {
+	Total AIUsage             `json:"total"`
+	Days  map[string]*AIUsage `json:"days"`
+}
+
+// AIStats aggregates the AI usage of all repositories.
+type AIStats struct {
+	Total        AIUsage                 `json:"total"`
+	Days         map[string]*AIUsage     `json:"days"`
+	Repositories map[string]*RepoAIUsage `json:"repositories"`
+}
+
+func handleAIStats(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("path")
+	if filter != "" {
+		absPath, err := filepath.Abs(filter)
+		if err != nil {
+			apiError(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		filter = absPath
+	}
+
+	stats := AIStats{
+		Days:         make(map[string]*AIUsage),
+		Repositories: make(map[string]*RepoAIUsage),
+	}
+
+	state.mu.RLock()
+	for path, repo := range userRepositories(contextUser(r.Context())) {
+		if filter != "" && path != filter {
+			continue
+		}
+		repoStats := &RepoAIUsage{Days: make(map[string]*AIUsage)}
+		for day, usage := range repo.AIUsage {
+			dayUsage := *usage
+			repoStats.Days[day] = &dayUsage
+			repoStats.Total.add(*usage)
+			if stats.Days[day] == nil {
+				stats.Days[day] = &AIUsage{}
+			}
+			stats.Days[day].add(*usage)
+		}
+		stats.Total.add(repoStats.Total)
+		stats.Repositories[path] = repoStats
+	}
+	state.mu.RUnlock()
+
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+// maxPathBody bounds how much of a request body is buffered to find its
+// repository path.
+const maxPathBody = 1 << 20
+
+// settingsFor returns the settings that apply to the repository at path:
+// its owner's settings when the owner has saved any, the instance settings
+// otherwise. The caller must hold state.mu.
+func (s *AppState) settingsFor(path string) Settings {
+	if repo, exists := s.Repositories[path]; exists && repo.Owner != "" {
+		if _, exists := s.UserSettings[repo.Owner]; exists {
+			return s.settingsOf(repo.Owner)
+		}
+	}
+	return s.Settings
+}
+
+// settingsOf returns the settings GitWatcher uses on behalf of user: their
+// own settings, or the defaults of users without any, joined with the
+// instance-only fields. API token requests get the instance settings. The
+// caller must hold state.mu.
+func (s *AppState) settingsOf(user string) Settings {
+	if user == "" {
+		return s.Settings
+	}
+	settings := s.ownSettings(user)
+	settings.keepInstanceFields(s.Settings)
+	return settings
+}
+
+// ownSettings returns the settings user sees and edits: their own, or the
+// instance settings with the secrets and the instance-only fields left out
+// until they save some. The caller must hold state.mu.
+func (s *AppState) ownSettings(user string) Settings {
+	if user == "" {
+		return s.Settings
+	}
+	if settings, exists := s.UserSettings[user]; exists {
+		return *settings
+	}
+	settings := s.Settings
+	settings.clearSecrets()
+	settings.clearInstanceFields()
+	return settings
+}
+
+// repoSettings returns the settings that apply to the repository at path.
+func repoSettings(path string) Settings {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return state.settingsFor(path)
+}
+
+// keepInstanceFields copies the settings that only the instance can change,
+// such as authentication and what runs or is read on the host, over a
+// user's settings.
+func (s *Settings) keepInstanceFields(instance Settings) {
+	s.OllamaServer = instance.OllamaServer
+	s.SSHKeyPath = instance.SSHKeyPath
+	s.SSHKeyPassphrase = instance.SSHKeyPassphrase
+	s.ExecCommand = instance.ExecCommand
+	s.APIToken = instance.APIToken
+	s.GitHubClientID = instance.GitHubClientID
+	s.GitHubClientSecret = instance.GitHubClientSecret
+	s.ViewerToken = instance.ViewerToken
+	s.Roles = instance.Roles
+	s.DefaultRole = instance.DefaultRole
+	s.AllowedLogins = instance.AllowedLogins
+	s.AllowedOrgs = instance.AllowedOrgs
+	s.UnpushedAuditSchedule = instance.UnpushedAuditSchedule
+	s.Webhooks = instance.Webhooks
+	s.SMTPHost = instance.SMTPHost
+	s.SMTPPort = instance.SMTPPort
+	s.SMTPUsername = instance.SMTPUsername
+	s.SMTPPassword = instance.SMTPPassword
+	s.EmailFrom = instance.EmailFrom
+	s.EmailTo = instance.EmailTo
+	s.EmailFailures = instance.EmailFailures
+	s.DigestSchedule = instance.DigestSchedule
+	s.NtfyURL = instance.NtfyURL
+	s.NtfyToken = instance.NtfyToken
+	s.GotifyURL = instance.GotifyURL
+	s.GotifyToken = instance.GotifyToken
+	s.PushoverUserKey = instance.PushoverUserKey
+	s.PushoverToken = instance.PushoverToken
+	s.GitHubWebhookSecret = instance.GitHubWebhookSecret
+	s.MQTTBroker = instance.MQTTBroker
+	s.MQTTUsername = instance.MQTTUsername
+	s.MQTTPassword = instance.MQTTPassword
+	s.MQTTTopicPrefix = instance.MQTTTopicPrefix
+	s.AirGappedAllow = instance.AirGappedAllow
+}
+
+// clearInstanceFields empties the instance-only fields, which users' own
+// settings never hold.
+func (s *Settings) clearInstanceFields() {
+	s.keepInstanceFields(Settings{})
+}
+
+// visibleTo reports whether user may see and operate repo. API token
+// requests have no user and see everything, signed in users see their own
+// repositories and the shared ones that have no owner.
+func visibleTo(repo *Repository, user string) bool {
+	return user == "" || repo.Owner == "" || repo.Owner == user
+}
+
+// userRepositories returns the repositories visible to user. The caller must
+// hold state.mu.
+func userRepositories(user string) map[string]*Repository {
+	if user == "" {
+		return state.Repositories
+	}
+	repos := make(map[string]*Repository)
+	for path, repo := range state.Repositories {
+		if visibleTo(repo, user) {
+			repos[path] = repo
+		}
+	}
+	return repos
+}
+
+// requestPath returns the repository path of a request, taken from the path
+// query parameter or the path field of a JSON body. The body is restored so
+// handlers can decode it again.
+func requestPath(r *http.Request) string {
+	if path := r.URL.Query().Get("path"); path != "" {
+		return path
+	}
+	if r.Body == nil || r.Method == "GET" {
+		return ""
+	}
+
+	// Put back what was read in front of the rest, for large bodies such as
+	// backups
+	body := r.Body
+	data, err := io.ReadAll(io.LimitReader(body, maxPathBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), body), body}
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	json.Unmarshal(data, &req)
+	return req.Path
+}
+
+// addsRepository reports whether r adds a repository, the only request
+// whose path need not be watched yet.
+func addsRepository(r *http.Request) bool {
+	return r.Method == "POST" && (r.URL.Path == apiPrefix+"/repositories" || r.URL.Path == "/api/repositories")
+}
+
+// requireRepoAccess hides the repositories of other users from signed in
+// users, answering as if they did not exist. Paths that are not watched are
+// not found either, except when adding them.
+func requireRepoAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextUser(r.Context())
+		path := ""
+		if user != "" {
+			path = requestPath(r)
+		}
+		if path == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			apiError(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		state.mu.RLock()
+		repo, exists := state.Repositories[absPath]
+		allowed := exists && visibleTo(repo, user) || !exists && addsRepository(r)
+		state.mu.RUnlock()
+		if !allowed {
+			apiError(w, "Repository not found", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/scheduler"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// FieldErrors maps the JSON names of invalid request fields to what is
+// wrong with them.
+type FieldErrors map[string]string
+
+func (e FieldErrors) add(field, message string) {
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+// err returns the errors as a single error, nil when there are none.
+func (e FieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = fmt.Sprintf("%s: %s", field, e[field])
+	}
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// writeFieldErrors replies with a 400 listing the invalid fields in its
+// details. It reports whether there were any.
+func writeFieldErrors(w http.ResponseWriter, errs FieldErrors) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	apiErrorDetails(w, "Invalid request: "+errs.err().Error(), http.StatusBadRequest, map[string]FieldErrors{"fields": errs})
+	return true
+}
+
+// validateFields checks the options, adding their problems to errs.
+func (o RepoOptions) validateFields(errs FieldErrors) {
+	if o.AIType != "" && !aiServices[o.AIType] {
+		errs.add("aiService", fmt.Sprintf("unknown AI service %s", o.AIType))
+	}
+	if err := gitops.ValidateRedactPatterns(o.RedactPatterns); err != nil {
+		errs.add("redactPatterns", err.Error())
+	}
+	if err := gitops.ValidateScopes(o.Scopes); err != nil {
+		errs.add("scopes", err.Error())
+	}
+	if err := gitops.ValidateScopes(o.CommitAreas); err != nil {
+		errs.add("commitAreas", err.Error())
+	}
+	if o.WatchSettle != "" {
+		if d, err := time.ParseDuration(o.WatchSettle); err != nil {
+			errs.add("watchSettle", "must be a duration such as 10m")
+		} else if d <= 0 {
+			errs.add("watchSettle", "must be positive")
+		}
+	}
+}
+
+// validateRepoPath checks that path is an existing git repository.
+func validateRepoPath(path string, errs FieldErrors) {
+	if path == "" {
+		errs.add("path", "is required")
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		errs.add("path", "does not exist")
+		return
+	}
+	if !info.IsDir() {
+		errs.add("path", "is not a directory")
+		return
+	}
+	if _, err := git.PlainOpen(path); err != nil {
+		errs.add("path", "is not a git repository")
+	}
+}
+
+// validateGroup checks that group is empty or exists. The caller must hold
+// state.mu.
+func validateGroup(group string, errs FieldErrors) {
+	if _, exists := state.Groups[group]; group != "" && !exists {
+		errs.add("group", fmt.Sprintf("unknown group %s", group))
+	}
+}
+
+// validateSchedule checks the schedule of a repository, which may be empty
+// when its group has one. The caller must hold state.mu.
+func validateSchedule(schedule, group string, errs FieldErrors) {
+	if schedule != "" {
+		if err := scheduler.ValidateSchedule(schedule); err != nil {
+			errs.add("schedule", err.Error())
+		}
+	} else if g, exists := state.Groups[group]; !exists || g.Schedule == "" {
+		errs.add("schedule", "is required unless the group has one")
+	}
+}
+
+// validateTags rejects blank tags.
+func validateTags(tags []string, errs FieldErrors) {
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			errs.add("tags", "must not be blank")
+		}
+	}
+}
+
+// validateRepository checks a repository to add. Its path must already be
+// absolute.
+func validateRepository(repo *Repository) FieldErrors {
+	errs := FieldErrors{}
+	validateRepoPath(repo.Path, errs)
+
+	validateTags(repo.Tags, errs)
+	if repo.StaleAfter != "" {
+		if d, err := time.ParseDuration(repo.StaleAfter); err != nil {
+			errs.add("staleAfter", "must be a duration such as 48h")
+		} else if d <= 0 {
+			errs.add("staleAfter", "must be positive")
+		}
+	}
+
+	state.mu.RLock()
+	validateGroup(repo.Group, errs)
+	validateSchedule(repo.Schedule, repo.Group, errs)
+	state.mu.RUnlock()
+
+	repo.RepoOptions.validateFields(errs)
+	return errs
+}
+
+// absRequestPath makes a request path absolute, leaving empty paths empty
+// so they are reported as missing.
+func absRequestPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"gitwatcher/internal/fswatch"
+	"gitwatcher/internal/gitops"
+)
+
+// defaultWatchSettle is how long a watched worktree must stay quiet after a
+// change before the pipeline runs, unless the watchSettle option says
+// otherwise, so a burst of saves makes a single sync.
+const defaultWatchSettle = 5 * time.Second
+
+// repoWatch is the watch of a repository worktree. watcher is nil until the
+// tree has been walked.
+type repoWatch struct {
+	watcher *fswatch.Watcher
+	timer   *time.Timer
+	settle  time.Duration
+	scopes  []string
+}
+
+var watches = struct {
+	mu    sync.Mutex
+	repos map[string]*repoWatch
+	// stopping is set on shutdown, running tracks the syncs in progress
+	stopping bool
+	running  sync.WaitGroup
+}{repos: make(map[string]*repoWatch)}
+
+// updateWatch starts or stops watching the worktree of repo after its watch
+// option or missing state changed. The caller must hold state.mu.
+func updateWatch(repo *Repository) {
+	opts := resolveOptions(repo)
+	if !opts.Watch || repo.Missing {
+		stopWatch(repo.Path)
+		return
+	}
+	settle := defaultWatchSettle
+	if opts.WatchSettle != "" {
+		// Validated when set
+		if d, err := time.ParseDuration(opts.WatchSettle); err == nil && d > 0 {
+			settle = d
+		}
+	}
+	startWatch(repo.Path, settle, opts.Scopes)
+}
+
+// startWatch watches the scopes of the worktree at path, running the pipeline
+// once it has been quiet for settle, or updates the settle window of a
+// watched one. The tree is walked in the background, large worktrees take a
+// while.
+func startWatch(path string, settle time.Duration, scopes []string) {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	if watch, exists := watches.repos[path]; exists {
+		if slices.Equal(watch.scopes, scopes) {
+			watch.settle = settle
+			return
+		}
+		// The watched directories depend on the scopes
+		stopWatchLocked(path)
+	}
+	watch := &repoWatch{settle: settle, scopes: scopes}
+	watches.repos[path] = watch
+
+	go func() {
+		watcher, err := fswatch.New(path, watchIgnore(path, scopes), func(rel string) {
+			if filepath.Base(rel) == ".gitignore" {
+				reloadIgnore(path)
+			}
+			changeDetected(path)
+		})
+		if err != nil {
+			slog.Error("Error watching repository", "repo", path, "error", err)
+			return
+		}
+
+		watches.mu.Lock()
+		defer watches.mu.Unlock()
+		if watches.repos[path] != watch {
+			// Stopped while walking the tree
+			watcher.Close()
+			return
+		}
+		watch.watcher = watcher
+		slog.Info("Watching repository for changes", "repo", path)
+	}()
+}
+
+// watchIgnore returns the paths of the worktree at path left unwatched: those
+// git ignores and those outside the scopes. The .gitignore files are always
+// watched, their changes are reloaded.
+func watchIgnore(path string, scopes []string) fswatch.IgnoreFunc {
+	gitIgnored, err := gitops.IgnoreMatcher(path)
+	if err != nil {
+		slog.Warn("Error reading the ignore files, watching every file", "repo", path, "error", err)
+		gitIgnored = func(rel string, isDir bool) bool { return filepath.ToSlash(rel) == ".git" }
+	}
+	return func(rel string, isDir bool) bool {
+		if gitIgnored(rel, isDir) {
+			return true
+		}
+		if isDir {
+			return !gitops.InScopes(rel, scopes) && !gitops.ContainsScope(rel, scopes)
+		}
+		return !gitops.InScopes(rel, scopes) && filepath.Base(rel) != ".gitignore"
+	}
+}
+
+// reloadIgnore rereads the ignore files of the watched worktree at path after
+// one of them changed.
+func reloadIgnore(path string) {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	if watch, exists := watches.repos[path]; exists && watch.watcher != nil {
+		watch.watcher.SetIgnore(watchIgnore(path, watch.scopes))
+	}
+}
+
+// stopWatch stops watching the worktree at path.
+func stopWatch(path string) {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	stopWatchLocked(path)
+}
+
+// stopWatchLocked stops watching the worktree at path. The caller must hold
+// watches.mu.
+func stopWatchLocked(path string) {
+	watch, exists := watches.repos[path]
+	if !exists {
+		return
+	}
+	delete(watches.repos, path)
+	if watch.watcher != nil {
+		watch.watcher.Close()
+	}
+	if watch.timer != nil {
+		watch.timer.Stop()
+	}
+}
+
+// stopWatches stops every watch on shutdown. The returned channel is closed
+// once the syncs they started have finished.
+func stopWatches() <-chan struct{} {
+	watches.mu.Lock()
+	watches.stopping = true
+	paths := make([]string, 0, len(watches.repos))
+	for path := range watches.repos {
+		paths = append(paths, path)
+	}
+	watches.mu.Unlock()
+	for _, path := range paths {
+		stopWatch(path)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		watches.running.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// changeDetected runs the pipeline of the watched repository at path once
+// its worktree has been quiet for the settle window. Every change restarts
+// the window.
+func changeDetected(path string) {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	watch, exists := watches.repos[path]
+	if !exists {
+		return
+	}
+	if watch.timer == nil {
+		watch.timer = time.AfterFunc(watch.settle, func() { runWatchedSync(path) })
+	} else {
+		watch.timer.Reset(watch.settle)
+	}
+}
+
+// runWatchedSync syncs a watched repository whose worktree changed. Changes
+// made while it already runs are synced once that run is over.
+func runWatchedSync(path string) {
+	watches.mu.Lock()
+	if watches.stopping {
+		watches.mu.Unlock()
+		return
+	}
+	watches.running.Add(1)
+	watches.mu.Unlock()
+	defer watches.running.Done()
+
+	err := syncRepository(path)
+	if errors.Is(err, errRepositoryBusy) {
+		changeDetected(path)
+		return
+	}
+	trackScheduledRun(path, err)
+}
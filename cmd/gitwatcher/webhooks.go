@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"gitwatcher/internal/gitops"
+	"gitwatcher/internal/secrets"
+	"gitwatcher/internal/webhook"
+)
+
+// webhookAttempts is how many times a delivery is tried.
+const webhookAttempts = 3
+
+// Webhook receives the events it subscribes to as signed JSON.
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret signs the payloads, see the webhook package
+	Secret string `json:"secret,omitempty"`
+	// Events lists the events sent, every event when empty
+	Events []string `json:"events,omitempty"`
+}
+
+// webhookEvents are the events webhooks can subscribe to. Failures of the
+// pipeline are named after the step that failed.
+var webhookEvents = map[string]bool{
+	"commit-created":  true,
+	"pushed":          true,
+	"pr-opened":       true,
+	"tag-created":     true,
+	"release-created": true,
+	"synced":          true,
+	"stale":           true,
+	"sync-failed":     true,
+	"status-failed":   true,
+	"commit-failed":   true,
+	"squash-failed":   true,
+	"push-failed":     true,
+	"checks-failed":   true,
+	"pr-failed":       true,
+}
+
+// WebhookEvent is the payload posted to webhooks.
+type WebhookEvent struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	Repository string    `json:"repository"`
+	Operation  Operation `json:"operation"`
+}
+
+// webhookQueue holds the deliveries waiting to be sent, in order.
+var webhookQueue = make(chan webhook.Delivery, 256)
+
+// operationEvent returns the event of op, empty when it has none.
+func operationEvent(op Operation) string {
+	switch op.Type {
+	case "commit":
+		return "commit-created"
+	case "push":
+		return "pushed"
+	case "pr":
+		return "pr-opened"
+	case "tag":
+		return "tag-created"
+	case "release":
+		return "release-created"
+	case "stale":
+		return "stale"
+	case "sync":
+		if op.Error != "" {
+			return "sync-failed"
+		}
+		return "synced"
+	case "error":
+		if op.Step == "" {
+			return "sync-failed"
+		}
+		return op.Step + "-failed"
+	}
+	return ""
+}
+
+// publishOperation queues the event of an operation recorded on the
+// repository at repoPath for the webhooks subscribed to it, and publishes it
+// to MQTT.
+func publishOperation(repoPath string, op Operation) {
+	name := operationEvent(op)
+	if name == "" {
+		return
+	}
+	event := WebhookEvent{ID: newRequestID(), Event: name, Time: op.Timestamp, Repository: repoPath, Operation: op}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Error encoding webhook event", "event", name, "error", err)
+		return
+	}
+	publishMQTTEvent(repoPath, body)
+
+	state.mu.RLock()
+	hooks := slices.Clone(state.Settings.Webhooks)
+	state.mu.RUnlock()
+	for _, hook := range hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, name) {
+			continue
+		}
+		select {
+		case webhookQueue <- webhook.Delivery{URL: hook.URL, Secret: hook.Secret, Event: name, ID: event.ID, Body: body}:
+		default:
+			slog.Warn("Dropping webhook delivery, too many are waiting", "host", webhookHost(hook.URL), "event", name)
+		}
+	}
+}
+
+// deliverWebhooks sends the queued deliveries one at a time.
+func deliverWebhooks() {
+	for delivery := range webhookQueue {
+		if gitops.AirGapped() {
+			slog.Warn("Not delivering webhook in air-gapped mode", "host", webhookHost(delivery.URL), "event", delivery.Event, "delivery", delivery.ID)
+			continue
+		}
+		if err := webhook.SendWithRetry(context.Background(), delivery, webhookAttempts); err != nil {
+			slog.Warn("Error delivering webhook", "host", webhookHost(delivery.URL), "event", delivery.Event, "delivery", delivery.ID, "error", err)
+		}
+	}
+}
+
+// webhookHost returns the host of a webhook URL, to log instead of the URL,
+// which may embed a token.
+func webhookHost(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// validateWebhooks checks the URLs and events of the webhooks.
+func (s *Settings) validateWebhooks() error {
+	return validateWebhookList(s.Webhooks)
+}
+
+// validateStoredWebhooks checks the webhooks of a loaded config file, whose
+// URLs may still be encrypted or kept in the keyring.
+func (s *Settings) validateStoredWebhooks() error {
+	var readable []Webhook
+	for _, hook := range s.Webhooks {
+		if hook.URL != "" && !secrets.IsSealed(hook.URL) {
+			readable = append(readable, hook)
+		}
+	}
+	return validateWebhookList(readable)
+}
+
+func validateWebhookList(hooks []Webhook) error {
+	for _, hook := range hooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid webhook URL %s", hook.URL)
+		}
+		for _, event := range hook.Events {
+			if !webhookEvents[event] {
+				return fmt.Errorf("Unknown webhook event %s for %s", event, hook.URL)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package configfile reads and writes config files in JSON, YAML or TOML,
+// picked from the file extension. Values are mapped through their json tags
+// in every format, so one set of struct tags serves all three.
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a config file.
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	TOML Format = "toml"
+)
+
+// FormatOf returns the format of the file name: YAML for .yaml and .yml,
+// TOML for .toml and JSON otherwise.
+func FormatOf(name string) Format {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return YAML
+	case ".toml":
+		return TOML
+	}
+	return JSON
+}
+
+// Unmarshal decodes data, in the format of the file name, into v. String
+// values may reference environment variables as ${VAR}, or ${VAR:-default}
+// to fall back on a default when VAR is unset; the expansions are returned
+// so Marshal can write the references back instead of their values.
+func Unmarshal(name string, data []byte, v interface{}) (Substitutions, error) {
+	doc, err := decode(name, data)
+	if err != nil {
+		return nil, err
+	}
+	subs := Substitutions{}
+	if doc, err = expand(doc, "", subs); err != nil {
+		return nil, err
+	}
+	return subs, unmarshalDoc(doc, v)
+}
+
+// decode parses data, in the format of the file name, into generic maps and
+// slices.
+func decode(name string, data []byte) (interface{}, error) {
+	var doc interface{}
+	switch FormatOf(name) {
+	case YAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case TOML:
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, err
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// unmarshalDoc decodes a generic document into v through its json tags.
+func unmarshalDoc(doc, v interface{}) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("unsupported value: %v", err)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Marshal encodes v in the format of the file name. Values still equal to
+// the expansion of a substitution are written as its reference. For YAML
+// the comments of previous, the current content of the file, are kept on
+// the keys that are still there, so hand-written notes survive the file
+// being saved.
+func Marshal(name string, v interface{}, previous []byte, subs Substitutions) ([]byte, error) {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	format := FormatOf(name)
+	if format == JSON && len(subs) == 0 {
+		return raw, nil
+	}
+
+	// JSON is YAML, so decoding it as such keeps the order of the fields
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	restore(&doc, "", subs)
+	switch format {
+	case YAML:
+		return marshalYAML(&doc, previous)
+	case TOML:
+		return marshalTOML(nodeJSON(&doc))
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, nodeJSON(&doc), "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalYAML(doc *yaml.Node, previous []byte) ([]byte, error) {
+	blockStyle(doc)
+	var old yaml.Node
+	if yaml.Unmarshal(previous, &old) == nil {
+		copyComments(&old, doc)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow style and quoting of JSON so the encoder writes
+// idiomatic YAML.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// copyComments copies the comments of old to the matching nodes of node:
+// mapping values by key and sequence items by position.
+func copyComments(old, node *yaml.Node) {
+	node.HeadComment = old.HeadComment
+	node.LineComment = old.LineComment
+	node.FootComment = old.FootComment
+	if old.Kind != node.Kind {
+		return
+	}
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for i := 0; i < len(old.Content) && i < len(node.Content); i++ {
+			copyComments(old.Content[i], node.Content[i])
+		}
+	case yaml.MappingNode:
+		oldKeys := make(map[string]int, len(old.Content)/2)
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			oldKeys[old.Content[i].Value] = i
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if j, exists := oldKeys[node.Content[i].Value]; exists {
+				copyComments(old.Content[j], node.Content[i])
+				copyComments(old.Content[j+1], node.Content[i+1])
+			}
+		}
+	}
+}
+
+func marshalTOML(raw []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(tomlValue(doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlValue converts decoded JSON to values TOML can hold: it has no null,
+// so null fields are left out, and integers must not turn into floats.
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item != nil {
+				table[key] = tomlValue(item)
+			}
+		}
+		return table
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				list = append(list, tomlValue(item))
+			}
+		}
+		return list
+	}
+	return value
+}
@@ -0,0 +1,148 @@
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Substitutions maps the paths of the values that referenced environment
+// variables, such as /settings/githubToken, to their reference and value.
+type Substitutions map[string]Substitution
+
+// Substitution is a string value that referenced environment variables.
+type Substitution struct {
+	Reference string
+	Value     string
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// pointerEscaper escapes keys in paths as in JSON pointers.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Path returns the path of the value at keys, as used by Substitutions.
+func Path(keys ...string) string {
+	var path strings.Builder
+	for _, key := range keys {
+		path.WriteString("/" + pointerEscaper.Replace(key))
+	}
+	return path.String()
+}
+
+// expand replaces the environment references in the strings of doc, at
+// path, recording them in subs.
+func expand(doc interface{}, path string, subs Substitutions) (interface{}, error) {
+	switch v := doc.(type) {
+	case string:
+		if !envReference.MatchString(v) {
+			return v, nil
+		}
+		var missing []string
+		value := envReference.ReplaceAllStringFunc(v, func(ref string) string {
+			m := envReference.FindStringSubmatch(ref)
+			if env, ok := os.LookupEnv(m[1]); ok {
+				return env
+			}
+			if m[2] == "" {
+				missing = append(missing, m[1])
+			}
+			return m[3]
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s references unset environment variables %s", path, strings.Join(missing, ", "))
+		}
+		subs[path] = Substitution{Reference: v, Value: value}
+		return value, nil
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := expand(item, path+"/"+pointerEscaper.Replace(key), subs)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expand(item, path+"/"+strconv.Itoa(i), subs)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return doc, nil
+}
+
+// restore writes back the references of the substitutions whose value is
+// unchanged.
+func restore(node *yaml.Node, path string, subs Substitutions) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			restore(child, path, subs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			restore(node.Content[i+1], path+"/"+pointerEscaper.Replace(node.Content[i].Value), subs)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			restore(child, path+"/"+strconv.Itoa(i), subs)
+		}
+	case yaml.ScalarNode:
+		if sub, exists := subs[path]; exists && node.Tag == "!!str" && node.Value == sub.Value {
+			node.Value = sub.Reference
+		}
+	}
+}
+
+// nodeJSON encodes a node decoded from JSON back to compact JSON, keeping
+// the order of the fields.
+func nodeJSON(node *yaml.Node) []byte {
+	var buf bytes.Buffer
+	var write func(node *yaml.Node)
+	write = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				write(child)
+			}
+		case yaml.MappingNode:
+			buf.WriteByte('{')
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				write(node.Content[i])
+				buf.WriteByte(':')
+				write(node.Content[i+1])
+			}
+			buf.WriteByte('}')
+		case yaml.SequenceNode:
+			buf.WriteByte('[')
+			for i, child := range node.Content {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				write(child)
+			}
+			buf.WriteByte(']')
+		case yaml.ScalarNode:
+			if node.Tag == "!!str" {
+				s, _ := json.Marshal(node.Value)
+				buf.Write(s)
+			} else {
+				buf.WriteString(node.Value)
+			}
+		}
+	}
+	write(node)
+	return buf.Bytes()
+}
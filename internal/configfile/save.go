@@ -0,0 +1,65 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// BackupPath is where Save keeps the previous version of the file at path.
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// Save replaces the file at path with data atomically: a crash leaves
+// either the previous or the new version, never a partial one. The previous
+// version is kept at BackupPath when it is well-formed, so a file that was
+// broken by hand does not replace a good backup.
+func Save(path string, data []byte, perm os.FileMode) error {
+	if previous, err := os.ReadFile(path); err == nil && WellFormed(path, previous) {
+		if err := writeAtomic(BackupPath(path), previous, perm); err != nil {
+			return err
+		}
+	}
+	return writeAtomic(path, data, perm)
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it
+// over path once synced to disk.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Persist the rename itself; directories cannot be synced on Windows
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// WellFormed reports whether data parses in the format of the file name,
+// whether or not its content is valid.
+func WellFormed(name string, data []byte) bool {
+	_, err := decode(name, data)
+	return err == nil
+}
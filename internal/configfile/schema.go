@@ -0,0 +1,289 @@
+package configfile
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionField is the top-level field holding the schema version of a
+// document. Documents without it are version 0.
+const VersionField = "version"
+
+// Migration upgrades a decoded document by one version, typically by
+// renaming or reshaping fields.
+type Migration func(doc map[string]interface{}) error
+
+// Schema is the versioned layout of a config document.
+type Schema struct {
+	// Version is the current version
+	Version int
+	// Migrations[i] upgrades a document from version i to i+1, so there is
+	// one per version
+	Migrations []Migration
+}
+
+// ValidationError lists every problem found in a document, each prefixed
+// with the path of the value, such as /settings/aiTimeout.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Unmarshal decodes data like the package Unmarshal after upgrading it to
+// the current version, and returns the version the document had. Unlike
+// json.Unmarshal, unknown fields and values of the wrong type are reported
+// as a *ValidationError instead of being dropped.
+func (s *Schema) Unmarshal(name string, data []byte, v interface{}) (Substitutions, int, error) {
+	decoded, err := decode(name, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	doc, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, 0, &ValidationError{Problems: []string{"the document is not an object"}}
+	}
+
+	version := 0
+	if raw, exists := doc[VersionField]; exists {
+		n, ok := integer(raw)
+		if !ok || n < 0 {
+			return nil, 0, &ValidationError{Problems: []string{fmt.Sprintf("/%s: expected a positive integer, got %v", VersionField, raw)}}
+		}
+		version = int(n)
+	}
+	if version > s.Version {
+		return nil, version, fmt.Errorf("version %d is newer than the supported version %d, upgrade to read it", version, s.Version)
+	}
+	for from := version; from < s.Version; from++ {
+		if err := s.Migrations[from](doc); err != nil {
+			return nil, version, fmt.Errorf("error migrating from version %d to %d: %v", from, from+1, err)
+		}
+	}
+	doc[VersionField] = s.Version
+
+	subs := Substitutions{}
+	if _, err := expand(doc, "", subs); err != nil {
+		return nil, version, err
+	}
+	var problems []string
+	check(doc, reflect.TypeOf(v), "", &problems)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, version, &ValidationError{Problems: problems}
+	}
+	return subs, version, unmarshalDoc(doc, v)
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// check appends to problems the values of doc, at path, that json.Unmarshal
+// would drop or reject when decoding into t.
+func check(doc interface{}, t reflect.Type, path string, problems *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if doc == nil || t.Kind() == reflect.Interface {
+		return
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) || reflect.PointerTo(t).Implements(textUnmarshaler) {
+		// Types such as time.Time decode themselves
+		return
+	}
+	mismatch := func(expected string) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", pathOrRoot(path), expected, describe(doc)))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		fields := structFields(t)
+		for key, value := range m {
+			fieldPath := path + "/" + pointerEscaper.Replace(key)
+			field, exists := fields[key]
+			if !exists {
+				problem := fmt.Sprintf("%s: unknown field", fieldPath)
+				if suggestion := closest(key, fields); suggestion != "" {
+					problem += fmt.Sprintf(", did you mean %s?", suggestion)
+				}
+				*problems = append(*problems, problem)
+				continue
+			}
+			check(value, field, fieldPath, problems)
+		}
+	case reflect.Map:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			mismatch("an object")
+			return
+		}
+		for key, value := range m {
+			check(value, t.Elem(), path+"/"+pointerEscaper.Replace(key), problems)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Bytes are base64 strings in JSON
+			if _, ok := doc.(string); !ok {
+				mismatch("a base64 string")
+			}
+			return
+		}
+		list, ok := doc.([]interface{})
+		if !ok {
+			mismatch("a list")
+			return
+		}
+		for i, item := range list {
+			check(item, t.Elem(), path+"/"+strconv.Itoa(i), problems)
+		}
+	case reflect.String:
+		if _, ok := doc.(string); !ok {
+			mismatch("a string")
+		}
+	case reflect.Bool:
+		if _, ok := doc.(bool); !ok {
+			mismatch("true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, ok := integer(doc); !ok {
+			mismatch("an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := number(doc); !ok {
+			mismatch("a number")
+		}
+	}
+}
+
+// structFields returns the types of the fields of t by JSON name, including
+// those of embedded structs.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for name, t := range structFields(embedded) {
+					if _, exists := fields[name]; !exists {
+						fields[name] = t
+					}
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// closest returns the field name nearest to key, ignoring case, or "" when
+// none is close enough to be a likely typo.
+func closest(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", len(key)/3+1
+	for name := range fields {
+		d := distance(strings.ToLower(key), strings.ToLower(name))
+		if d < bestDistance || d == bestDistance && best != "" && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// number returns the value of a number decoded from any of the formats.
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// integer returns the value of a number without a fractional part.
+func integer(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	f, ok := number(v)
+	if !ok || f != math.Trunc(f) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func describe(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	}
+	return fmt.Sprint(v)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,126 @@
+// Package fswatch watches a directory tree for changes with fsnotify,
+// following the directories created in it.
+package fswatch
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// IgnoreFunc reports whether the path, relative to the watched root, is left
+// out. Ignored directories are not watched at all.
+type IgnoreFunc func(rel string, isDir bool) bool
+
+// Watcher watches the directories of a tree.
+type Watcher struct {
+	root     string
+	mu       sync.Mutex
+	ignore   IgnoreFunc
+	onChange func(rel string)
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+}
+
+// New watches the tree at root, calling onChange with the relative path of
+// every file created, written, removed or renamed that ignore does not
+// exclude. onChange is called from the goroutine of the watcher.
+func New(root string, ignore IgnoreFunc, onChange func(rel string)) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{root: root, ignore: ignore, onChange: onChange, watcher: watcher, done: make(chan struct{})}
+	if err := w.addTree(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// SetIgnore replaces the function ignoring paths, for the events to come.
+// Directories already watched stay watched.
+func (w *Watcher) SetIgnore(ignore IgnoreFunc) {
+	w.mu.Lock()
+	w.ignore = ignore
+	w.mu.Unlock()
+}
+
+func (w *Watcher) ignored(rel string, isDir bool) bool {
+	w.mu.Lock()
+	ignore := w.ignore
+	w.mu.Unlock()
+	return ignore(rel, isDir)
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+// addTree watches dir and the directories below it that are not ignored.
+func (w *Watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Directories can vanish while walking
+			if path != dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != w.root && w.ignored(w.rel(path), true) {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+func (w *Watcher) rel(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func (w *Watcher) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			rel := w.rel(event.Name)
+			info, err := os.Lstat(event.Name)
+			isDir := err == nil && info.IsDir()
+			if w.ignored(rel, isDir) {
+				continue
+			}
+			if isDir && event.Has(fsnotify.Create) {
+				if err := w.addTree(event.Name); err != nil {
+					slog.Warn("Error watching new directory", "path", event.Name, "error", err)
+				}
+			}
+			w.onChange(rel)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("File watcher error", "root", w.root, "error", err)
+		}
+	}
+}
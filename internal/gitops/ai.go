@@ -0,0 +1,358 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// DefaultOpenAIModel is used when no OpenAI model has been selected.
+const DefaultOpenAIModel = "gpt-4o-mini"
+
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// DefaultAITimeout bounds AI requests when no timeout is configured. Local
+// models can take a while to answer large prompts.
+const DefaultAITimeout = 2 * time.Minute
+
+// modelListTimeout bounds the model listing requests of the settings page.
+const modelListTimeout = 10 * time.Second
+
+// aiClient is shared by all AI requests; their deadlines come from the
+// request context.
+var aiClient = &http.Client{}
+
+// WithContext returns a copy of aiService whose requests are cancelled
+// together with ctx.
+func (aiService AIService) WithContext(ctx context.Context) AIService {
+	aiService.Context = ctx
+	return aiService
+}
+
+// requestContext returns the context of a single AI request, bounded by the
+// configured timeout.
+func (aiService AIService) requestContext() (context.Context, context.CancelFunc) {
+	ctx := aiService.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := aiService.Timeout
+	if timeout <= 0 {
+		timeout = DefaultAITimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cancelled reports whether the caller gave up on aiService's requests, in
+// which case no fallback should be attempted either.
+func (aiService AIService) cancelled() bool {
+	return aiService.Context != nil && aiService.Context.Err() != nil
+}
+
+// generateText sends prompt to the configured AI service and returns its reply.
+func generateText(prompt string, aiService AIService) (string, error) {
+	if aiDisabled(aiService) {
+		return "", ErrNoAIService
+	}
+	if isCloudService(aiService) {
+		if AirGapped() {
+			return "", ErrAirGapped
+		}
+		if aiService.LocalOnly {
+			return "", ErrLocalAIOnly
+		}
+		prompt = redactPrompt(prompt, aiService)
+	}
+
+	ctx, cancel := aiService.requestContext()
+	defer cancel()
+
+	var text string
+	var usage Usage
+	var err error
+	if aiService.Type == AIServiceExec {
+		text, err = generateExecText(ctx, prompt, aiService)
+		if err == nil && aiService.Progress != nil {
+			aiService.Progress(ProgressStart, "")
+			aiService.Progress(ProgressToken, text)
+		}
+	} else if aiService.Progress != nil {
+		aiService.Progress(ProgressStart, "")
+		switch aiService.Type {
+		case "gemini":
+			text, usage, err = streamGeminiText(ctx, prompt, aiService)
+		case "openai":
+			text, usage, err = streamOpenAIText(ctx, prompt, aiService)
+		default:
+			text, usage, err = streamOllamaText(ctx, prompt, aiService)
+		}
+	} else {
+		switch aiService.Type {
+		case "gemini":
+			text, usage, err = generateGeminiText(ctx, prompt, aiService)
+		case "openai":
+			text, usage, err = generateOpenAIText(ctx, prompt, aiService)
+		default:
+			text, usage, err = generateOllamaText(ctx, prompt, aiService)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if aiService.OnUsage != nil {
+		usage.Type = aiService.Type
+		usage.Model = aiService.Model
+		aiService.OnUsage(usage)
+	}
+	return text, nil
+}
+
+func generateGeminiText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(aiService.APIKey))
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	geminiModel := client.GenerativeModel(aiService.Model)
+
+	resp, err := geminiModel.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to generate content: %v", err)
+	}
+
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", Usage{}, fmt.Errorf("no response from Gemini API")
+	}
+
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
+		return "", Usage{}, fmt.Errorf("unexpected response type from Gemini API")
+	}
+
+	return string(text), geminiUsage(resp.UsageMetadata), nil
+}
+
+func generateOllamaText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	resp, err := ollamaChat(ctx, prompt, aiService, false)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var response OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", Usage{}, err
+	}
+
+	return response.Message.Content, response.usage(), nil
+}
+
+// ollamaChat sends prompt to the Ollama chat API. The caller closes the
+// response body.
+func ollamaChat(ctx context.Context, prompt string, aiService AIService, stream bool) (*http.Response, error) {
+	req := OllamaRequest{
+		Model:  aiService.Model,
+		Stream: stream,
+		Messages: []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", aiService.Server+"/api/chat", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := aiClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama API error: %s", string(body))
+	}
+	return resp, nil
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage openAIUsage `json:"usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIRequest performs an authenticated OpenAI API call and decodes the
+// response into out.
+func openAIRequest(ctx context.Context, method, endpoint, apiKey string, body interface{}, out interface{}) error {
+	resp, err := openAIDo(ctx, method, endpoint, apiKey, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// openAIDo sends an authenticated OpenAI API request. The caller closes the
+// response body.
+func openAIDo(ctx context.Context, method, endpoint, apiKey string, body interface{}) (*http.Response, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not provided in settings")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request: %v", err)
+		}
+		reader = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, openAIBaseURL+endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := aiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("OpenAI API error (%d): %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+func generateOpenAIText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	model := aiService.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	req := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	}
+
+	var response openAIChatResponse
+	if err := openAIRequest(ctx, "POST", "/chat/completions", aiService.APIKey, req, &response); err != nil {
+		return "", Usage{}, err
+	}
+
+	if len(response.Choices) == 0 {
+		return "", Usage{}, fmt.Errorf("no response from OpenAI API")
+	}
+	usage := Usage{PromptTokens: response.Usage.PromptTokens, CompletionTokens: response.Usage.CompletionTokens}
+	return response.Choices[0].Message.Content, usage, nil
+}
+
+// GetOpenAIModels lists the chat models available to apiKey.
+func GetOpenAIModels(apiKey string) ([]string, error) {
+	if AirGapped() {
+		return nil, ErrAirGapped
+	}
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), modelListTimeout)
+	defer cancel()
+	if err := openAIRequest(ctx, "GET", "/models", apiKey, nil, &response); err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, model := range response.Data {
+		// The models endpoint also returns embedding, audio and image models
+		if strings.HasPrefix(model.ID, "gpt-") {
+			models = append(models, model.ID)
+		}
+	}
+
+	if len(models) == 0 {
+		return []string{"gpt-4o", DefaultOpenAIModel}, nil
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// GetOllamaModels lists the models installed on the Ollama server.
+func GetOllamaModels(server string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), modelListTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(server, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := aiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error contacting Ollama: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama API error: %s", string(body))
+	}
+
+	var response struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	models := []string{}
+	for _, model := range response.Models {
+		models = append(models, model.Name)
+	}
+	sort.Strings(models)
+	return models, nil
+}
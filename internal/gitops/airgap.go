@@ -0,0 +1,23 @@
+package gitops
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrAirGapped is returned for outbound calls refused in air-gapped mode.
+var ErrAirGapped = errors.New("outbound call refused in air-gapped mode")
+
+// airGapped blocks the GitHub API and cloud AI services while set. Git
+// remotes and the configured Ollama server stay reachable.
+var airGapped atomic.Bool
+
+// SetAirGapped enables or disables air-gapped mode.
+func SetAirGapped(enabled bool) {
+	airGapped.Store(enabled)
+}
+
+// AirGapped reports whether air-gapped mode is enabled.
+func AirGapped() bool {
+	return airGapped.Load()
+}
@@ -0,0 +1,33 @@
+package gitops
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CreateBundle writes a git bundle of every ref of the repository at path to
+// file. go-git cannot write bundles, so this needs the git command.
+func CreateBundle(path, file string) error {
+	return runGit("", "-C", path, "bundle", "create", file, "--all")
+}
+
+// CloneBundle clones the bundle file into path, which must not exist yet.
+func CloneBundle(file, path string) error {
+	return runGit("", "clone", file, path)
+}
+
+func runGit(dir string, args ...string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("the git command is required for bundles: %v", err)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %v: %s", args[len(args)-3], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package gitops
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const changelogFile = "CHANGELOG.md"
+
+// changelogGroups are the Keep a Changelog change types, in their canonical order.
+var changelogGroups = []string{"Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+
+const changelogHeader = "# Changelog\n\n" +
+	"All notable changes to this project will be documented in this file.\n\n" +
+	"The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/).\n\n"
+
+// updateChangelog generates entries for changes and merges them into the
+// Unreleased section of CHANGELOG.md in root.
+func updateChangelog(root string, changes *Changes, aiService AIService) error {
+	prompt := "Write changelog entries for the following changes in Keep a Changelog format.\n" +
+		"Group the entries under the headings " + "### " + strings.Join(changelogGroups, ", ### ") + ", omitting empty groups.\n" +
+		"Each entry must be a single line starting with \"- \" written for users of the project.\n" +
+		"Do not include any other text, version headings or code blocks in the response.\n\n" +
+		formatChangesForPrompt(changes, aiService)
+
+	response, err := generateText(prompt, aiService)
+	if err == ErrNoAIService {
+		slog.Info("Skipping changelog update", "repo", root, "reason", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error generating changelog entry: %v", err)
+	}
+
+	entries := parseChangelogEntries(response)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(root, changelogFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(mergeChangelog(string(data), entries)), 0644)
+}
+
+// parseChangelogEntries extracts the bullet entries per change type from AI
+// output, ignoring anything outside the known groups.
+func parseChangelogEntries(text string) map[string][]string {
+	entries := make(map[string][]string)
+	group := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			group = ""
+			heading := strings.TrimSpace(strings.TrimLeft(line, "#"))
+			for _, g := range changelogGroups {
+				if strings.EqualFold(heading, g) {
+					group = g
+				}
+			}
+			continue
+		}
+		if group != "" && (strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")) {
+			entries[group] = append(entries[group], "- "+strings.TrimSpace(line[2:]))
+		}
+	}
+	return entries
+}
+
+// mergeChangelog adds entries to the Unreleased section of an existing
+// changelog, creating the file structure and section when missing.
+func mergeChangelog(existing string, entries map[string][]string) string {
+	if strings.TrimSpace(existing) == "" {
+		existing = changelogHeader
+	}
+
+	lines := strings.Split(existing, "\n")
+
+	// Locate the Unreleased section, or the position to insert it at
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		if strings.HasPrefix(line, "## ") {
+			if start >= 0 {
+				end = i
+				break
+			}
+			if strings.Contains(strings.ToLower(line), "unreleased") {
+				start = i
+			} else {
+				end = i
+				break
+			}
+		}
+	}
+
+	var before, after []string
+	unreleased := make(map[string][]string)
+	if start >= 0 {
+		before = lines[:start]
+		after = lines[end:]
+		group := ""
+		for _, line := range lines[start+1 : end] {
+			if strings.HasPrefix(line, "### ") {
+				group = strings.TrimSpace(strings.TrimPrefix(line, "### "))
+				continue
+			}
+			if group != "" && strings.TrimSpace(line) != "" {
+				unreleased[group] = append(unreleased[group], line)
+			}
+		}
+	} else {
+		before = lines[:end]
+		after = lines[end:]
+	}
+
+	for group, e := range entries {
+		unreleased[group] = append(e, unreleased[group]...)
+	}
+
+	var section []string
+	section = append(section, "## [Unreleased]", "")
+	for _, group := range changelogGroups {
+		if len(unreleased[group]) == 0 {
+			continue
+		}
+		section = append(section, "### "+group, "")
+		section = append(section, unreleased[group]...)
+		section = append(section, "")
+		delete(unreleased, group)
+	}
+	// Keep any non-standard groups the file already had
+	for group, e := range unreleased {
+		section = append(section, "### "+group, "")
+		section = append(section, e...)
+		section = append(section, "")
+	}
+
+	head := strings.TrimRight(strings.Join(before, "\n"), "\n") + "\n\n"
+	result := head + strings.Join(section, "\n")
+	if len(after) > 0 {
+		result += "\n" + strings.Join(after, "\n")
+	}
+	return strings.TrimRight(result, "\n") + "\n"
+}
@@ -0,0 +1,99 @@
+package gitops
+
+import (
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// changeTypes are the classifications of a sync, in order of precedence when
+// a branch mixes several of them.
+var changeTypes = []string{"feat", "fix", "docs", "chore"}
+
+// classifyChanges decides whether changes are a feature, fix, docs or chore
+// change, falling back to a heuristic when the AI gives no usable answer.
+func classifyChanges(changes *Changes, aiService AIService) string {
+	prompt := "Classify the following changes as exactly one of: " + strings.Join(changeTypes, ", ") + ".\n" +
+		"feat adds functionality, fix corrects a bug, docs only changes documentation, chore is everything else.\n" +
+		"Respond with only the type.\n\n" + formatChangesForPrompt(changes, aiService)
+
+	answer, err := generateText(prompt, aiService)
+	if err != nil {
+		slog.Warn("Error classifying changes, using heuristic", "error", err)
+		return heuristicChangeType(changes)
+	}
+	if changeType := parseChangeType(answer); changeType != "" {
+		return changeType
+	}
+	return heuristicChangeType(changes)
+}
+
+// parseChangeType returns the first change type mentioned in text.
+func parseChangeType(text string) string {
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	}) {
+		for _, changeType := range changeTypes {
+			if word == changeType {
+				return changeType
+			}
+		}
+	}
+	return ""
+}
+
+func heuristicChangeType(changes *Changes) string {
+	if len(changes.Files) == 0 {
+		return "chore"
+	}
+
+	docs := true
+	for _, file := range changes.Files {
+		ext := strings.ToLower(path.Ext(file))
+		if ext != ".md" && ext != ".txt" && ext != ".rst" && !strings.HasPrefix(file, "docs/") {
+			docs = false
+		}
+	}
+	if docs {
+		return "docs"
+	}
+
+	for _, d := range changes.Diffs {
+		if d.IsNew && !isNoisePath(d.Path, nil) {
+			return "feat"
+		}
+	}
+	return "chore"
+}
+
+// applyChangeType makes changeType the Conventional Commits type of message,
+// replacing the type the message already has.
+func applyChangeType(message, changeType string) string {
+	lines := strings.SplitN(message, "\n", 2)
+	subject := lines[0]
+	if m := conventionalPattern.FindStringSubmatchIndex(subject); m != nil {
+		subject = changeType + subject[m[3]:]
+	} else if subject != "" {
+		subject = changeType + ": " + lowerFirst(subject)
+	}
+	lines[0] = truncateSubject(subject)
+	return strings.Join(lines, "\n")
+}
+
+// branchChangeType derives the change type of a branch from the types of its
+// commit messages, e.g. a branch with any feat commit is a feat.
+func branchChangeType(commits []string) string {
+	found := make(map[string]bool)
+	for _, commit := range commits {
+		subject := strings.SplitN(commit, "\n", 2)[0]
+		if m := conventionalPattern.FindStringSubmatch(subject); m != nil {
+			found[m[1]] = true
+		}
+	}
+	for _, changeType := range changeTypes {
+		if found[changeType] {
+			return changeType
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package gitops
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// maxCommitsSince bounds how far CommitsSince walks back when since is not
+// an ancestor of HEAD.
+const maxCommitsSince = 100
+
+// CommitInfo identifies a commit for the operation history.
+type CommitInfo struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+}
+
+// HeadHash returns the hash HEAD points to, empty on an unborn branch.
+func HeadHash(path string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting HEAD: %v", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// CommitsSince lists the commits reachable from HEAD that were made after
+// since, oldest first. An empty since lists the history up to the limit.
+func CommitsSince(path string, since string) ([]CommitInfo, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting HEAD: %v", err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("error reading log: %v", err)
+	}
+	defer iter.Close()
+
+	var commits []CommitInfo
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash.String() == since || len(commits) == maxCommitsSince {
+			return storer.ErrStop
+		}
+		commits = append(commits, CommitInfo{Hash: c.Hash.String(), Message: strings.TrimSpace(c.Message)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading log: %v", err)
+	}
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
@@ -0,0 +1,57 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CommitFormatConventional constrains generated messages to Conventional Commits.
+const CommitFormatConventional = "conventional"
+
+var conventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+var conventionalPattern = regexp.MustCompile(`^(` + strings.Join(conventionalTypes, "|") + `)(\([a-zA-Z0-9_./-]+\))?!?: \S.*$`)
+
+const conventionalInstructions = "\n\nThe message must follow the Conventional Commits format: type(scope): subject\n" +
+	"type is one of " + "feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert\n" +
+	"the scope is optional, the subject is lower case and does not end with a period\n" +
+	"append ! after the type or scope for breaking changes"
+
+// validateConventional checks the subject line of message against the
+// Conventional Commits format.
+func validateConventional(message string) error {
+	subject := strings.SplitN(strings.TrimSpace(message), "\n", 2)[0]
+	if !conventionalPattern.MatchString(subject) {
+		return fmt.Errorf("subject %q is not in type(scope): subject form", subject)
+	}
+	return nil
+}
+
+// reformatConventional turns an arbitrary message into a valid Conventional
+// Commit as a last resort, keeping the original text as the subject.
+func reformatConventional(message string) string {
+	lines := strings.SplitN(strings.TrimSpace(message), "\n", 2)
+	subject := strings.TrimRight(strings.TrimSpace(lines[0]), ".")
+	if subject == "" {
+		subject = "update files"
+	}
+	subject = lowerFirst(subject)
+
+	result := truncateSubject("chore: " + subject)
+	if len(lines) > 1 {
+		result += "\n" + lines[1]
+	}
+	return result
+}
+
+// lowerFirst lowercases the first letter of s, which may be non-ASCII.
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToLower(r)) + s[size:]
+}
@@ -0,0 +1,235 @@
+package gitops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DefaultDiffTokenBudget bounds the diff included in prompts when no budget
+// is configured.
+const DefaultDiffTokenBudget = 2000
+
+// charsPerToken is a rough average used to turn the token budget into text length.
+const charsPerToken = 4
+
+// FileDiff is the unified diff of one staged file.
+type FileDiff struct {
+	Path     string
+	Patch    string
+	Added    int
+	Deleted  int
+	IsBinary bool
+	IsNew    bool
+}
+
+// stagedDiffs computes unified diffs between HEAD and the index for files.
+func stagedDiffs(repo *git.Repository, files []string) ([]FileDiff, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var tree *object.Tree
+	if head, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if tree, err = commit.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+
+	var diffs []FileDiff
+	for _, path := range sorted {
+		var from, to *diffFile
+		if tree != nil {
+			if f, err := tree.File(path); err == nil {
+				from = &diffFile{path: path, hash: f.Hash, mode: f.Mode}
+			}
+		}
+		if entry, err := idx.Entry(path); err == nil {
+			to = &diffFile{path: path, hash: entry.Hash, mode: entry.Mode}
+		}
+		if from == nil && to == nil {
+			continue
+		}
+		if from != nil && to != nil && from.hash == to.hash && from.mode == to.mode {
+			continue
+		}
+
+		fileDiff, err := diffFiles(repo, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("error diffing %s: %v", path, err)
+		}
+		diffs = append(diffs, *fileDiff)
+	}
+	return diffs, nil
+}
+
+func diffFiles(repo *git.Repository, from, to *diffFile) (*FileDiff, error) {
+	oldContent, oldBinary, err := blobContent(repo, from)
+	if err != nil {
+		return nil, err
+	}
+	newContent, newBinary, err := blobContent(repo, to)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := &filePatch{binary: oldBinary || newBinary}
+	// The encoder distinguishes added and deleted files by nil interfaces
+	if from != nil {
+		patch.from = from
+	}
+	if to != nil {
+		patch.to = to
+	}
+
+	result := &FileDiff{IsBinary: patch.binary, IsNew: from == nil}
+	if from != nil {
+		result.Path = from.path
+	} else {
+		result.Path = to.path
+	}
+
+	if !patch.binary {
+		for _, d := range diff.Do(oldContent, newContent) {
+			lines := strings.Count(d.Text, "\n")
+			switch d.Type {
+			case diffmatchpatch.DiffInsert:
+				patch.chunks = append(patch.chunks, chunk{d.Text, fdiff.Add})
+				result.Added += lines
+			case diffmatchpatch.DiffDelete:
+				patch.chunks = append(patch.chunks, chunk{d.Text, fdiff.Delete})
+				result.Deleted += lines
+			default:
+				patch.chunks = append(patch.chunks, chunk{d.Text, fdiff.Equal})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).Encode(unifiedPatch{patch}); err != nil {
+		return nil, err
+	}
+	result.Patch = buf.String()
+	return result, nil
+}
+
+// blobContent reads the blob of f, reporting binary content instead of
+// returning it.
+func blobContent(repo *git.Repository, f *diffFile) (string, bool, error) {
+	if f == nil {
+		return "", false, nil
+	}
+	blob, err := repo.BlobObject(f.hash)
+	if err != nil {
+		return "", false, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", false, err
+	}
+	if isBinary(data) {
+		return "", true, nil
+	}
+	return string(data), false, nil
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// formatDiffs renders diffs within a budget of tokens. Files that no longer
+// fit are summarized by their line counts.
+func formatDiffs(diffs []FileDiff, tokenBudget int) string {
+	if len(diffs) == 0 {
+		return ""
+	}
+	if tokenBudget <= 0 {
+		tokenBudget = DefaultDiffTokenBudget
+	}
+	remaining := tokenBudget * charsPerToken
+
+	var included strings.Builder
+	var summarized []string
+	for _, d := range diffs {
+		switch {
+		case d.IsBinary:
+			summarized = append(summarized, d.Path+": binary file changed")
+		case len(d.Patch) <= remaining:
+			included.WriteString(d.Patch)
+			remaining -= len(d.Patch)
+		case remaining > 200:
+			included.WriteString(d.Patch[:remaining])
+			included.WriteString("\n... diff truncated\n")
+			remaining = 0
+		default:
+			summarized = append(summarized, fmt.Sprintf("%s: +%d -%d lines (diff omitted)", d.Path, d.Added, d.Deleted))
+		}
+	}
+
+	result := included.String()
+	if len(summarized) > 0 {
+		result += "\nOther changes:\n" + strings.Join(summarized, "\n")
+	}
+	return result
+}
+
+type diffFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *diffFile) Hash() plumbing.Hash     { return f.hash }
+func (f *diffFile) Mode() filemode.FileMode { return f.mode }
+func (f *diffFile) Path() string            { return f.path }
+
+type chunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c chunk) Content() string       { return c.content }
+func (c chunk) Type() fdiff.Operation { return c.op }
+
+type filePatch struct {
+	from, to fdiff.File
+	chunks   []fdiff.Chunk
+	binary   bool
+}
+
+func (p *filePatch) IsBinary() bool               { return p.binary }
+func (p *filePatch) Files() (from, to fdiff.File) { return p.from, p.to }
+func (p *filePatch) Chunks() []fdiff.Chunk        { return p.chunks }
+
+type unifiedPatch []fdiff.FilePatch
+
+func (p unifiedPatch) FilePatches() []fdiff.FilePatch { return p }
+func (p unifiedPatch) Message() string                { return "" }
@@ -0,0 +1,49 @@
+package gitops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindRepositories returns the working trees under root, down to maxDepth
+// directories below it. The repositories are not searched for nested ones,
+// and hidden directories and symlinks are skipped. Directories that cannot
+// be read are skipped too, so a partial list is returned rather than an
+// error.
+func FindRepositories(root string, maxDepth int) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	var repos []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		// .git is a file in linked worktrees and submodules
+		if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+			repos = append(repos, path)
+			return fs.SkipDir
+		}
+		if rel, _ := filepath.Rel(root, path); rel != "." && strings.Count(rel, string(filepath.Separator)) >= maxDepth-1 {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return repos, err
+}
@@ -0,0 +1,34 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AIServiceExec pipes prompts to a user-specified command instead of an AI.
+const AIServiceExec = "exec"
+
+// generateExecText runs the command of aiService through the shell with the
+// prompt on stdin and returns its stdout. The command is killed when ctx is
+// done.
+func generateExecText(ctx context.Context, prompt string, aiService AIService) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", aiService.Command)
+	cmd.Stdin = strings.NewReader(prompt)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("message command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := strings.TrimSpace(stdout.String())
+	if text == "" {
+		return "", fmt.Errorf("message command produced no output")
+	}
+	return text, nil
+}
@@ -0,0 +1,97 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// AIServiceNone disables AI generation; commit messages and PRs are built
+// from the changed files instead.
+const AIServiceNone = "none"
+
+// ErrNoAIService is returned by AI requests when no AI service is configured.
+var ErrNoAIService = errors.New("no AI service configured")
+
+// aiDisabled reports whether aiService cannot be asked for text at all.
+func aiDisabled(aiService AIService) bool {
+	switch aiService.Type {
+	case AIServiceNone:
+		return true
+	case "gemini", "openai":
+		return aiService.APIKey == ""
+	case AIServiceExec:
+		return aiService.Command == ""
+	default:
+		return aiService.Server == ""
+	}
+}
+
+// templateCommitMessage builds a deterministic commit message such as
+// "Auto-commit: 3 files changed in src/, docs/" followed by the file list.
+func templateCommitMessage(changes *Changes, conventional bool) string {
+	files := "1 file"
+	if len(changes.Files) != 1 {
+		files = fmt.Sprintf("%d files", len(changes.Files))
+	}
+
+	subject := "Auto-commit: " + files + " changed"
+	if conventional {
+		subject = "chore: auto-commit " + files + " changed"
+	}
+	if dirs := changedDirs(changes.Files); len(dirs) > 0 {
+		subject += " in " + strings.Join(dirs, ", ")
+	}
+	subject = truncateSubject(subject)
+
+	if len(changes.Files) == 0 {
+		return subject
+	}
+	return subject + "\n\n- " + strings.Join(changes.Files, "\n- ")
+}
+
+// changedDirs returns the sorted top-level directories of files, with files
+// in the repository root reported as "./".
+func changedDirs(files []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, file := range files {
+		dir := "./"
+		if i := strings.Index(file, "/"); i >= 0 {
+			dir = path.Clean(file[:i]) + "/"
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// templatePRTitle uses the only commit subject of the branch or summarizes
+// the changed files.
+func templatePRTitle(changes *Changes, conventional bool) string {
+	if len(changes.Commits) == 1 {
+		if subject := strings.TrimSpace(strings.SplitN(changes.Commits[0], "\n", 2)[0]); subject != "" {
+			return truncateSubject(subject)
+		}
+	}
+	return strings.SplitN(templateCommitMessage(changes, conventional), "\n", 2)[0]
+}
+
+// templatePRDescription lists the commits and changed files of the branch.
+func templatePRDescription(changes *Changes) string {
+	var b strings.Builder
+	b.WriteString("## Commits\n\n")
+	for _, commit := range changes.Commits {
+		b.WriteString("- " + strings.TrimSpace(strings.SplitN(commit, "\n", 2)[0]) + "\n")
+	}
+	b.WriteString("\n## Changed files\n\n")
+	for _, file := range changes.Files {
+		b.WriteString("- `" + file + "`\n")
+	}
+	return b.String()
+}
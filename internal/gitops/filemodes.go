@@ -0,0 +1,89 @@
+package gitops
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// ignoresFileModes reports whether any of the symlink or file mode rules are
+// enabled, so the index can be left alone otherwise.
+func (o CommitOptions) ignoresFileModes() bool {
+	return o.IgnoreSymlinks || o.IgnoreExecutableBit || o.IgnoreModeChanges
+}
+
+// applyFileModeRules rewrites the staged index so that the changes excluded by
+// opts keep the entry from before staging. Filesystems that do not preserve
+// permissions otherwise produce a mode change for every file.
+func applyFileModeRules(repo *git.Repository, before *index.Index, opts CommitOptions) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]*index.Entry, len(before.Entries))
+	for _, e := range before.Entries {
+		previous[e.Name] = e
+	}
+
+	var entries []*index.Entry
+	staged := make(map[string]struct{}, len(idx.Entries))
+	for _, e := range idx.Entries {
+		staged[e.Name] = struct{}{}
+		prev := previous[e.Name]
+
+		if opts.IgnoreSymlinks && (e.Mode == filemode.Symlink || (prev != nil && prev.Mode == filemode.Symlink)) {
+			if prev != nil {
+				entries = append(entries, prev)
+			}
+			continue
+		}
+
+		if prev != nil && prev.Mode != e.Mode {
+			if opts.IgnoreModeChanges && prev.Hash == e.Hash {
+				entries = append(entries, prev)
+				continue
+			}
+			if opts.IgnoreExecutableBit && isExecutableToggle(prev.Mode, e.Mode) {
+				e.Mode = prev.Mode
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	// Deleted symlinks stay in the index when symlinks are ignored
+	if opts.IgnoreSymlinks {
+		for _, e := range before.Entries {
+			if _, ok := staged[e.Name]; !ok && e.Mode == filemode.Symlink {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	idx.Entries = entries
+	return repo.Storer.SetIndex(idx)
+}
+
+func isExecutableToggle(a, b filemode.FileMode) bool {
+	return (a == filemode.Regular && b == filemode.Executable) ||
+		(a == filemode.Executable && b == filemode.Regular)
+}
+
+// hasStagedChanges reports whether the index differs from HEAD.
+func hasStagedChanges(status git.Status) bool {
+	return len(stagedFiles(status)) > 0
+}
+
+// stagedFiles lists the files whose staged version differs from HEAD.
+func stagedFiles(status git.Status) []string {
+	var files []string
+	for file, s := range status {
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,441 @@
+package gitops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	ChecksSuccess = "success"
+	ChecksPending = "pending"
+	ChecksFailure = "failure"
+)
+
+const (
+	checksPollInterval = 30 * time.Second
+	checksGracePeriod  = time.Minute
+)
+
+type githubCombinedStatus struct {
+	State      string `json:"state"`
+	TotalCount int    `json:"total_count"`
+	Statuses   []struct {
+		Context     string `json:"context"`
+		State       string `json:"state"`
+		Description string `json:"description"`
+	} `json:"statuses"`
+}
+
+type githubCheckRuns struct {
+	TotalCount int `json:"total_count"`
+	CheckRuns  []struct {
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+	} `json:"check_runs"`
+}
+
+// getGitHubRepo extracts the owner and repository name from the origin remote.
+func getGitHubRepo(repo *git.Repository) (string, string, error) {
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", "", fmt.Errorf("error getting remote: %v", err)
+	}
+
+	if len(remote.Config().URLs) == 0 {
+		return "", "", fmt.Errorf("origin remote has no URL")
+	}
+	remoteURL := remote.Config().URLs[0]
+
+	// Extract owner and repo from SSH URL format (git@github.com:owner/repo.git)
+	// or HTTPS URL format (https://github.com/owner/repo.git)
+	var parts []string
+	if strings.Contains(remoteURL, "git@github.com:") {
+		parts = strings.Split(strings.TrimPrefix(remoteURL, "git@github.com:"), "/")
+	} else {
+		parts = strings.Split(strings.TrimPrefix(remoteURL, "https://github.com/"), "/")
+	}
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("unable to parse GitHub repository from remote URL %s", remoteURL)
+	}
+
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), nil
+}
+
+// GitHubRepository returns the owner and name of the GitHub repository the
+// origin remote of the repository at path points to.
+func GitHubRepository(path string) (string, string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", "", err
+	}
+	return getGitHubRepo(repo)
+}
+
+// githubRequest performs an authenticated GitHub REST API call, decoding the
+// response into out when it is non-nil.
+func githubRequest(method, url, githubToken string, body interface{}, out interface{}) error {
+	if AirGapped() {
+		return ErrAirGapped
+	}
+	if githubToken == "" {
+		return fmt.Errorf("GitHub token not provided in settings")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %v", err)
+		}
+		reader = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "token "+githubToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GitHub API error (%d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// githubGraphQL runs a GraphQL query against the GitHub API. GraphQL reports
+// most failures in the response body, so those are surfaced as errors too.
+func githubGraphQL(githubToken string, query string, variables map[string]interface{}, out interface{}) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	err := githubRequest("POST", "https://api.github.com/graphql", githubToken, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Errors) > 0 {
+		var messages []string
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("GitHub GraphQL error: %s", strings.Join(messages, "; "))
+	}
+
+	if out == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// getChecksState combines commit statuses and check runs for ref into a single
+// success, pending or failure state, along with a summary of the failing checks.
+// found reports whether any status or check run was reported at all.
+func getChecksState(owner, repoName, ref, githubToken string) (state string, failures []string, found bool, err error) {
+	var status githubCombinedStatus
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s/status", owner, repoName, ref)
+	if err := githubRequest("GET", url, githubToken, nil, &status); err != nil {
+		return "", nil, false, fmt.Errorf("error getting commit status: %v", err)
+	}
+
+	var checks githubCheckRuns
+	url = fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s/check-runs", owner, repoName, ref)
+	if err := githubRequest("GET", url, githubToken, nil, &checks); err != nil {
+		return "", nil, false, fmt.Errorf("error getting check runs: %v", err)
+	}
+
+	state = ChecksSuccess
+	found = status.TotalCount > 0 || checks.TotalCount > 0
+
+	for _, s := range status.Statuses {
+		switch s.State {
+		case "failure", "error":
+			failures = append(failures, fmt.Sprintf("%s: %s", s.Context, s.Description))
+		case "pending":
+			state = ChecksPending
+		}
+	}
+
+	for _, run := range checks.CheckRuns {
+		if run.Status != "completed" {
+			state = ChecksPending
+			continue
+		}
+		switch run.Conclusion {
+		case "success", "neutral", "skipped":
+		default:
+			failures = append(failures, fmt.Sprintf("%s: %s", run.Name, run.Conclusion))
+		}
+	}
+
+	if len(failures) > 0 {
+		state = ChecksFailure
+	}
+	return state, failures, found, nil
+}
+
+// WaitForChecks polls the status checks of the current HEAD commit until they
+// complete or timeout elapses. It returns an error describing the failing
+// checks when they do not pass.
+func WaitForChecks(path string, githubToken string, timeout time.Duration) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	owner, repoName, err := getGitHubRepo(repo)
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %v", err)
+	}
+	sha := head.Hash().String()
+
+	start := time.Now()
+	for {
+		state, failures, found, err := getChecksState(owner, repoName, sha, githubToken)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case state == ChecksFailure:
+			return fmt.Errorf("checks failed for %s:\n%s", sha[:7], strings.Join(failures, "\n"))
+		// Checks can take a moment to register after a push, so only trust an
+		// empty result once the grace period is over
+		case state == ChecksSuccess && (found || time.Since(start) > checksGracePeriod):
+			return nil
+		}
+
+		if time.Since(start) > timeout {
+			return fmt.Errorf("timed out waiting for checks on %s", sha[:7])
+		}
+		time.Sleep(checksPollInterval)
+	}
+}
+
+// OpenPRs returns those of the given PR numbers that are still open on the
+// GitHub repository of the origin remote, in the order GitHub lists them.
+func OpenPRs(path string, githubToken string, numbers []int) ([]GitHubPRResponse, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	owner, repoName, err := getGitHubRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[int]bool, len(numbers))
+	for _, number := range numbers {
+		wanted[number] = true
+	}
+	var open []GitHubPRResponse
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls?state=open&per_page=100&page=%d", owner, repoName, page)
+		var prs []GitHubPRResponse
+		if err := githubRequest("GET", url, githubToken, nil, &prs); err != nil {
+			return nil, fmt.Errorf("error listing PRs: %v", err)
+		}
+		for _, pr := range prs {
+			if wanted[pr.Number] {
+				open = append(open, pr)
+			}
+		}
+		if len(prs) < 100 {
+			return open, nil
+		}
+	}
+}
+
+// EnableAutoMerge marks a GitWatcher PR as ready for review and asks GitHub to
+// merge it once required checks pass. If the repository does not allow
+// auto-merge, the checks are polled in the background and the PR is merged
+// through the REST API when they are green.
+func EnableAutoMerge(path string, pr *GitHubPRResponse, githubToken string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	owner, repoName, err := getGitHubRepo(repo)
+	if err != nil {
+		return err
+	}
+
+	if pr.Draft {
+		err = githubGraphQL(githubToken, `mutation($id: ID!) {
+			markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId }
+		}`, map[string]interface{}{"id": pr.NodeID}, nil)
+		if err != nil {
+			return fmt.Errorf("error marking PR ready for review: %v", err)
+		}
+	}
+
+	err = githubGraphQL(githubToken, `mutation($id: ID!) {
+		enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: MERGE}) { clientMutationId }
+	}`, map[string]interface{}{"id": pr.NodeID}, nil)
+	if err == nil {
+		slog.Info("Auto-merge enabled", "repo", path, "pr", pr.Number)
+		return nil
+	}
+
+	slog.Info("Unable to enable GitHub auto-merge, polling checks instead", "repo", path, "pr", pr.Number, "reason", err)
+	go mergeWhenChecksPass(owner, repoName, pr, githubToken)
+	return nil
+}
+
+func mergeWhenChecksPass(owner, repoName string, pr *GitHubPRResponse, githubToken string) {
+	start := time.Now()
+	deadline := start.Add(6 * time.Hour)
+	for time.Now().Before(deadline) {
+		state, _, found, err := getChecksState(owner, repoName, pr.Head.SHA, githubToken)
+		if err != nil {
+			slog.Warn("Error checking PR status", "repo", owner+"/"+repoName, "pr", pr.Number, "error", err)
+		}
+
+		switch {
+		case state == ChecksFailure:
+			slog.Warn("Checks failed, not merging", "repo", owner+"/"+repoName, "pr", pr.Number)
+			return
+		// As in WaitForChecks, the checks of a fresh PR may not have
+		// registered yet
+		case state == ChecksSuccess && (found || time.Since(start) > checksGracePeriod):
+			url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls/%d/merge", owner, repoName, pr.Number)
+			err := githubRequest("PUT", url, githubToken, map[string]string{
+				"sha":          pr.Head.SHA,
+				"merge_method": "merge",
+			}, nil)
+			if err != nil {
+				slog.Error("Error merging PR", "repo", owner+"/"+repoName, "pr", pr.Number, "error", err)
+				return
+			}
+			slog.Info("PR merged", "repo", owner+"/"+repoName, "pr", pr.Number)
+			return
+		}
+
+		time.Sleep(time.Minute)
+	}
+	slog.Warn("Timed out waiting for checks", "repo", owner+"/"+repoName, "pr", pr.Number)
+}
+
+// FailureIssueLabel labels the issues GitWatcher files about failing
+// repositories, so they can be found again.
+const FailureIssueLabel = "gitwatcher"
+
+// GitHubIssue is an issue of the GitHub REST API.
+type GitHubIssue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+}
+
+// findFailureIssue returns the open issue labeled FailureIssueLabel and
+// titled title on owner/repoName, nil when there is none.
+func findFailureIssue(owner, repoName, githubToken, title string) (*GitHubIssue, error) {
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues?state=open&labels=%s&per_page=100&page=%d",
+			owner, repoName, FailureIssueLabel, page)
+		var issues []GitHubIssue
+		if err := githubRequest("GET", url, githubToken, nil, &issues); err != nil {
+			return nil, fmt.Errorf("error listing issues: %v", err)
+		}
+		for i := range issues {
+			if issues[i].Title == title {
+				return &issues[i], nil
+			}
+		}
+		if len(issues) < 100 {
+			return nil, nil
+		}
+	}
+}
+
+// FileFailureIssue opens an issue titled title on the GitHub repository of
+// the origin remote, or replaces the body of the open one GitWatcher filed
+// with that title.
+func FileFailureIssue(path, githubToken, title, body string) (*GitHubIssue, error) {
+	owner, repoName, err := GitHubRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	issue, err := findFailureIssue(owner, repoName, githubToken, title)
+	if err != nil {
+		return nil, err
+	}
+
+	if issue != nil {
+		url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repoName, issue.Number)
+		if err := githubRequest("PATCH", url, githubToken, map[string]string{"body": body}, issue); err != nil {
+			return nil, fmt.Errorf("error updating issue: %v", err)
+		}
+		return issue, nil
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues", owner, repoName)
+	request := map[string]interface{}{"title": title, "body": body, "labels": []string{FailureIssueLabel}}
+	issue = &GitHubIssue{}
+	if err := githubRequest("POST", url, githubToken, request, issue); err != nil {
+		return nil, fmt.Errorf("error creating issue: %v", err)
+	}
+	return issue, nil
+}
+
+// CloseFailureIssue comments on and closes the open issue GitWatcher filed
+// with title. It returns nil when there is none.
+func CloseFailureIssue(path, githubToken, title, comment string) (*GitHubIssue, error) {
+	owner, repoName, err := GitHubRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	issue, err := findFailureIssue(owner, repoName, githubToken, title)
+	if err != nil || issue == nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d", owner, repoName, issue.Number)
+	if err := githubRequest("POST", url+"/comments", githubToken, map[string]string{"body": comment}, nil); err != nil {
+		return nil, fmt.Errorf("error commenting on issue: %v", err)
+	}
+	if err := githubRequest("PATCH", url, githubToken, map[string]string{"state": "closed"}, issue); err != nil {
+		return nil, fmt.Errorf("error closing issue: %v", err)
+	}
+	return issue, nil
+}
@@ -0,0 +1,33 @@
+package gitops
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// IgnoreMatcher returns a function reporting whether git ignores a path of
+// the worktree at path, given relative to it. The .git directory, the
+// .gitignore files, .git/info/exclude and the global excludes file of the
+// user are honored. It reads the ignore files once, call it again after
+// they change.
+func IgnoreMatcher(path string) (func(rel string, isDir bool) bool, error) {
+	patterns, err := gitignore.ReadPatterns(osfs.New(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if global, err := gitignore.LoadGlobalPatterns(osfs.New("/")); err == nil {
+		patterns = append(global, patterns...)
+	}
+	matcher := gitignore.NewMatcher(patterns)
+
+	return func(rel string, isDir bool) bool {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if parts[0] == ".git" {
+			return true
+		}
+		return matcher.Match(parts, isDir)
+	}, nil
+}
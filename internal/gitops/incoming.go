@@ -0,0 +1,95 @@
+package gitops
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// IncomingChanges describes the commits on the remote-tracking branch that
+// the local branch does not have yet, i.e. what a pull would bring in.
+type IncomingChanges struct {
+	Branch     string   `json:"branch"`
+	RemoteHash string   `json:"remoteHash"`
+	Count      int      `json:"count"`
+	Commits    []string `json:"commits"`
+	Summary    string   `json:"summary,omitempty"`
+}
+
+// GetIncomingChanges lists the commits of origin's copy of the current branch
+// that are not in HEAD. Call it after FetchRepository. It returns nil when
+// there is no remote-tracking branch.
+func GetIncomingChanges(path string) (*IncomingChanges, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting HEAD: %v", err)
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+	if err != nil {
+		return nil, nil
+	}
+
+	local, err := reachableCommits(repo, []plumbing.Hash{head.Hash()}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var incoming []*object.Commit
+	_, err = reachableCommits(repo, []plumbing.Hash{remoteRef.Hash()}, func(c *object.Commit) bool {
+		if _, ok := local[c.Hash]; ok {
+			return false
+		}
+		incoming = append(incoming, c)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(incoming, func(i, j int) bool {
+		return incoming[i].Committer.When.After(incoming[j].Committer.When)
+	})
+
+	changes := &IncomingChanges{
+		Branch:     head.Name().Short(),
+		RemoteHash: remoteRef.Hash().String(),
+		Count:      len(incoming),
+	}
+	for _, c := range incoming {
+		subject := strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0]
+		changes.Commits = append(changes.Commits, fmt.Sprintf("%s %s (%s)", c.Hash.String()[:7], subject, c.Author.Name))
+	}
+	return changes, nil
+}
+
+// SummarizeIncomingChanges asks the AI for a short summary of what the
+// incoming commits change.
+func SummarizeIncomingChanges(changes *IncomingChanges, aiService AIService) (string, error) {
+	if changes.Count == 0 {
+		return "", nil
+	}
+
+	prompt := "Summarize in two or three sentences what pulling the following upstream commits into the local branch " +
+		changes.Branch + " will bring in. Mention anything that may conflict with local work or needs attention.\n" +
+		"Do not include any other text." + languageInstructions(aiService) + "\n\n" +
+		"Commits:\n" + strings.Join(changes.Commits, "\n")
+
+	summary, err := generateText(prompt, aiService)
+	if err != nil {
+		return "", fmt.Errorf("error summarizing incoming changes: %v", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
@@ -0,0 +1,68 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Matches branch segments like fix/123-crash, 123_typo or issue-123
+	branchIssuePattern = regexp.MustCompile(`(?i)(?:^|/)(?:issue-|gh-)?(\d+)(?:[-_]|$)`)
+	// Matches #123 that is not part of a cross-repository reference or a URL
+	commitIssuePattern = regexp.MustCompile(`(?:^|[\s(\[])#(\d+)\b`)
+	// Matches references the description already closes
+	closingIssuePattern = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)\b`)
+)
+
+// findIssueReferences collects the issue numbers referenced by the branch name
+// and commit messages, in ascending order.
+func findIssueReferences(branch string, commits []string) []int {
+	found := make(map[int]struct{})
+
+	for _, m := range branchIssuePattern.FindAllStringSubmatch(branch, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			found[n] = struct{}{}
+		}
+	}
+
+	for _, commit := range commits {
+		for _, m := range commitIssuePattern.FindAllStringSubmatch(commit, -1) {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+				found[n] = struct{}{}
+			}
+		}
+	}
+
+	var issues []int
+	for n := range found {
+		issues = append(issues, n)
+	}
+	sort.Ints(issues)
+	return issues
+}
+
+// appendIssueLinks adds a "Fixes #N" line for every referenced issue the
+// description does not already close.
+func appendIssueLinks(description string, issues []int) string {
+	closed := make(map[int]struct{})
+	for _, m := range closingIssuePattern.FindAllStringSubmatch(description, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			closed[n] = struct{}{}
+		}
+	}
+
+	var lines []string
+	for _, n := range issues {
+		if _, ok := closed[n]; !ok {
+			lines = append(lines, fmt.Sprintf("Fixes #%d", n))
+		}
+	}
+	if len(lines) == 0 {
+		return description
+	}
+
+	return strings.TrimRight(description, "\n") + "\n\n" + strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,211 @@
+package gitops
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// commitMessageAttempts is how many messages are requested from the AI
+// before falling back to a message built from the changed files.
+const commitMessageAttempts = 3
+
+const maxSubjectLength = 72
+
+var (
+	codeFencePattern    = regexp.MustCompile("(?s)^```[a-zA-Z]*\\n?(.*?)\\n?```$")
+	messageLabelPattern = regexp.MustCompile(`(?i)^(suggested )?commit message:\s*`)
+)
+
+// generateValidCommitMessage requests a commit message with prompt, cleans
+// it up and re-prompts with the validation problem until it is usable.
+func generateValidCommitMessage(prompt string, changes *Changes, aiService AIService) (string, error) {
+	conventional := aiService.CommitFormat == CommitFormatConventional
+
+	message, err := generateText(prompt, aiService)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		message = cleanCommitMessage(message)
+		verr := validateCommitMessage(message)
+		if verr == nil && conventional {
+			verr = validateConventional(message)
+		}
+		if verr == nil {
+			return message, nil
+		}
+
+		if attempt == commitMessageAttempts {
+			slog.Warn("Generated commit message is still invalid, using fallback", "attempts", attempt, "error", verr)
+			return fallbackCommitMessage(message, changes, conventional), nil
+		}
+
+		slog.Info("Generated commit message is invalid, retrying", "error", verr)
+		message, err = generateText(rewriteMessagePrompt(message, verr, aiService), aiService)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func rewriteMessagePrompt(message string, problem error, aiService AIService) string {
+	prompt := "Rewrite the following commit message so it is a valid git commit message.\n" +
+		"Problem: " + problem.Error() + "\n" +
+		"The subject line must be at most 72 characters; an optional body follows after a blank line.\n" +
+		"Do not use markdown, code blocks or quotes."
+	if aiService.CommitFormat == CommitFormatConventional {
+		prompt += conventionalInstructions
+	}
+	return prompt + languageInstructions(aiService) +
+		"\nRespond with only the rewritten message.\n\n" + message
+}
+
+// cleanCommitMessage strips the code fences, quoting, labels and markdown
+// emphasis models tend to wrap messages in.
+func cleanCommitMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if m := codeFencePattern.FindStringSubmatch(message); m != nil {
+		message = strings.TrimSpace(m[1])
+	}
+	message = strings.Trim(message, "\"'`")
+	message = messageLabelPattern.ReplaceAllString(message, "")
+
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	lines[0] = strings.TrimSpace(strings.ReplaceAll(strings.Trim(lines[0], "\"'`"), "**", ""))
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateCommitMessage checks the structure git tooling expects: a short
+// plain-text subject, optionally followed by a blank line and a body.
+func validateCommitMessage(message string) error {
+	lines := strings.Split(message, "\n")
+	subject := lines[0]
+
+	switch {
+	case subject == "":
+		return fmt.Errorf("the subject line is empty")
+	case utf8.RuneCountInString(subject) > maxSubjectLength:
+		return fmt.Errorf("the subject is %d characters, the limit is %d", utf8.RuneCountInString(subject), maxSubjectLength)
+	case strings.HasPrefix(subject, "#") || strings.HasPrefix(subject, "- ") || strings.HasPrefix(subject, "* "):
+		return fmt.Errorf("the subject %q is formatted as markdown", subject)
+	case strings.Contains(message, "```"):
+		return fmt.Errorf("the message contains a code block")
+	case len(lines) > 1 && strings.TrimSpace(lines[1]) != "":
+		return fmt.Errorf("the subject must be a single line followed by a blank line")
+	}
+	return nil
+}
+
+// fallbackCommitMessage is used when the AI does not produce a valid message.
+// A Conventional Commits subject that is otherwise fine is reformatted,
+// anything else is replaced by a summary of the changed files.
+func fallbackCommitMessage(message string, changes *Changes, conventional bool) string {
+	if conventional && validateCommitMessage(message) == nil {
+		return reformatConventional(message)
+	}
+
+	subject := "Update " + describeFiles(changes.Files)
+	if conventional {
+		subject = "chore: update " + describeFiles(changes.Files)
+	}
+	return truncateSubject(subject)
+}
+
+func describeFiles(files []string) string {
+	switch len(files) {
+	case 0:
+		return "files"
+	case 1, 2, 3:
+		return strings.Join(files, ", ")
+	default:
+		return fmt.Sprintf("%s and %d other files", strings.Join(files[:2], ", "), len(files)-2)
+	}
+}
+
+// truncateSubject shortens subject to maxSubjectLength characters, counted
+// in runes so non-ASCII subjects are neither cut short nor split mid-rune.
+func truncateSubject(subject string) string {
+	runes := []rune(subject)
+	if len(runes) <= maxSubjectLength {
+		return subject
+	}
+	return strings.TrimSpace(string(runes[:maxSubjectLength-3])) + "..."
+}
+
+// generatePRTitle summarizes the whole branch in a single title line, rather
+// than describing the latest change like a commit message would.
+func generatePRTitle(changes *Changes, aiService AIService) (string, error) {
+	conventional := aiService.CommitFormat == CommitFormatConventional
+	if aiDisabled(aiService) {
+		return templatePRTitle(changes, conventional), nil
+	}
+
+	prompt := "Generate a title for a pull request that contains all of the following commits.\n" +
+		"Summarize the overall purpose of the branch instead of describing only the most recent change.\n" +
+		"Use the imperative mood, at most 72 characters (preferably under 60), and no trailing period.\n" +
+		"Respond with only the title, without quotes or markdown."
+	if conventional {
+		prompt += conventionalInstructions
+	}
+	prompt += languageInstructions(aiService) + "\n\n" +
+		"Commits:\n" + strings.Join(changes.Commits, "\n") + "\n\n" +
+		"Changed files:\n" + strings.Join(changes.Files, "\n")
+
+	title, err := generateText(prompt, aiService)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		title = cleanCommitMessage(title)
+		verr := validatePRTitle(title)
+		if verr == nil && conventional {
+			verr = validateConventional(title)
+		}
+		if verr == nil {
+			return title, nil
+		}
+
+		if attempt == commitMessageAttempts {
+			slog.Warn("Generated PR title is still invalid, using fallback", "attempts", attempt, "error", verr)
+			title = truncateSubject(strings.SplitN(title, "\n", 2)[0])
+			if conventional && validateConventional(title) != nil {
+				title = reformatConventional(title)
+			}
+			if title == "" {
+				title = fallbackCommitMessage("", changes, conventional)
+			}
+			return title, nil
+		}
+
+		slog.Info("Generated PR title is invalid, retrying", "error", verr)
+		rewrite := "Rewrite the following pull request title.\n" +
+			"Problem: " + verr.Error() + "\n" +
+			"The title must be a single line of at most 72 characters without a trailing period, quotes or markdown."
+		if conventional {
+			rewrite += conventionalInstructions
+		}
+		title, err = generateText(rewrite+languageInstructions(aiService)+
+			"\nRespond with only the rewritten title.\n\n"+title, aiService)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func validatePRTitle(title string) error {
+	if strings.Contains(title, "\n") {
+		return fmt.Errorf("the title spans several lines")
+	}
+	if strings.HasSuffix(title, ".") {
+		return fmt.Errorf("the title ends with a period")
+	}
+	return validateCommitMessage(title)
+}
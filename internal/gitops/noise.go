@@ -0,0 +1,70 @@
+package gitops
+
+import (
+	"path"
+	"strings"
+)
+
+// defaultNoisePaths are generated files that only distract the AI. Patterns
+// match the full path or the file name; a trailing slash matches a directory.
+var defaultNoisePaths = []string{
+	"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "npm-shrinkwrap.json",
+	"go.sum", "Cargo.lock", "poetry.lock", "Pipfile.lock", "composer.lock", "Gemfile.lock",
+	"*.min.js", "*.min.css", "*.map",
+	"node_modules/", "vendor/", "dist/",
+}
+
+// binaryExtensions identify binary files without reading them.
+var binaryExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".ico": true, ".webp": true, ".bmp": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".jar": true, ".exe": true, ".dll": true,
+	".so": true, ".dylib": true, ".woff": true, ".woff2": true, ".ttf": true, ".mp3": true, ".mp4": true,
+}
+
+// isNoisePath reports whether file matches the default or extra noise patterns.
+func isNoisePath(file string, extra []string) bool {
+	if binaryExtensions[strings.ToLower(path.Ext(file))] {
+		return true
+	}
+	for _, patterns := range [][]string{defaultNoisePaths, extra} {
+		for _, pattern := range patterns {
+			if matchNoisePattern(pattern, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchNoisePattern(pattern, file string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(file, pattern) || strings.Contains(file, "/"+pattern)
+	}
+	if matched, _ := path.Match(pattern, file); matched {
+		return true
+	}
+	matched, _ := path.Match(pattern, path.Base(file))
+	return matched
+}
+
+// splitNoise separates the files and diffs worth showing the AI from the
+// binary and noise files, which are only named.
+func splitNoise(changes *Changes, extra []string) (files []string, diffs []FileDiff, noise []string) {
+	binary := make(map[string]bool)
+	for _, d := range changes.Diffs {
+		if d.IsBinary || isNoisePath(d.Path, extra) {
+			binary[d.Path] = true
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, file := range changes.Files {
+		if binary[file] || isNoisePath(file, extra) {
+			noise = append(noise, file)
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, diffs, noise
+}
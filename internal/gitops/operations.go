@@ -1,16 +1,15 @@
 package gitops
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-git/go-git/v5"
@@ -28,10 +27,17 @@ type RepoStatus struct {
 	ChangedFiles  []string `json:"changedFiles"`
 	CurrentBranch string   `json:"currentBranch"`
 	IsClean       bool     `json:"isClean"`
+	// RecoveryBranches lists local branches holding commits that failed to push
+	RecoveryBranches []string `json:"recoveryBranches,omitempty"`
+	// HasCommits is false for a freshly initialized repository
+	HasCommits bool `json:"hasCommits"`
+	// HasRemote reports whether an origin remote is configured
+	HasRemote bool `json:"hasRemote"`
 }
 
 type OllamaRequest struct {
 	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
 	Messages []struct {
 		Role    string `json:"role"`
 		Content string `json:"content"`
@@ -42,7 +48,9 @@ type OllamaResponse struct {
 	Message struct {
 		Content string `json:"content"`
 	} `json:"message"`
-	Done bool `json:"done"`
+	Done            bool `json:"done"`
+	PromptEvalCount int  `json:"prompt_eval_count"`
+	EvalCount       int  `json:"eval_count"`
 }
 
 type GitHubPRRequest struct {
@@ -55,19 +63,32 @@ type GitHubPRRequest struct {
 }
 
 type GitHubPRResponse struct {
-	Number int `json:"number"`
+	Number  int    `json:"number"`
+	NodeID  string `json:"node_id"`
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+	Draft   bool   `json:"draft"`
+	Head    struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
 }
 
 type BranchChanges struct {
 	Files   []string
 	Commits []*object.Commit
 	Summary string
+	// MergeBase and Head delimit the commits of the branch
+	MergeBase *object.Commit
+	Head      *object.Commit
 }
 
 type Changes struct {
-	Files   []string
-	Commits []string
-	Summary string
+	Files      []string
+	Commits    []string
+	Summary    string
+	PRTemplate string
+	// Diffs are the unified diffs of the staged files
+	Diffs []FileDiff
 }
 
 type AIService struct {
@@ -75,9 +96,77 @@ type AIService struct {
 	Model  string
 	Type   string
 	APIKey string
+	// Command is the shell command of the exec service, see generateExecText
+	Command string
+	// PromptTemplate replaces the default commit message instructions.
+	// {{changes}} marks where the change summary is inserted.
+	PromptTemplate string
+	// CommitFormat is empty for free-form messages or CommitFormatConventional
+	CommitFormat string
+	// Language of generated commit messages and PR descriptions, empty for English
+	Language string
+	// DiffTokenBudget limits the diff included in prompts, see DefaultDiffTokenBudget
+	DiffTokenBudget int
+	// NoisePaths are patterns of files left out of prompts in addition to
+	// lockfiles and binaries
+	NoisePaths []string
+	// Timeout bounds every AI request, DefaultAITimeout when zero
+	Timeout time.Duration
+	// Context cancels outstanding AI requests, see WithContext
+	Context context.Context
+	// Progress receives the generated text as it is produced when set
+	Progress ProgressFunc
+	// OnUsage is called with the token usage of every successful AI request
+	OnUsage func(Usage)
+	// RedactSecrets replaces email addresses and API keys in prompts sent to
+	// cloud services
+	RedactSecrets bool
+	// RedactPatterns are regular expressions replaced in prompts sent to
+	// cloud services
+	RedactPatterns []string
+	// RedactPaths are patterns of files whose names and diffs are removed
+	// from prompts sent to cloud services
+	RedactPaths []string
+	// LocalOnly refuses to send prompts to cloud services
+	LocalOnly bool
+}
+
+type CommitOptions struct {
+	// Template wraps the generated message, see renderCommitTemplate
+	Template string
+	// Trailers are appended to every generated commit message
+	Trailers []string
+	// UpdateChangelog adds an AI-generated entry to CHANGELOG.md in the commit
+	UpdateChangelog bool
+	// IgnoreSymlinks leaves added, changed and removed symlinks uncommitted
+	IgnoreSymlinks bool
+	// IgnoreExecutableBit keeps the committed mode when only the executable bit flips
+	IgnoreExecutableBit bool
+	// IgnoreModeChanges skips files whose content is unchanged apart from their mode
+	IgnoreModeChanges bool
+	// SplitCommits lets the AI group the changes into several logical commits
+	SplitCommits bool
+	// ClassifyChanges prefixes messages with the feat/fix/docs/chore type of the change
+	ClassifyChanges bool
+	// Scopes limits the staged changes and prompts to some paths, see InScopes
+	Scopes []string
+	// CommitAreas makes one commit per area path, see areaGroups
+	CommitAreas []string
 }
 
-func GetRepoStatus(path string) (*RepoStatus, error) {
+type PROptions struct {
+	Labels []string
+	// SSHKeyPath authenticates the push of a head branch missing on the remote
+	SSHKeyPath string
+	// LabelChangeType adds the change type of the branch as a label
+	LabelChangeType bool
+	// RiskAssessment adds an AI rating of the riskiness of the diff to the body
+	RiskAssessment bool
+}
+
+// GetRepoStatus returns the status of the repository at path, considering
+// only the changes in scopes when there are any.
+func GetRepoStatus(path string, scopes []string) (*RepoStatus, error) {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
 		return nil, err
@@ -92,8 +181,9 @@ func GetRepoStatus(path string) (*RepoStatus, error) {
 	if err != nil {
 		return nil, err
 	}
+	status = scopeStatus(status, scopes)
 
-	head, err := repo.Head()
+	currentBranch, hasCommits, err := currentBranchName(repo)
 	if err != nil {
 		return nil, err
 	}
@@ -105,15 +195,23 @@ func GetRepoStatus(path string) (*RepoStatus, error) {
 		}
 	}
 
+	recoveryBranches, err := listRecoveryBranches(repo)
+	if err != nil {
+		return nil, err
+	}
+
 	return &RepoStatus{
-		HasChanges:    !status.IsClean(),
-		ChangedFiles:  changedFiles,
-		CurrentBranch: head.Name().Short(),
-		IsClean:       status.IsClean(),
+		HasChanges:       !status.IsClean(),
+		ChangedFiles:     changedFiles,
+		CurrentBranch:    currentBranch,
+		IsClean:          status.IsClean(),
+		RecoveryBranches: recoveryBranches,
+		HasCommits:       hasCommits,
+		HasRemote:        hasRemote(repo),
 	}, nil
 }
 
-func CommitChanges(path string, aiService AIService) error {
+func CommitChanges(path string, aiService AIService, opts CommitOptions) error {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
 		return err
@@ -129,39 +227,127 @@ func CommitChanges(path string, aiService AIService) error {
 		return err
 	}
 
-	if status.IsClean() {
+	if scopeStatus(status, opts.Scopes).IsClean() {
 		return nil
 	}
 
-	// Add all changes
-	_, err = w.Add(".")
+	before, err := repo.Storer.Index()
 	if err != nil {
 		return err
 	}
 
+	// Add all changes in the scopes
+	if err := stageChanges(w, opts.Scopes); err != nil {
+		return err
+	}
+
+	if opts.ignoresFileModes() {
+		if err := applyFileModeRules(repo, before, opts); err != nil {
+			return fmt.Errorf("error applying file mode rules: %v", err)
+		}
+		status, err := w.Status()
+		if err != nil {
+			return err
+		}
+		if !hasStagedChanges(status) {
+			return nil
+		}
+	}
+
 	changes, err := getChanges(repo)
 	if err != nil {
 		return err
 	}
+	changes.limitToScopes(opts.Scopes)
 
-	message, err := generateCommitMessage(changes, aiService)
+	if opts.UpdateChangelog {
+		if err := updateChangelog(w.Filesystem.Root(), changes, aiService); err != nil {
+			return err
+		}
+		if _, err := w.Add(changelogFile); err != nil {
+			return err
+		}
+	}
+
+	status, err = w.Status()
 	if err != nil {
 		return err
 	}
+	staged := stagedFiles(status)
 
-	_, err = w.Commit(message, &git.CommitOptions{
+	if len(opts.CommitAreas) > 0 && len(staged) > 1 {
+		groups := areaGroups(staged, opts.CommitAreas)
+		if opts.SplitCommits {
+			groups = splitAreaGroups(path, groups, changes, aiService)
+		}
+		if len(groups) > 1 {
+			return commitGroups(repo, changes, groups, aiService, opts)
+		}
+	} else if opts.SplitCommits && len(staged) > 1 {
+		groups, err := groupChanges(staged, changes, aiService)
+		if err != nil {
+			slog.Warn("Unable to split changes, committing them together", "repo", path, "error", err)
+		} else if len(groups) > 1 {
+			return commitGroups(repo, changes, groups, aiService, opts)
+		}
+	}
+
+	message, err := buildCommitMessage(repo, changes, staged, aiService, opts)
+	if err != nil {
+		return err
+	}
+	return commitIndex(w, message)
+}
+
+// buildCommitMessage generates the message for a commit of files, applying
+// the template and trailers of opts.
+func buildCommitMessage(repo *git.Repository, changes *Changes, files []string, aiService AIService, opts CommitOptions) (string, error) {
+	message, err := generateCommitMessage(changes, aiService)
+	if err != nil {
+		return "", err
+	}
+	if opts.ClassifyChanges {
+		message = applyChangeType(message, classifyChanges(changes, aiService))
+	}
+	if opts.Template != "" {
+		branch, _, err := currentBranchName(repo)
+		if err != nil {
+			return "", err
+		}
+		message = renderCommitTemplate(opts.Template, message, files, branch)
+	}
+	return appendTrailers(message, opts.Trailers), nil
+}
+
+// commitIndex commits the current index as GitWatcher.
+func commitIndex(w *git.Worktree, message string) error {
+	_, err := w.Commit(message, &git.CommitOptions{
 		Author: &object.Signature{
-			Name:  "GitWatcher",
-			Email: "gitwatcher@local",
+			Name:  gitWatcherName,
+			Email: gitWatcherEmail,
 			When:  time.Now(),
 		},
 	})
-
 	return err
 }
 
-func getSSHAuth() (*ssh.PublicKeys, error) {
-	sshPath := os.Getenv("SSH_KEY_PATH")
+// sshPassphrases maps SSH key paths, as configured, to their passphrases.
+var sshPassphrases atomic.Pointer[map[string]string]
+
+// SetSSHPassphrases sets the passphrases that decrypt encrypted SSH keys, by
+// the key path passed to the operations. The empty path is the default key.
+func SetSSHPassphrases(passphrases map[string]string) {
+	sshPassphrases.Store(&passphrases)
+}
+
+func getSSHAuth(sshPath string) (*ssh.PublicKeys, error) {
+	passphrase := ""
+	if passphrases := sshPassphrases.Load(); passphrases != nil {
+		passphrase = (*passphrases)[sshPath]
+	}
+	if sshPath == "" {
+		sshPath = os.Getenv("SSH_KEY_PATH")
+	}
 	if sshPath == "" {
 		// Default to standard SSH key location
 		homeDir, err := os.UserHomeDir()
@@ -171,21 +357,37 @@ func getSSHAuth() (*ssh.PublicKeys, error) {
 		sshPath = filepath.Join(homeDir, ".ssh", "id_rsa")
 	}
 
-	publicKeys, err := ssh.NewPublicKeysFromFile("git", sshPath, "")
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", sshPath, passphrase)
 	if err != nil {
 		return nil, fmt.Errorf("error loading SSH key: %v", err)
 	}
 	return publicKeys, nil
 }
 
-func PushChanges(path string) error {
+// ErrNonFastForward is returned when the remote branch has commits the local
+// branch does not contain and force pushing is disabled.
+var ErrNonFastForward = errors.New("non-fast-forward: the remote branch has diverged, " +
+	"integrate the remote changes or enable force push for this repository")
+
+type PushOptions struct {
+	SSHKeyPath string
+	// Force overwrites the remote branch, but only if it still matches the
+	// last fetched remote-tracking ref (--force-with-lease)
+	Force bool
+}
+
+func PushChanges(path string, opts PushOptions) error {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
 		return err
 	}
 
+	if !hasRemote(repo) {
+		return ErrNoRemote
+	}
+
 	// Get SSH authentication
-	auth, err := getSSHAuth()
+	auth, err := getSSHAuth(opts.SSHKeyPath)
 	if err != nil {
 		return fmt.Errorf("SSH authentication error: %v", err)
 	}
@@ -195,26 +397,51 @@ func PushChanges(path string) error {
 		return err
 	}
 
-	refSpecStr := fmt.Sprintf(
-		"+%s:refs/heads/%s",
+	refSpec := config.RefSpec(fmt.Sprintf(
+		"%s:refs/heads/%s",
 		currentBranch.Name().String(),
 		currentBranch.Name().Short(),
-	)
-	refSpec := config.RefSpec(refSpecStr)
-	log.Printf("Pushing %s", refSpec)
-	// Update push options to include SSH auth
-	return repo.Push(&git.PushOptions{
+	))
+	pushOptions := &git.PushOptions{
 		RemoteName: "origin",
 		RefSpecs:   []config.RefSpec{refSpec},
 		Auth:       auth,
-	})
+	}
+
+	if opts.Force {
+		// A lease needs a remote-tracking ref to compare against; without one
+		// the branch has never been fetched, so fall back to a safe push
+		trackingRef := plumbing.NewRemoteReferenceName("origin", currentBranch.Name().Short())
+		if _, err := repo.Reference(trackingRef, true); err == nil {
+			pushOptions.ForceWithLease = &git.ForceWithLease{}
+		} else {
+			slog.Info("No remote-tracking ref, pushing without force", "repo", path, "ref", trackingRef)
+		}
+	}
+
+	slog.Info("Pushing", "repo", path, "refspec", refSpec, "forceWithLease", pushOptions.ForceWithLease != nil)
+	err = repo.Push(pushOptions)
+	if err != nil && strings.Contains(err.Error(), "non-fast-forward") {
+		return fmt.Errorf("%w (%v)", ErrNonFastForward, err)
+	}
+	return err
 }
 
 func generateCommitMessage(changes *Changes, aiService AIService) (string, error) {
-	if aiService.Type == "gemini" {
-		return generateGeminiCommitMessage(changes, aiService)
+	conventional := aiService.CommitFormat == CommitFormatConventional
+	if aiDisabled(aiService) {
+		return templateCommitMessage(changes, conventional), nil
+	}
+
+	message, err := generateValidCommitMessage(commitMessagePrompt(changes, aiService), changes, aiService)
+	if err != nil && aiService.cancelled() {
+		return "", err
+	}
+	if err != nil {
+		slog.Warn("Error generating commit message, using template message", "error", err)
+		return templateCommitMessage(changes, conventional), nil
 	}
-	return generateOllamaCommitMessage(changes, aiService)
+	return message, nil
 }
 
 func CreateBranch(path string, branchName string) error {
@@ -248,13 +475,13 @@ func CheckoutBranch(path string, branchName string) error {
 	})
 }
 
-func FetchRepository(path string) error {
+func FetchRepository(path string, sshKeyPath string) error {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
 		return err
 	}
 
-	auth, err := getSSHAuth()
+	auth, err := getSSHAuth(sshKeyPath)
 	if err != nil {
 		return fmt.Errorf("SSH authentication error: %v", err)
 	}
@@ -276,6 +503,10 @@ func getBranchChanges(repo *git.Repository, currentBranch string, targetBranch s
 	}
 
 	targetRef, err := repo.Reference(plumbing.NewBranchReferenceName(targetBranch), true)
+	if err == plumbing.ErrReferenceNotFound {
+		// Nothing to compare against, e.g. a local repository without a main branch
+		return &BranchChanges{}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error getting target branch ref: %v", err)
 	}
@@ -296,7 +527,7 @@ func getBranchChanges(repo *git.Repository, currentBranch string, targetBranch s
 	var mergeBase *object.Commit
 
 	// First check if target is ancestor of current
-	isAncestor, err = currentCommit.IsAncestor(targetCommit)
+	isAncestor, err = targetCommit.IsAncestor(currentCommit)
 	if err != nil {
 		return nil, fmt.Errorf("error checking ancestry: %v", err)
 	}
@@ -305,7 +536,7 @@ func getBranchChanges(repo *git.Repository, currentBranch string, targetBranch s
 		mergeBase = targetCommit
 	} else {
 		// Then check if current is ancestor of target
-		isAncestor, err = targetCommit.IsAncestor(currentCommit)
+		isAncestor, err = currentCommit.IsAncestor(targetCommit)
 		if err != nil {
 			return nil, fmt.Errorf("error checking ancestry: %v", err)
 		}
@@ -367,94 +598,18 @@ func getBranchChanges(repo *git.Repository, currentBranch string, targetBranch s
 	}
 
 	return &BranchChanges{
-		Files:   filesList,
-		Commits: commits,
-		Summary: summary.String(),
+		Files:     filesList,
+		Commits:   commits,
+		Summary:   summary.String(),
+		MergeBase: mergeBase,
+		Head:      currentCommit,
 	}, nil
 }
 
-func generateGeminiCommitMessage(changes *Changes, aiService AIService) (string, error) {
-	prompt := fmt.Sprintf("Generate a concise commit message for the following changes\n"+
-		"no placeholders, explanation, or other text should be provided\n"+
-		"limit the message to 72 characters\n\n%s", formatChangesForPrompt(changes))
-
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(aiService.APIKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	defer client.Close()
-
-	geminiModel := client.GenerativeModel(aiService.Model)
-
-	resp, err := geminiModel.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return "", fmt.Errorf("failed to generate content: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response from Gemini API")
-	}
-
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return "", fmt.Errorf("unexpected response type from Gemini API")
-	}
-
-	return string(text), nil
-}
-
-func generateOllamaCommitMessage(changes *Changes, aiService AIService) (string, error) {
-	prompt := fmt.Sprintf("Generate a concise commit message for the following changes\n"+
-		"no placeholders, explanation, or other text should be provided\n"+
-		"limit the message to 72 characters\n\n%s", formatChangesForPrompt(changes))
-
-	req := OllamaRequest{
-		Model: aiService.Model,
-		Messages: []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		}{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := http.Post(aiService.Server+"/api/chat", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API error: %s", string(body))
-	}
-
-	var response OllamaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
-	}
-
-	return response.Message.Content, nil
-}
-
-func generateGeminiPRDescription(changes *Changes, aiService AIService) (string, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(aiService.APIKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to create Gemini client: %v", err)
+func generatePRDescription(changes *Changes, aiService AIService) (string, error) {
+	if aiDisabled(aiService) {
+		return templatePRDescription(changes), nil
 	}
-	defer client.Close()
-
-	geminiModel := client.GenerativeModel(aiService.Model)
 
 	prompt := fmt.Sprintf("Generate a detailed pull request description for the following changes:\n\nCommits:\n%s\n\nChanged files:\n%v\n\n"+
 		"The description should include:\n"+
@@ -466,195 +621,144 @@ func generateGeminiPRDescription(changes *Changes, aiService AIService) (string,
 		"Do not include any other text in the response.\n"+
 		"Do not include any placeholders in the response. It is expected to be a complete description.\n"+
 		"Provide the output as markdown, but do not wrap it in a code block.\n\n",
-		changes.Summary, changes.Files)
-
-	resp, err := geminiModel.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return "", fmt.Errorf("failed to generate content: %v", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response from Gemini API")
-	}
-
-	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
-	if !ok {
-		return "", fmt.Errorf("unexpected response type from Gemini API")
-	}
+		changes.Summary, changes.Files) + prTemplateInstructions(changes) + languageInstructions(aiService)
 
-	return string(text), nil
+	return generateText(prompt, aiService)
 }
 
-func generateOllamaPRDescription(changes *Changes, aiService AIService) (string, error) {
-	prompt := fmt.Sprintf("Generate a detailed pull request description for the following changes:\n\nCommits:\n%s\n\nChanged files:\n%v\n\n"+
-		"The description should include:\n"+
-		"1. A summary of the changes\n"+
-		"2. The motivation for the changes\n"+
-		"3. Any potential impact or breaking changes\n"+
-		"4. Testing instructions if applicable\n\n"+
-		"Format the response in markdown.\n"+
-		"Do not include any other text in the response.\n"+
-		"Do not include any placeholders in the response. It is expected to be a complete description.",
-		changes.Summary, changes.Files)
-
-	req := OllamaRequest{
-		Model: aiService.Model,
-		Messages: []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		}{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := http.Post(aiService.Server+"/api/chat", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama API error: %s", string(body))
-	}
-
-	var response OllamaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
-	}
-
-	return response.Message.Content, nil
+// PRDraft is the generated content of a pull request that has not been
+// submitted to GitHub yet.
+type PRDraft struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	// Type is the feat/fix/docs/chore type of the branch, if its commits have one
+	Type string `json:"type,omitempty"`
 }
 
-func generatePRTitle(changes *Changes, aiService AIService) (string, error) {
-	if aiService.Type == "gemini" {
-		return generateGeminiCommitMessage(changes, aiService)
+func CreateDraftPR(path string, aiService AIService, githubToken string, opts PROptions) (*GitHubPRResponse, error) {
+	if err := EnsurePRBranch(path, "main", opts.SSHKeyPath); err != nil {
+		return nil, err
 	}
-	return generateOllamaCommitMessage(changes, aiService)
-}
-
-func generatePRDescription(changes *Changes, aiService AIService) (string, error) {
-	if aiService.Type == "gemini" {
-		return generateGeminiPRDescription(changes, aiService)
+	draft, err := GeneratePRDraft(path, aiService, opts)
+	if err != nil {
+		return nil, err
 	}
-	return generateOllamaPRDescription(changes, aiService)
+	return submitPR(path, draft, githubToken, opts)
 }
 
-func CreateDraftPR(path string, aiService AIService, githubToken string) error {
+// GeneratePRDraft generates the title and description of a PR for the current
+// branch without creating it.
+func GeneratePRDraft(path string, aiService AIService, opts PROptions) (*PRDraft, error) {
 	repo, err := git.PlainOpen(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get current branch name
 	head, err := repo.Head()
 	if err != nil {
-		return fmt.Errorf("error getting HEAD: %v", err)
+		return nil, fmt.Errorf("error getting HEAD: %v", err)
 	}
 	currentBranch := strings.TrimPrefix(string(head.Name()), "refs/heads/")
 
-	// Get remote URL to extract owner and repo name
-	remote, err := repo.Remote("origin")
-	if err != nil {
-		return fmt.Errorf("error getting remote: %v", err)
-	}
-
-	remoteURL := remote.Config().URLs[0]
-	// Extract owner and repo from SSH URL format (git@github.com:owner/repo.git)
-	// or HTTPS URL format (https://github.com/owner/repo.git)
-	var owner, repoName string
-	if strings.Contains(remoteURL, "git@github.com:") {
-		parts := strings.Split(strings.TrimPrefix(remoteURL, "git@github.com:"), "/")
-		owner = parts[0]
-		repoName = strings.TrimSuffix(parts[1], ".git")
-	} else {
-		parts := strings.Split(strings.TrimPrefix(remoteURL, "https://github.com/"), "/")
-		owner = parts[0]
-		repoName = strings.TrimSuffix(parts[1], ".git")
-	}
-
 	// Get changes for PR content
 	changes, err := getChanges(repo)
 	if err != nil {
-		return fmt.Errorf("error getting changes: %v", err)
+		return nil, fmt.Errorf("error getting changes: %v", err)
 	}
 
-	log.Println("Starting PR generation")
+	slog.Debug("Starting PR generation", "repo", path)
 
 	// Generate PR title and description
 	prTitle, err := generatePRTitle(changes, aiService)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	prDescription, err := generatePRDescription(changes, aiService)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Printf("PR title: %s\nPR description: %s\n", prTitle, prDescription)
-	log.Println("PR generation complete")
+	prDescription = appendIssueLinks(prDescription, findIssueReferences(currentBranch, changes.Commits))
 
-	// Create PR request
-	prRequest := GitHubPRRequest{
-		Title:               prTitle,
-		Head:                currentBranch,
-		Base:                "main",
-		Body:                prDescription,
-		Draft:               true,
-		MaintainerCanModify: true,
+	if opts.RiskAssessment {
+		risk, err := assessRisk(repo, currentBranch, aiService)
+		if err != nil {
+			slog.Warn("Error assessing PR risk", "repo", path, "error", err)
+		} else if risk != "" {
+			prDescription = strings.TrimRight(prDescription, "\n") + "\n\n" + risk
+		}
 	}
 
-	if githubToken == "" {
-		return fmt.Errorf("GitHub token not provided in settings")
-	}
+	slog.Debug("PR generation complete", "repo", path, "title", prTitle, "description", prDescription)
 
-	// Create PR using GitHub API
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls", owner, repoName)
-	jsonData, err := json.Marshal(prRequest)
-	if err != nil {
-		return fmt.Errorf("error marshaling PR request: %v", err)
+	return &PRDraft{
+		Title: prTitle,
+		Head:  currentBranch,
+		Base:  "main",
+		Body:  prDescription,
+		Type:  branchChangeType(changes.Commits),
+	}, nil
+}
+
+// SubmitPR opens a draft PR on GitHub from a generated (and possibly edited)
+// draft.
+func SubmitPR(path string, draft *PRDraft, githubToken string, opts PROptions) (*GitHubPRResponse, error) {
+	if err := EnsurePRBranch(path, draft.Base, opts.SSHKeyPath); err != nil {
+		return nil, err
 	}
+	return submitPR(path, draft, githubToken, opts)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+func submitPR(path string, draft *PRDraft, githubToken string, opts PROptions) (*GitHubPRResponse, error) {
+	repo, err := git.PlainOpen(path)
 	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "token "+githubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Get remote URL to extract owner and repo name
+	owner, repoName, err := getGitHubRepo(repo)
 	if err != nil {
-		return fmt.Errorf("error making request: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("error creating PR: %s", string(body))
+	// Create PR request
+	prRequest := GitHubPRRequest{
+		Title:               draft.Title,
+		Head:                draft.Head,
+		Base:                draft.Base,
+		Body:                draft.Body,
+		Draft:               true,
+		MaintainerCanModify: true,
 	}
 
+	// Create PR using GitHub API
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pulls", owner, repoName)
 	var prResponse GitHubPRResponse
-	if err := json.NewDecoder(resp.Body).Decode(&prResponse); err != nil {
-		return fmt.Errorf("error decoding PR response: %v", err)
+	if err := githubRequest("POST", url, githubToken, prRequest, &prResponse); err != nil {
+		return nil, fmt.Errorf("error creating PR: %v", err)
 	}
 
 	// include the pr link in the response
 	prLink := fmt.Sprintf("https://github.com/%s/%s/pull/%d", owner, repoName, prResponse.Number)
-	log.Printf("PR created successfully: %s", prLink)
+	slog.Info("PR created", "repo", path, "url", prLink)
 
-	return nil
+	labels := opts.Labels
+	if opts.LabelChangeType && draft.Type != "" {
+		labels = append(append([]string{}, labels...), draft.Type)
+	}
+	if len(labels) > 0 {
+		labelsURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/labels", owner, repoName, prResponse.Number)
+		err := githubRequest("POST", labelsURL, githubToken, map[string][]string{"labels": labels}, nil)
+		if err != nil {
+			slog.Warn("Error adding labels to PR", "repo", path, "pr", prResponse.Number, "error", err)
+		}
+	}
+
+	return &prResponse, nil
 }
 
 func getChanges(repo *git.Repository) (*Changes, error) {
@@ -669,19 +773,28 @@ func getChanges(repo *git.Repository) (*Changes, error) {
 	}
 
 	var files []string
-	for file := range status {
+	for file, s := range status {
+		// Changes left unstaged by the file mode rules are not part of the commit
+		if s.Staging == git.Unmodified || s.Staging == git.Untracked {
+			continue
+		}
 		files = append(files, file)
 	}
 
-	head, err := repo.Head()
+	diffs, err := stagedDiffs(repo, files)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error computing diffs: %v", err)
 	}
 
-	currentBranch := head.Name().Short()
-	branchChanges, err := getBranchChanges(repo, currentBranch, "main")
-	if err != nil {
-		return nil, fmt.Errorf("error getting branch changes: %v", err)
+	// Before the first commit there is no history to include
+	branchChanges := &BranchChanges{}
+	if head, err := repo.Head(); err == nil {
+		branchChanges, err = getBranchChanges(repo, head.Name().Short(), "main")
+		if err != nil {
+			return nil, fmt.Errorf("error getting branch changes: %v", err)
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
 	}
 
 	// Convert commits to messages
@@ -702,20 +815,35 @@ func getChanges(repo *git.Repository) (*Changes, error) {
 	}
 
 	return &Changes{
-		Files:   files,
-		Commits: commits,
-		Summary: fmt.Sprintf("Changed files:\n%v\n\nCommits:\n%v", files, commits),
+		Files:      files,
+		Commits:    commits,
+		Summary:    fmt.Sprintf("Changed files:\n%v\n\nCommits:\n%v", files, commits),
+		PRTemplate: readPRTemplate(w.Filesystem.Root()),
+		Diffs:      diffs,
 	}, nil
 }
 
-func formatChangesForPrompt(changes *Changes) string {
-	return fmt.Sprintf("Changed files:\n%v\n\nRecent commits for context:\n%v",
-		strings.Join(changes.Files, "\n"),
+func formatChangesForPrompt(changes *Changes, aiService AIService) string {
+	files, diffs, noise := splitNoise(changes, aiService.NoisePaths)
+
+	prompt := fmt.Sprintf("Changed files:\n%v\n\nRecent commits for context:\n%v",
+		strings.Join(files, "\n"),
 		strings.Join(changes.Commits, "\n"))
+	if len(noise) > 0 {
+		prompt += "\n\nAlso changed (generated, lock or binary files, contents not shown):\n" + strings.Join(noise, "\n")
+	}
+	if diff := formatDiffs(diffs, aiService.DiffTokenBudget); diff != "" {
+		prompt += "\n\nDiff of the changes:\n" + diff
+	}
+	return prompt
 }
 
 func GetGeminiModels(apiKey string) ([]string, error) {
-	ctx := context.Background()
+	if AirGapped() {
+		return nil, ErrAirGapped
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), modelListTimeout)
+	defer cancel()
 	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
@@ -744,3 +872,33 @@ func GetGeminiModels(apiKey string) ([]string, error) {
 
 	return geminiModels, nil
 }
+
+// GetLastActivity returns the most recent commit time across all local branches.
+func GetLastActivity(path string) (time.Time, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	branches, err := repo.Branches()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var last time.Time
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		if commit.Committer.When.After(last) {
+			last = commit.Committer.When
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return last, nil
+}
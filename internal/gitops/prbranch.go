@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// NothingToPRError is returned instead of asking GitHub for a pull request
+// that it would reject because the head branch has nothing to merge.
+type NothingToPRError struct {
+	Head   string
+	Base   string
+	Reason string
+}
+
+func (e *NothingToPRError) Error() string {
+	return fmt.Sprintf("nothing to PR from %s into %s: %s", e.Head, e.Base, e.Reason)
+}
+
+// EnsurePRBranch verifies that the current branch can be opened as a pull
+// request against base. The branch is pushed when the remote does not have
+// it yet or is behind, and a NothingToPRError is returned when every commit
+// on it is already part of base.
+func EnsurePRBranch(path string, base string, sshKeyPath string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	if !hasRemote(repo) {
+		return ErrNoRemote
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %v", err)
+	}
+	branch := head.Name().Short()
+
+	if !head.Name().IsBranch() {
+		return &NothingToPRError{Head: head.Hash().String()[:7], Base: base, Reason: "HEAD is detached"}
+	}
+	if branch == base {
+		return &NothingToPRError{Head: branch, Base: base, Reason: "the current branch is the base branch"}
+	}
+
+	remoteRefs, err := listRemoteBranches(repo, sshKeyPath)
+	if err != nil {
+		return err
+	}
+
+	if remoteRefs[branch] != head.Hash() {
+		slog.Info("Branch is not up to date on origin, pushing before creating PR", "repo", path, "branch", branch)
+		if err := PushChanges(path, PushOptions{SSHKeyPath: sshKeyPath}); err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("error pushing %s: %v", branch, err)
+		}
+	}
+
+	baseHash, ok := remoteRefs[base]
+	if !ok {
+		return fmt.Errorf("base branch %s does not exist on origin", base)
+	}
+	if baseHash == head.Hash() {
+		return &NothingToPRError{Head: branch, Base: base, Reason: "the branches point to the same commit"}
+	}
+
+	// Only a base commit known locally can be compared; otherwise let GitHub decide
+	baseCommit, err := repo.CommitObject(baseHash)
+	if err != nil {
+		return nil
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	merged, err := headCommit.IsAncestor(baseCommit)
+	if err != nil {
+		return err
+	}
+	if merged {
+		return &NothingToPRError{Head: branch, Base: base, Reason: "all commits are already in the base branch"}
+	}
+	return nil
+}
+
+// listRemoteBranches returns the branch heads advertised by origin.
+func listRemoteBranches(repo *git.Repository, sshKeyPath string) (map[string]plumbing.Hash, error) {
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("error getting remote: %v", err)
+	}
+
+	auth, err := getSSHAuth(sshKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("SSH authentication error: %v", err)
+	}
+
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("error listing remote branches: %v", err)
+	}
+
+	branches := make(map[string]plumbing.Hash)
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			branches[ref.Name().Short()] = ref.Hash()
+		}
+	}
+	return branches, nil
+}
@@ -0,0 +1,170 @@
+package gitops
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// MessagePreview is what GitWatcher would generate for the current changes
+// of a repository.
+type MessagePreview struct {
+	// Files lists the files the commit would contain
+	Files   []string `json:"files"`
+	Message string   `json:"message,omitempty"`
+	// PR is the draft for the current branch, when requested
+	PR *PRDraft `json:"pr,omitempty"`
+}
+
+// memoryIndexStorer keeps the index in memory so changes can be staged
+// without writing .git/index.
+type memoryIndexStorer struct {
+	storage.Storer
+	index []byte
+}
+
+func newMemoryIndexStorer(s storage.Storer) (*memoryIndexStorer, error) {
+	idx, err := s.Index()
+	if err != nil {
+		return nil, err
+	}
+	m := &memoryIndexStorer{Storer: s}
+	return m, m.SetIndex(idx)
+}
+
+// Index returns a fresh copy on every call, like the filesystem storer.
+func (m *memoryIndexStorer) Index() (*index.Index, error) {
+	idx := &index.Index{Version: 2}
+	if err := index.NewDecoder(bytes.NewReader(m.index)).Decode(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (m *memoryIndexStorer) SetIndex(idx *index.Index) error {
+	var buf bytes.Buffer
+	if err := index.NewEncoder(&buf).Encode(idx); err != nil {
+		return err
+	}
+	m.index = buf.Bytes()
+	return nil
+}
+
+// stagePreview stages the changes of the repository at path like
+// CommitChanges would, but in an in-memory index. It returns the staged
+// repository, its changes and the staged files, or nil changes when there is
+// nothing to commit.
+func stagePreview(path string, opts CommitOptions) (*git.Repository, *Changes, []string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	storer, err := newMemoryIndexStorer(repo.Storer)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading index: %v", err)
+	}
+	repo, err = git.Open(storer, w.Filesystem)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	w, err = repo.Worktree()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	before, err := repo.Storer.Index()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := stageChanges(w, opts.Scopes); err != nil {
+		return nil, nil, nil, err
+	}
+	if opts.ignoresFileModes() {
+		if err := applyFileModeRules(repo, before, opts); err != nil {
+			return nil, nil, nil, fmt.Errorf("error applying file mode rules: %v", err)
+		}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	staged := stagedFiles(status)
+	if len(staged) == 0 {
+		return repo, nil, nil, nil
+	}
+
+	changes, err := getChanges(repo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	changes.limitToScopes(opts.Scopes)
+	return repo, changes, staged, nil
+}
+
+// PreviewCommitMessage generates the commit message for the current changes
+// of the repository at path without staging or committing anything. The
+// changelog is not updated and changes are never split. When pr is set, the
+// PR draft of the current branch is generated too.
+func PreviewCommitMessage(path string, aiService AIService, opts CommitOptions, prOpts PROptions, pr bool) (*MessagePreview, error) {
+	repo, changes, staged, err := stagePreview(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &MessagePreview{Files: []string{}}
+	if staged != nil {
+		preview.Files = staged
+	}
+	if changes != nil {
+		preview.Message, err = buildCommitMessage(repo, changes, staged, aiService, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pr {
+		preview.PR, err = GeneratePRDraft(path, aiService, prOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error generating PR draft: %v", err)
+		}
+	}
+	return preview, nil
+}
+
+// PromptPreview is the exact commit message prompt GitWatcher would send for
+// the current changes of a repository.
+type PromptPreview struct {
+	Files  []string `json:"files"`
+	Prompt string   `json:"prompt"`
+	// EstimatedTokens approximates the size of the prompt
+	EstimatedTokens int `json:"estimatedTokens"`
+}
+
+// PreviewPrompt builds the commit message prompt for the current changes of
+// the repository at path, after noise filtering and diff truncation, without
+// staging anything or contacting the AI.
+func PreviewPrompt(path string, aiService AIService, opts CommitOptions) (*PromptPreview, error) {
+	_, changes, staged, err := stagePreview(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		return &PromptPreview{Files: []string{}}, nil
+	}
+
+	prompt := commitMessagePrompt(changes, aiService)
+	return &PromptPreview{
+		Files:           staged,
+		Prompt:          prompt,
+		EstimatedTokens: len(prompt) / charsPerToken,
+	}, nil
+}
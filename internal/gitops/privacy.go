@@ -0,0 +1,116 @@
+package gitops
+
+import (
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// ErrLocalAIOnly is returned when a repository restricted to local AI would
+// send a prompt to a cloud service.
+var ErrLocalAIOnly = errors.New("repository is restricted to local AI, refusing to use a cloud AI service")
+
+const (
+	redactedText = "[REDACTED]"
+	redactedPath = "[REDACTED PATH]"
+)
+
+// secretPatterns match email addresses and common API key formats.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+}
+
+// secretAssignment matches assignments such as api_key = "..." or
+// password: ..., keeping the name so the AI still sees what changed.
+var secretAssignment = regexp.MustCompile(`(?i)((?:api[_-]?key|secret|token|password|passwd)["']?\s*[:=]+\s*["']?)[^\s"']+`)
+
+// isCloudService reports whether prompts sent to aiService leave the machine.
+func isCloudService(aiService AIService) bool {
+	return aiService.Type == "gemini" || aiService.Type == "openai"
+}
+
+// ValidateRedactPatterns checks that every pattern is a valid regular expression.
+func ValidateRedactPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactPrompt strips the diffs and names of the files matching
+// aiService.RedactPaths from prompt, then replaces email addresses, API keys
+// and the RedactPatterns of aiService.
+func redactPrompt(prompt string, aiService AIService) string {
+	if len(aiService.RedactPaths) > 0 {
+		prompt = redactPaths(prompt, aiService.RedactPaths)
+	}
+
+	if aiService.RedactSecrets {
+		for _, pattern := range secretPatterns {
+			prompt = pattern.ReplaceAllString(prompt, redactedText)
+		}
+		prompt = secretAssignment.ReplaceAllString(prompt, "${1}"+redactedText)
+	}
+
+	for _, expr := range aiService.RedactPatterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			slog.Warn("Skipping invalid redact pattern", "pattern", expr, "error", err)
+			continue
+		}
+		prompt = pattern.ReplaceAllString(prompt, redactedText)
+	}
+	return prompt
+}
+
+// redactPaths drops the diff sections of matching files and replaces their
+// names wherever they are mentioned.
+func redactPaths(prompt string, patterns []string) string {
+	matches := func(token string) bool {
+		token = strings.Trim(token, "\"'`()[],:;")
+		token = strings.TrimPrefix(strings.TrimPrefix(token, "a/"), "b/")
+		if token == "" {
+			return false
+		}
+		for _, pattern := range patterns {
+			if matchNoisePattern(pattern, token) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var out []string
+	skipping := false
+	for _, line := range strings.Split(prompt, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			fields := strings.Fields(line)
+			skipping = len(fields) >= 3 && matches(fields[2])
+			if skipping {
+				out = append(out, "diff of "+redactedPath+" omitted")
+				continue
+			}
+		}
+		if skipping {
+			continue
+		}
+
+		for _, field := range strings.Fields(line) {
+			if matches(field) {
+				line = strings.ReplaceAll(line, strings.Trim(field, "\"'`()[],:;"), redactedPath)
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
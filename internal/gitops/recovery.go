@@ -0,0 +1,110 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// RecoveryBranchPrefix namespaces the branches created for commits that could
+// not be pushed.
+const RecoveryBranchPrefix = "gitwatcher/recovery/"
+
+// PushChangesWithRetry retries PushChanges with a linear backoff, treating an
+// already up to date remote as success. Rejected non-fast-forward pushes are
+// not retried since they cannot succeed without intervention.
+func PushChangesWithRetry(path string, opts PushOptions, attempts int) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = PushChanges(path, opts)
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		if errors.Is(err, ErrNonFastForward) || errors.Is(err, ErrNoRemote) {
+			return err
+		}
+		slog.Warn("Push attempt failed", "repo", path, "attempt", attempt, "attempts", attempts, "error", err)
+		if attempt < attempts {
+			time.Sleep(time.Duration(attempt) * 10 * time.Second)
+		}
+	}
+	return err
+}
+
+// CreateRecoveryBranch points a new local branch at HEAD so commits that could
+// not be pushed survive a reset of the working branch. It returns an empty
+// name when HEAD is already present on the remote, and the existing recovery
+// branch when one already points at HEAD.
+func CreateRecoveryBranch(path string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("error getting HEAD: %v", err)
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+	if err == nil && remoteRef.Hash() == head.Hash() {
+		return "", nil
+	}
+
+	existing, err := recoveryBranchAt(repo, head.Name().Short(), head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("error listing recovery branches: %v", err)
+	}
+	if existing != "" {
+		return existing, nil
+	}
+
+	name := RecoveryBranchPrefix + head.Name().Short() + "-" + time.Now().Format("20060102-150405")
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), head.Hash())
+	if err := repo.Storer.SetReference(ref); err != nil {
+		return "", fmt.Errorf("error creating recovery branch: %v", err)
+	}
+
+	slog.Info("Created recovery branch", "repo", path, "branch", name, "commit", head.Hash().String()[:7])
+	return name, nil
+}
+
+func listRecoveryBranches(repo *git.Repository) ([]string, error) {
+	branches, err := repo.Branches()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().Short(), RecoveryBranchPrefix) {
+			names = append(names, ref.Name().Short())
+		}
+		return nil
+	})
+	return names, err
+}
+
+// recoveryBranchAt returns the recovery branch of branch pointing at hash, if
+// any, so failed pushes of the same commits share one branch.
+func recoveryBranchAt(repo *git.Repository, branch string, hash plumbing.Hash) (string, error) {
+	branches, err := repo.Branches()
+	if err != nil {
+		return "", err
+	}
+
+	prefix := RecoveryBranchPrefix + branch + "-"
+	name := ""
+	err = branches.ForEach(func(ref *plumbing.Reference) error {
+		if name == "" && ref.Hash() == hash && strings.HasPrefix(ref.Name().Short(), prefix) {
+			name = ref.Name().Short()
+		}
+		return nil
+	})
+	return name, err
+}
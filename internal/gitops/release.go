@@ -0,0 +1,197 @@
+package gitops
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type GitHubReleaseRequest struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	Body    string `json:"body"`
+	Draft   bool   `json:"draft"`
+}
+
+type GitHubReleaseResponse struct {
+	ID      int    `json:"id"`
+	HTMLURL string `json:"html_url"`
+}
+
+// CreateTag creates an annotated tag on HEAD.
+func CreateTag(path string, name string, message string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error getting HEAD: %v", err)
+	}
+
+	if message == "" {
+		message = name
+	}
+
+	_, err = repo.CreateTag(name, head.Hash(), &git.CreateTagOptions{
+		Tagger: &object.Signature{
+			Name:  gitWatcherName,
+			Email: gitWatcherEmail,
+			When:  time.Now(),
+		},
+		Message: message,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating tag %s: %v", name, err)
+	}
+	return nil
+}
+
+// PushTag pushes a single tag to origin.
+func PushTag(path string, name string, sshKeyPath string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	auth, err := getSSHAuth(sshKeyPath)
+	if err != nil {
+		return fmt.Errorf("SSH authentication error: %v", err)
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf("refs/tags/%s:refs/tags/%s", name, name))
+	slog.Info("Pushing", "repo", path, "refspec", refSpec)
+	err = repo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{refSpec},
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+// tagsByCommit maps commit hashes to the names of the tags pointing at them.
+func tagsByCommit(repo *git.Repository) (map[plumbing.Hash]string, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	byCommit := make(map[plumbing.Hash]string)
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		// Annotated tags point at a tag object rather than the commit
+		if tag, err := repo.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = commit.Hash
+		}
+		byCommit[hash] = ref.Name().Short()
+		return nil
+	})
+	return byCommit, err
+}
+
+// commitsSinceLastTag returns the messages of the commits on HEAD after the
+// most recent reachable tag, and that tag's name (empty if there is none).
+func commitsSinceLastTag(repo *git.Repository) ([]string, string, error) {
+	byCommit, err := tagsByCommit(repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting HEAD: %v", err)
+	}
+
+	cIter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var commits []string
+	var lastTag string
+	err = cIter.ForEach(func(c *object.Commit) error {
+		if name, ok := byCommit[c.Hash]; ok {
+			lastTag = name
+			return io.EOF
+		}
+		commits = append(commits, strings.TrimSpace(c.Message))
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	return commits, lastTag, nil
+}
+
+// GenerateReleaseNotes asks the AI for release notes covering the commits since
+// the last tag.
+func GenerateReleaseNotes(path string, tag string, aiService AIService) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+
+	commits, lastTag, err := commitsSinceLastTag(repo)
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("no commits since %s", lastTag)
+	}
+
+	since := "the beginning of the project"
+	if lastTag != "" {
+		since = lastTag
+	}
+
+	prompt := fmt.Sprintf("Generate release notes for version %s covering the changes since %s.\n"+
+		"Group the changes under headings such as Features, Fixes and Other changes, omitting empty groups.\n"+
+		"Format the response in markdown, but do not wrap it in a code block.\n"+
+		"Do not include any other text or placeholders in the response.\n\n"+
+		"Commits:\n%s", tag, since, strings.Join(commits, "\n"))
+
+	return generateText(prompt, aiService)
+}
+
+// CreateGitHubRelease publishes a release for an already pushed tag.
+func CreateGitHubRelease(path string, tag string, notes string, githubToken string) (*GitHubReleaseResponse, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repoName, err := getGitHubRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", owner, repoName)
+	var release GitHubReleaseResponse
+	err = githubRequest("POST", url, githubToken, GitHubReleaseRequest{
+		TagName: tag,
+		Name:    tag,
+		Body:    notes,
+	}, &release)
+	if err != nil {
+		return nil, fmt.Errorf("error creating release: %v", err)
+	}
+
+	slog.Info("Release created", "repo", path, "url", release.HTMLURL)
+	return &release, nil
+}
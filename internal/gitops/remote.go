@@ -0,0 +1,54 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrNoRemote is returned by operations that need the origin remote when the
+// repository does not have one.
+var ErrNoRemote = errors.New("no origin remote configured, add one to enable push and pull requests")
+
+func hasRemote(repo *git.Repository) bool {
+	_, err := repo.Remote("origin")
+	return err == nil
+}
+
+// currentBranchName returns the branch HEAD points to, which also works on an
+// unborn branch before the first commit. hasCommits is false in that case.
+func currentBranchName(repo *git.Repository) (name string, hasCommits bool, err error) {
+	head, err := repo.Head()
+	if err == nil {
+		return head.Name().Short(), true, nil
+	}
+	if err != plumbing.ErrReferenceNotFound {
+		return "", false, err
+	}
+
+	ref, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading HEAD: %v", err)
+	}
+	return ref.Target().Short(), false, nil
+}
+
+// AddRemote configures a new remote on the repository at path.
+func AddRemote(path string, name string, url string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: name,
+		URLs: []string{url},
+	})
+	if err != nil {
+		return fmt.Errorf("error adding remote %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// dependencyFiles are manifests and lockfiles whose changes alter dependencies.
+var dependencyFiles = map[string]bool{
+	"go.mod": true, "go.sum": true, "package.json": true, "package-lock.json": true, "yarn.lock": true,
+	"pnpm-lock.yaml": true, "requirements.txt": true, "pyproject.toml": true, "poetry.lock": true,
+	"Pipfile": true, "Pipfile.lock": true, "Cargo.toml": true, "Cargo.lock": true, "Gemfile": true,
+	"Gemfile.lock": true, "composer.json": true, "composer.lock": true, "pom.xml": true, "build.gradle": true,
+}
+
+// criticalPathMarkers flag paths that usually deserve a careful review.
+var criticalPathMarkers = []string{
+	"auth", "security", "crypto", "password", "secret", "migration", "payment",
+	".github/workflows/", "dockerfile", "deploy", "infra", "terraform",
+}
+
+// largeDeletion is the number of deleted lines in a file that counts as a
+// large deletion.
+const largeDeletion = 100
+
+// assessRisk rates the riskiness of the branch against main from its diff
+// statistics and returns a markdown "Risk assessment" section.
+func assessRisk(repo *git.Repository, branch string, aiService AIService) (string, error) {
+	branchChanges, err := getBranchChanges(repo, branch, "main")
+	if err != nil {
+		return "", err
+	}
+	if branchChanges.MergeBase == nil || len(branchChanges.Commits) == 0 {
+		return "", nil
+	}
+
+	patch, err := branchChanges.MergeBase.Patch(branchChanges.Head)
+	if err != nil {
+		return "", fmt.Errorf("error computing branch diff: %v", err)
+	}
+
+	signals := riskSignals(patch.Stats())
+	prompt := "Assess the risk of merging a pull request with the following changes.\n" +
+		"Consider touched critical paths, large deletions and dependency changes.\n" +
+		"Respond with a first line of the form \"Risk: Low\", \"Risk: Medium\" or \"Risk: High\", " +
+		"followed by at most five markdown bullet points explaining the rating.\n" +
+		"Do not include any other text or headings." + languageInstructions(aiService) + "\n\n" +
+		signals
+
+	assessment, err := generateText(prompt, aiService)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(assessment), "\n", 2)
+	section := "## Risk assessment\n\n**" + strings.Trim(strings.TrimSpace(lines[0]), "*") + "**\n"
+	if len(lines) > 1 {
+		section += "\n" + strings.TrimSpace(lines[1]) + "\n"
+	}
+	return section, nil
+}
+
+// riskSignals summarizes the diff statistics relevant to the risk rating.
+func riskSignals(stats object.FileStats) string {
+	var added, deleted int
+	var dependencies, critical, deletions []string
+	for _, stat := range stats {
+		added += stat.Addition
+		deleted += stat.Deletion
+
+		if dependencyFiles[path.Base(stat.Name)] {
+			dependencies = append(dependencies, stat.Name)
+		}
+		lower := strings.ToLower(stat.Name)
+		for _, marker := range criticalPathMarkers {
+			if strings.Contains(lower, marker) {
+				critical = append(critical, stat.Name)
+				break
+			}
+		}
+		if stat.Deletion >= largeDeletion {
+			deletions = append(deletions, fmt.Sprintf("%s (-%d lines)", stat.Name, stat.Deletion))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files changed, %d lines added, %d lines deleted\n", len(stats), added, deleted)
+	writeSignal(&b, "Dependency changes", dependencies)
+	writeSignal(&b, "Critical paths touched", critical)
+	writeSignal(&b, "Large deletions", deletions)
+	b.WriteString("\nPer-file changes:\n" + stats.String())
+	return b.String()
+}
+
+func writeSignal(b *strings.Builder, name string, items []string) {
+	if len(items) == 0 {
+		fmt.Fprintf(b, "%s: none\n", name)
+		return
+	}
+	fmt.Fprintf(b, "%s: %s\n", name, strings.Join(items, ", "))
+}
@@ -0,0 +1,124 @@
+package gitops
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// cleanScope returns scope without its trailing slash, "" for the whole
+// worktree.
+func cleanScope(scope string) string {
+	scope = strings.Trim(path.Clean(filepath.ToSlash(scope)), "/")
+	if scope == "." {
+		return ""
+	}
+	return scope
+}
+
+// InScopes reports whether file, relative to the worktree, is in one of the
+// scopes. Scopes limit GitWatcher to some paths of a repository, such as
+// "docs/" or "services/api/" in a monorepo. They are slash separated and
+// relative to the worktree, and an empty list covers all of it.
+func InScopes(file string, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	file = filepath.ToSlash(file)
+	for _, scope := range scopes {
+		scope = cleanScope(scope)
+		if scope == "" || file == scope || strings.HasPrefix(file, scope+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsScope reports whether the directory dir, relative to the
+// worktree, holds one of the scopes.
+func ContainsScope(dir string, scopes []string) bool {
+	dir = cleanScope(dir)
+	for _, scope := range scopes {
+		scope = cleanScope(scope)
+		if dir == "" || strings.HasPrefix(scope, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScopes rejects scopes, or commit areas, that are not relative paths
+// inside the worktree.
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		slashed := filepath.ToSlash(scope)
+		if strings.TrimSpace(scope) == "" || path.IsAbs(slashed) || filepath.IsAbs(scope) {
+			return fmt.Errorf("path %q must be relative to the repository", scope)
+		}
+		if cleaned := path.Clean(slashed); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("path %q is outside the repository", scope)
+		}
+	}
+	return nil
+}
+
+// scopeStatus returns the entries of status in the scopes.
+func scopeStatus(status git.Status, scopes []string) git.Status {
+	if len(scopes) == 0 {
+		return status
+	}
+	scoped := git.Status{}
+	for file, s := range status {
+		if InScopes(file, scopes) {
+			scoped[file] = s
+		}
+	}
+	return scoped
+}
+
+// stageChanges stages every change of the worktree in the scopes, like
+// git add --all limited to them.
+func stageChanges(w *git.Worktree, scopes []string) error {
+	if len(scopes) == 0 {
+		_, err := w.Add(".")
+		return err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+	for file, s := range scopeStatus(status, scopes) {
+		if s.Worktree == git.Unmodified {
+			continue
+		}
+		if _, err := w.Add(file); err != nil {
+			return fmt.Errorf("error staging %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// limitToScopes leaves the files and diffs outside the scopes out of
+// changes, so prompts only describe the scoped paths.
+func (c *Changes) limitToScopes(scopes []string) {
+	if len(scopes) == 0 {
+		return
+	}
+	var files []string
+	for _, file := range c.Files {
+		if InScopes(file, scopes) {
+			files = append(files, file)
+		}
+	}
+	var diffs []FileDiff
+	for _, diff := range c.Diffs {
+		if InScopes(diff.Path, scopes) {
+			diffs = append(diffs, diff)
+		}
+	}
+	c.Files, c.Diffs = files, diffs
+	c.Summary = fmt.Sprintf("Changed files:\n%v\n\nCommits:\n%v", files, c.Commits)
+}
@@ -0,0 +1,236 @@
+package gitops
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitGroup is one logical commit proposed by the AI.
+type commitGroup struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+}
+
+// groupChanges asks the AI to split the staged files into logical commits,
+// in the order they should be made. Files the AI leaves out are added to the
+// last group so nothing is lost.
+func groupChanges(files []string, changes *Changes, aiService AIService) ([]commitGroup, error) {
+	prompt := "Group the following changed files into logical commits, for example tests, docs, refactoring or a feature.\n" +
+		"Keep files that depend on each other in the same commit and order the commits so each one builds on the previous.\n" +
+		"Respond only with a JSON array of objects with a \"name\" and the \"files\" of each commit, " +
+		"using every file exactly once and without a code block.\n\n" +
+		formatChangesForPrompt(&Changes{Files: files, Commits: changes.Commits, Diffs: changes.Diffs}, aiService)
+
+	response, err := generateText(prompt, aiService)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in response")
+	}
+
+	var proposed []commitGroup
+	if err := json.Unmarshal([]byte(response[start:end+1]), &proposed); err != nil {
+		return nil, fmt.Errorf("error parsing commit groups: %v", err)
+	}
+
+	remaining := make(map[string]bool, len(files))
+	for _, file := range files {
+		remaining[file] = true
+	}
+
+	var groups []commitGroup
+	for _, group := range proposed {
+		var groupFiles []string
+		for _, file := range group.Files {
+			if remaining[file] {
+				groupFiles = append(groupFiles, file)
+				delete(remaining, file)
+			}
+		}
+		if len(groupFiles) > 0 {
+			groups = append(groups, commitGroup{Name: group.Name, Files: groupFiles})
+		}
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no usable commit groups in response")
+	}
+
+	for _, file := range files {
+		if remaining[file] {
+			groups[len(groups)-1].Files = append(groups[len(groups)-1].Files, file)
+		}
+	}
+	return groups, nil
+}
+
+// otherArea names the group of the files outside every commit area.
+const otherArea = "other"
+
+// areaGroups sorts files into one group per commit area, in the order of the
+// areas, then one for the files outside every area. Areas are paths such as
+// "apps/web/" or "docs/", matched like scopes, and a file goes to the first
+// area holding it.
+func areaGroups(files []string, areas []string) []commitGroup {
+	byArea := make(map[string][]string, len(areas))
+	var other []string
+	for _, file := range files {
+		area := ""
+		for _, a := range areas {
+			if InScopes(file, []string{a}) {
+				area = a
+				break
+			}
+		}
+		if area == "" {
+			other = append(other, file)
+		} else {
+			byArea[area] = append(byArea[area], file)
+		}
+	}
+
+	var groups []commitGroup
+	for _, area := range areas {
+		if len(byArea[area]) > 0 {
+			groups = append(groups, commitGroup{Name: area, Files: byArea[area]})
+			delete(byArea, area)
+		}
+	}
+	if len(other) > 0 {
+		groups = append(groups, commitGroup{Name: otherArea, Files: other})
+	}
+	return groups
+}
+
+// splitAreaGroups lets the AI split the changes of each area into logical
+// commits. Areas that cannot be split are committed together.
+func splitAreaGroups(path string, areas []commitGroup, changes *Changes, aiService AIService) []commitGroup {
+	var groups []commitGroup
+	for _, area := range areas {
+		if len(area.Files) < 2 {
+			groups = append(groups, area)
+			continue
+		}
+		split, err := groupChanges(area.Files, groupChangeSet(changes, area), aiService)
+		if err != nil {
+			slog.Warn("Unable to split changes, committing the area together", "repo", path, "area", area.Name, "error", err)
+			groups = append(groups, area)
+			continue
+		}
+		for _, group := range split {
+			groups = append(groups, commitGroup{Name: area.Name + " " + group.Name, Files: group.Files})
+		}
+	}
+	return groups
+}
+
+// commitGroups turns the staged index into one commit per group. Each commit
+// starts from HEAD and takes the staged version of its files, so the last
+// commit leaves exactly the staged tree behind.
+func commitGroups(repo *git.Repository, changes *Changes, groups []commitGroup, aiService AIService, opts CommitOptions) error {
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	staged, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	stagedEntries := make(map[string]*index.Entry, len(staged.Entries))
+	for _, e := range staged.Entries {
+		stagedEntries[e.Name] = e
+	}
+
+	entries, err := headEntries(repo, stagedEntries)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		for _, file := range group.Files {
+			if e, ok := stagedEntries[file]; ok {
+				entries[file] = e
+			} else {
+				delete(entries, file)
+			}
+		}
+
+		idx := &index.Index{Version: staged.Version}
+		for _, e := range entries {
+			idx.Entries = append(idx.Entries, e)
+		}
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			return err
+		}
+
+		message, err := buildCommitMessage(repo, groupChangeSet(changes, group), group.Files, aiService, opts)
+		if err != nil {
+			return err
+		}
+		if err := commitIndex(w, message); err != nil {
+			return err
+		}
+		slog.Info("Committed group", "group", group.Name, "files", len(group.Files))
+	}
+	return nil
+}
+
+// headEntries builds index entries for the HEAD tree, reusing the staged entry
+// of unchanged files so their cached file stats are kept.
+func headEntries(repo *git.Repository, staged map[string]*index.Entry) (map[string]*index.Entry, error) {
+	entries := make(map[string]*index.Entry)
+
+	head, err := repo.Head()
+	if err != nil {
+		// Unborn branch, the first commit starts from an empty tree
+		return entries, nil
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if e, ok := staged[f.Name]; ok && e.Hash == f.Hash && e.Mode == f.Mode {
+			entries[f.Name] = e
+		} else {
+			entries[f.Name] = &index.Entry{Name: f.Name, Hash: f.Hash, Mode: f.Mode}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// groupChangeSet restricts changes to the files of group.
+func groupChangeSet(changes *Changes, group commitGroup) *Changes {
+	inGroup := make(map[string]bool, len(group.Files))
+	for _, file := range group.Files {
+		inGroup[file] = true
+	}
+
+	subset := &Changes{
+		Files:      group.Files,
+		Commits:    changes.Commits,
+		PRTemplate: changes.PRTemplate,
+	}
+	for _, d := range changes.Diffs {
+		if inGroup[d.Path] {
+			subset.Diffs = append(subset.Diffs, d)
+		}
+	}
+	subset.Summary = fmt.Sprintf("Changed files:\n%v\n\nCommits:\n%v", subset.Files, subset.Commits)
+	return subset
+}
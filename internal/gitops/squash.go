@@ -0,0 +1,144 @@
+package gitops
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	gitWatcherName  = "GitWatcher"
+	gitWatcherEmail = "gitwatcher@local"
+)
+
+// SquashCommits replaces the GitWatcher commits at the tip of the current
+// branch since it diverged from baseBranch with a single commit carrying a
+// regenerated message, built from opts as CommitChanges builds its messages.
+// It stops at the first commit made by someone else, so human commits are
+// never rewritten. It returns the number of commits squashed; anything other
+// than 0 means the branch history was rewritten.
+func SquashCommits(path string, aiService AIService, baseBranch string, opts CommitOptions) (int, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return 0, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return 0, fmt.Errorf("error getting HEAD: %v", err)
+	}
+	if !head.Name().IsBranch() || head.Name().Short() == baseBranch {
+		return 0, nil
+	}
+
+	baseRef, err := repo.Reference(plumbing.NewBranchReferenceName(baseBranch), true)
+	if err != nil {
+		return 0, fmt.Errorf("error getting base branch ref: %v", err)
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return 0, err
+	}
+	baseCommit, err := repo.CommitObject(baseRef.Hash())
+	if err != nil {
+		return 0, err
+	}
+
+	bases, err := headCommit.MergeBase(baseCommit)
+	if err != nil {
+		return 0, fmt.Errorf("error finding merge base: %v", err)
+	}
+	if len(bases) == 0 {
+		return 0, fmt.Errorf("no common ancestor found between branches")
+	}
+	mergeBase := bases[0].Hash
+
+	// Walk back from HEAD over the run of GitWatcher commits
+	var squashed []*object.Commit
+	commit := headCommit
+	for commit.Hash != mergeBase && commit.Author.Email == gitWatcherEmail && commit.NumParents() == 1 {
+		squashed = append(squashed, commit)
+		commit, err = commit.Parent(0)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(squashed) < 2 {
+		return 0, nil
+	}
+	parent := commit
+
+	changes, err := squashChanges(parent, headCommit, squashed)
+	if err != nil {
+		return 0, err
+	}
+
+	message, err := buildCommitMessage(repo, changes, changes.Files, aiService, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	signature := object.Signature{Name: gitWatcherName, Email: gitWatcherEmail, When: now}
+	squash := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     headCommit.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := squash.Encode(obj); err != nil {
+		return 0, err
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash)); err != nil {
+		return 0, fmt.Errorf("error updating branch: %v", err)
+	}
+
+	slog.Info("Squashed GitWatcher commits", "repo", path, "commits", len(squashed), "branch", head.Name().Short(), "commit", hash.String()[:7])
+	return len(squashed), nil
+}
+
+// squashChanges describes the combined effect of the squashed commits.
+func squashChanges(parent, head *object.Commit, squashed []*object.Commit) (*Changes, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := head.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := parentTree.Diff(headTree)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, change := range diff {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		files = append(files, name)
+	}
+
+	var commits []string
+	for i := len(squashed) - 1; i >= 0; i-- {
+		commits = append(commits, squashed[i].Message)
+	}
+
+	return &Changes{Files: files, Commits: commits}, nil
+}
@@ -0,0 +1,144 @@
+package gitops
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Progress events reported while text is generated.
+const (
+	// ProgressStart is reported before every AI request
+	ProgressStart = "start"
+	// ProgressToken carries the next piece of generated text
+	ProgressToken = "token"
+)
+
+// ProgressFunc receives the progress of AI generation, see AIService.Progress.
+type ProgressFunc func(event string, text string)
+
+func streamOllamaText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	resp, err := ollamaChat(ctx, prompt, aiService, true)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	// Streamed responses are one JSON object per line
+	var text strings.Builder
+	var usage Usage
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var chunk OllamaResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			return "", Usage{}, err
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			aiService.Progress(ProgressToken, chunk.Message.Content)
+		}
+		if chunk.Done {
+			// Only the final chunk carries the token counts
+			usage = chunk.usage()
+			break
+		}
+	}
+	return text.String(), usage, nil
+}
+
+func streamOpenAIText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	model := aiService.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	resp, err := openAIDo(ctx, "POST", "/chat/completions", aiService.APIKey, map[string]interface{}{
+		"model":          model,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+	})
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			// Usage is only set on the last chunk, which has no choices
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", Usage{}, fmt.Errorf("error decoding response: %v", err)
+		}
+		if chunk.Usage != nil {
+			usage = Usage{PromptTokens: chunk.Usage.PromptTokens, CompletionTokens: chunk.Usage.CompletionTokens}
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			aiService.Progress(ProgressToken, chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", Usage{}, err
+	}
+	return text.String(), usage, nil
+}
+
+func streamGeminiText(ctx context.Context, prompt string, aiService AIService) (string, Usage, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(aiService.APIKey))
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	var text strings.Builder
+	var usage Usage
+	iter := client.GenerativeModel(aiService.Model).GenerateContentStream(ctx, genai.Text(prompt))
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", Usage{}, fmt.Errorf("failed to generate content: %v", err)
+		}
+		if resp.UsageMetadata != nil {
+			usage = geminiUsage(resp.UsageMetadata)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(genai.Text); ok {
+				text.WriteString(string(t))
+				aiService.Progress(ProgressToken, string(t))
+			}
+		}
+	}
+	return text.String(), usage, nil
+}
@@ -0,0 +1,101 @@
+package gitops
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prTemplatePaths are the locations GitHub reads pull request templates from.
+var prTemplatePaths = []string{
+	".github/PULL_REQUEST_TEMPLATE.md",
+	".github/pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+}
+
+// readPRTemplate returns the repository's pull request template, or an empty
+// string if it has none.
+func readPRTemplate(root string) string {
+	for _, p := range prTemplatePaths {
+		data, err := os.ReadFile(filepath.Join(root, p))
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+func prTemplateInstructions(changes *Changes) string {
+	if changes.PRTemplate == "" {
+		return ""
+	}
+	return "\n\nThe repository requires pull requests to follow the template below.\n" +
+		"Use its headings and sections as the structure of the description, in the same order, " +
+		"filling in every section instead of the structure listed above. " +
+		"Keep checklists from the template and only check items the changes satisfy.\n\n" +
+		"Template:\n" + changes.PRTemplate
+}
+
+const defaultCommitPrompt = "Generate a concise commit message for the following changes\n" +
+	"no placeholders, explanation, or other text should be provided\n" +
+	"limit the message to 72 characters\n\n{{changes}}"
+
+func commitMessagePrompt(changes *Changes, aiService AIService) string {
+	template := aiService.PromptTemplate
+	if template == "" {
+		template = defaultCommitPrompt
+	}
+	if !strings.Contains(template, "{{changes}}") {
+		template += "\n\n{{changes}}"
+	}
+	prompt := strings.ReplaceAll(template, "{{changes}}", formatChangesForPrompt(changes, aiService)) + languageInstructions(aiService)
+	if aiService.CommitFormat == CommitFormatConventional {
+		prompt += conventionalInstructions
+	}
+	return prompt
+}
+
+// languageInstructions asks for the response in the configured language.
+// Identifiers and format keywords stay as they are so the output can still be
+// validated and parsed.
+func languageInstructions(aiService AIService) string {
+	if aiService.Language == "" {
+		return ""
+	}
+	return "\n\nWrite the response in " + aiService.Language + ". " +
+		"Keep code identifiers, file names and format keywords such as commit types unchanged."
+}
+
+// renderCommitTemplate substitutes the placeholders of a commit message
+// template such as "[auto] {{summary}} ({{fileCount}} files)". {{summary}} is
+// the subject line written by the AI; any body it wrote follows the rendered
+// line. {{fileCount}}, {{files}}, {{branch}} and {{date}} describe the commit
+// itself.
+func renderCommitTemplate(template string, message string, files []string, branch string) string {
+	parts := strings.SplitN(strings.TrimSpace(message), "\n", 2)
+
+	result := strings.NewReplacer(
+		"{{summary}}", strings.TrimSpace(parts[0]),
+		"{{fileCount}}", strconv.Itoa(len(files)),
+		"{{files}}", strings.Join(files, ", "),
+		"{{branch}}", branch,
+		"{{date}}", time.Now().Format("2006-01-02"),
+	).Replace(template)
+
+	if len(parts) > 1 {
+		result += "\n" + parts[1]
+	}
+	return result
+}
+
+func appendTrailers(message string, trailers []string) string {
+	if len(trailers) == 0 {
+		return message
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + strings.Join(trailers, "\n") + "\n"
+}
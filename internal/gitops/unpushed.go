@@ -0,0 +1,113 @@
+package gitops
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxUnpushedListed caps the commits listed per branch in an unpushed report.
+const maxUnpushedListed = 20
+
+type UnpushedBranch struct {
+	Branch  string   `json:"branch"`
+	Count   int      `json:"count"`
+	Commits []string `json:"commits"`
+}
+
+// FindUnpushedCommits reports, for every local branch, the commits that are
+// not reachable from any remote-tracking ref, whoever authored them.
+func FindUnpushedCommits(path string) ([]UnpushedBranch, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	var remoteTips []plumbing.Hash
+	var branches []*plumbing.Reference
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch {
+		case ref.Name().IsRemote():
+			remoteTips = append(remoteTips, ref.Hash())
+		case ref.Name().IsBranch():
+			branches = append(branches, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pushed, err := reachableCommits(repo, remoteTips, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error walking remote history: %v", err)
+	}
+
+	var report []UnpushedBranch
+	for _, branch := range branches {
+		var commits []*object.Commit
+		_, err := reachableCommits(repo, []plumbing.Hash{branch.Hash()}, func(c *object.Commit) bool {
+			if _, ok := pushed[c.Hash]; ok {
+				return false
+			}
+			commits = append(commits, c)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking %s: %v", branch.Name().Short(), err)
+		}
+		if len(commits) == 0 {
+			continue
+		}
+
+		entry := UnpushedBranch{Branch: branch.Name().Short(), Count: len(commits)}
+		for i, c := range commits {
+			if i == maxUnpushedListed {
+				break
+			}
+			subject := strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0]
+			entry.Commits = append(entry.Commits, c.Hash.String()[:7]+" "+subject)
+		}
+		report = append(report, entry)
+	}
+
+	return report, nil
+}
+
+// reachableCommits walks the commit graph from tips. When visit is non-nil it
+// is called for every commit and returning false stops the walk below it.
+func reachableCommits(repo *git.Repository, tips []plumbing.Hash, visit func(*object.Commit) bool) (map[plumbing.Hash]struct{}, error) {
+	seen := make(map[plumbing.Hash]struct{})
+	queue := append([]plumbing.Hash{}, tips...)
+
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if visit != nil && !visit(commit) {
+			continue
+		}
+		queue = append(queue, commit.ParentHashes...)
+	}
+
+	return seen, nil
+}
@@ -0,0 +1,67 @@
+package gitops
+
+import (
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Usage is the token usage of a single AI request.
+type Usage struct {
+	Type             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// modelPrice is the cost in USD per million prompt and completion tokens.
+type modelPrice struct {
+	prompt     float64
+	completion float64
+}
+
+// modelPrices are the list prices of the cloud models, matched by the
+// longest model name prefix. Ollama models run locally and are free.
+var modelPrices = map[string]modelPrice{
+	"gpt-4o":           {2.50, 10.00},
+	"gpt-4o-mini":      {0.15, 0.60},
+	"gpt-4-turbo":      {10.00, 30.00},
+	"gpt-3.5-turbo":    {0.50, 1.50},
+	"gemini-1.5-flash": {0.075, 0.30},
+	"gemini-1.5-pro":   {1.25, 5.00},
+	"gemini-2.0-flash": {0.10, 0.40},
+	"gemini-pro":       {0.50, 1.50},
+}
+
+// EstimatedCost returns the approximate cost of u in USD, zero for local or
+// unknown models.
+func (u Usage) EstimatedCost() float64 {
+	if u.Type != "gemini" && u.Type != "openai" {
+		return 0
+	}
+
+	model := strings.TrimPrefix(u.Model, "models/")
+	if u.Type == "openai" && model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	var price modelPrice
+	matched := ""
+	for name, p := range modelPrices {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			price, matched = p, name
+		}
+	}
+	return (float64(u.PromptTokens)*price.prompt + float64(u.CompletionTokens)*price.completion) / 1e6
+}
+
+func (r OllamaResponse) usage() Usage {
+	return Usage{PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount}
+}
+
+func geminiUsage(metadata *genai.UsageMetadata) Usage {
+	if metadata == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: int(metadata.PromptTokenCount), CompletionTokens: int(metadata.CandidatesTokenCount)}
+}
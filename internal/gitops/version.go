@@ -0,0 +1,124 @@
+package gitops
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	BumpMajor = "major"
+	BumpMinor = "minor"
+	BumpPatch = "patch"
+)
+
+var (
+	semverPattern   = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)`)
+	breakingPattern = regexp.MustCompile(`^\w+(\(.*\))?!:`)
+)
+
+type VersionSuggestion struct {
+	CurrentVersion string   `json:"currentVersion"`
+	Bump           string   `json:"bump"`
+	NextVersion    string   `json:"nextVersion"`
+	Commits        []string `json:"commits"`
+}
+
+// SuggestVersion has the AI classify the commits since the last tag as a
+// major, minor or patch change and proposes the resulting version.
+func SuggestVersion(path string, aiService AIService) (*VersionSuggestion, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, lastTag, err := commitsSinceLastTag(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits since %s", lastTag)
+	}
+
+	prompt := "Classify the following changes for a semantic version bump.\n" +
+		"Answer major for breaking changes, minor for new backwards compatible features and patch for fixes or other changes.\n" +
+		"Respond with exactly one word: major, minor or patch.\n\n" +
+		"Commits:\n" + strings.Join(commits, "\n")
+
+	bump := ""
+	answer, err := generateText(prompt, aiService)
+	if err == nil {
+		bump = parseBump(answer)
+	}
+	if bump == "" {
+		// Fall back to conventional commit markers when the AI is unavailable
+		// or does not answer with a single bump type
+		bump = heuristicBump(commits)
+	}
+
+	next, err := bumpVersion(lastTag, bump)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VersionSuggestion{
+		CurrentVersion: lastTag,
+		Bump:           bump,
+		NextVersion:    next,
+		Commits:        commits,
+	}, nil
+}
+
+func parseBump(answer string) string {
+	answer = strings.ToLower(strings.Trim(strings.TrimSpace(answer), "`*.\"'"))
+	switch answer {
+	case BumpMajor, BumpMinor, BumpPatch:
+		return answer
+	}
+	return ""
+}
+
+func heuristicBump(commits []string) string {
+	bump := BumpPatch
+	for _, c := range commits {
+		subject := strings.SplitN(c, "\n", 2)[0]
+		if strings.Contains(c, "BREAKING CHANGE") || breakingPattern.MatchString(subject) {
+			return BumpMajor
+		}
+		if strings.HasPrefix(subject, "feat") {
+			bump = BumpMinor
+		}
+	}
+	return bump
+}
+
+// bumpVersion applies bump to the semantic version in tag. An empty tag starts
+// from v0.0.0.
+func bumpVersion(tag string, bump string) (string, error) {
+	if tag == "" {
+		tag = "v0.0.0"
+	}
+
+	m := semverPattern.FindStringSubmatch(tag)
+	if m == nil {
+		return "", fmt.Errorf("last tag %s is not a semantic version", tag)
+	}
+
+	major, _ := strconv.Atoi(m[2])
+	minor, _ := strconv.Atoi(m[3])
+	patch, _ := strconv.Atoi(m[4])
+
+	switch bump {
+	case BumpMajor:
+		major, minor, patch = major+1, 0, 0
+	case BumpMinor:
+		minor, patch = minor+1, 0
+	default:
+		patch++
+	}
+
+	return fmt.Sprintf("%s%d.%d.%d", m[1], major, minor, patch), nil
+}
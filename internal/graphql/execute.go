@@ -0,0 +1,387 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver returns the value of a root field from its arguments.
+type Resolver func(args map[string]interface{}) (interface{}, error)
+
+// FieldResolver returns the value of a computed field of parent.
+type FieldResolver func(parent interface{}, args map[string]interface{}) (interface{}, error)
+
+// Schema describes the queryable graph. The query fields are resolved by
+// Query; the fields of the values they return are the JSON fields of their
+// Go types, plus the computed fields registered in Fields under the name of
+// the type.
+type Schema struct {
+	Query  map[string]Resolver
+	Fields map[string]map[string]FieldResolver
+}
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Error is an error of a response, with the path of the field it concerns.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response is the result of a request. Data is nil when the request could
+// not be executed at all.
+type Response struct {
+	Data   *Object `json:"data"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Object holds the fields of a response object in query order.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+func (o *Object) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get returns the value of a field.
+func (o *Object) Get(key string) interface{} {
+	return o.values[key]
+}
+
+// MarshalJSON writes the fields in query order.
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type executor struct {
+	schema    *Schema
+	fragments map[string]*Fragment
+	variables map[string]interface{}
+	errors    []Error
+}
+
+// Execute runs a query against schema.
+func (s *Schema) Execute(req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	var op *Operation
+	for _, o := range doc.Operations {
+		if req.OperationName == "" && len(doc.Operations) > 1 {
+			return &Response{Errors: []Error{{Message: "operationName is required with several operations"}}}
+		}
+		if req.OperationName == "" || o.Name == req.OperationName {
+			op = o
+			break
+		}
+	}
+	if op == nil {
+		return &Response{Errors: []Error{{Message: fmt.Sprintf("unknown operation %s", req.OperationName)}}}
+	}
+	if op.Type != "query" {
+		return &Response{Errors: []Error{{Message: fmt.Sprintf("%s operations are not supported", op.Type)}}}
+	}
+
+	e := &executor{schema: s, fragments: doc.Fragments, variables: make(map[string]interface{})}
+	for _, def := range op.Variables {
+		if value, exists := req.Variables[def.Name]; exists {
+			e.variables[def.Name] = value
+		} else if def.HasDefault {
+			e.variables[def.Name] = def.Default
+		}
+	}
+
+	data := newObject()
+	for _, field := range e.collect(op.Selections) {
+		path := []interface{}{field.ResponseName()}
+		resolve, exists := s.Query[field.Name]
+		if field.Name == "__typename" {
+			data.set(field.ResponseName(), "Query")
+			continue
+		}
+		if !exists {
+			e.errors = append(e.errors, Error{Message: fmt.Sprintf("Cannot query field %q on type Query", field.Name), Path: path})
+			data.set(field.ResponseName(), nil)
+			continue
+		}
+		value, err := resolve(e.arguments(field.Arguments))
+		if err != nil {
+			e.errors = append(e.errors, Error{Message: err.Error(), Path: path})
+			data.set(field.ResponseName(), nil)
+			continue
+		}
+		data.set(field.ResponseName(), e.complete(reflect.ValueOf(value), field, path))
+	}
+	return &Response{Data: data, Errors: e.errors}
+}
+
+// collect flattens fragments and drops the fields skipped by directives.
+func (e *executor) collect(selections []Selection) []*Field {
+	var fields []*Field
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *Field:
+			if e.included(s.Directives) {
+				fields = append(fields, s)
+			}
+		case *InlineFragment:
+			if e.included(s.Directives) {
+				fields = append(fields, e.collect(s.Selections)...)
+			}
+		case *FragmentSpread:
+			if fragment, exists := e.fragments[s.Name]; exists && e.included(s.Directives) {
+				fields = append(fields, e.collect(fragment.Selections)...)
+			} else if !exists {
+				e.errors = append(e.errors, Error{Message: fmt.Sprintf("Unknown fragment %q", s.Name)})
+			}
+		}
+	}
+	return fields
+}
+
+func (e *executor) included(directives []Directive) bool {
+	for _, d := range directives {
+		value := e.resolveValue(d.Arguments["if"])
+		if d.Name == "skip" && value == true || d.Name == "include" && value != true {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) resolveValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Variable:
+		return e.variables[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.resolveValue(item)
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			object[k] = e.resolveValue(item)
+		}
+		return object
+	}
+	return value
+}
+
+// arguments resolves the variables of args, leaving out the arguments set
+// to variables that were not provided.
+func (e *executor) arguments(args map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		if v, ok := value.(Variable); ok {
+			if _, exists := e.variables[string(v)]; !exists {
+				continue
+			}
+		}
+		resolved[name] = e.resolveValue(value)
+	}
+	return resolved
+}
+
+// StringArg returns the string argument name, empty when it is absent.
+func StringArg(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case Enum:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("argument %s must be a string", name)
+}
+
+// IntArg returns the integer argument name, def when it is absent.
+func IntArg(args map[string]interface{}, name string, def int) (int, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		// Variables decoded from JSON
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s must be an integer", name)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// complete projects value on the selections of field.
+func (e *executor) complete(value reflect.Value, field *Field, path []interface{}) interface{} {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil
+	}
+
+	leaf := value.Type() == timeType || value.Kind() != reflect.Struct && value.Kind() != reflect.Slice &&
+		value.Kind() != reflect.Array && value.Kind() != reflect.Map
+	if leaf || value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+		if len(field.Selections) > 0 {
+			e.errors = append(e.errors, Error{Message: fmt.Sprintf("Field %q of type %s has no subfields", field.Name, typeName(value.Type())), Path: path})
+			return nil
+		}
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, value.Len())
+		for i := range list {
+			list[i] = e.complete(value.Index(i), field, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case reflect.Map:
+		if len(field.Selections) == 0 {
+			return value.Interface()
+		}
+		object := newObject()
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			name := fmt.Sprint(key.Interface())
+			object.set(name, e.complete(value.MapIndex(key), field, append(path[:len(path):len(path)], name)))
+		}
+		return object
+	}
+
+	if len(field.Selections) == 0 {
+		e.errors = append(e.errors, Error{Message: fmt.Sprintf("Field %q of type %s must have a selection of subfields", field.Name, typeName(value.Type())), Path: path})
+		return nil
+	}
+	return e.completeObject(value, field, path)
+}
+
+func (e *executor) completeObject(value reflect.Value, parent *Field, path []interface{}) *Object {
+	t := value.Type()
+	fields := jsonFields(t)
+	computed := e.schema.Fields[typeName(t)]
+	object := newObject()
+
+	for _, field := range e.collect(parent.Selections) {
+		fieldPath := append(path[:len(path):len(path)], field.ResponseName())
+		if field.Name == "__typename" {
+			object.set(field.ResponseName(), typeName(t))
+			continue
+		}
+		if resolve, exists := computed[field.Name]; exists {
+			result, err := resolve(value.Interface(), e.arguments(field.Arguments))
+			if err != nil {
+				e.errors = append(e.errors, Error{Message: err.Error(), Path: fieldPath})
+				object.set(field.ResponseName(), nil)
+				continue
+			}
+			object.set(field.ResponseName(), e.complete(reflect.ValueOf(result), field, fieldPath))
+			continue
+		}
+		index, exists := fields[field.Name]
+		if !exists {
+			e.errors = append(e.errors, Error{Message: fmt.Sprintf("Cannot query field %q on type %s", field.Name, typeName(t)), Path: fieldPath})
+			object.set(field.ResponseName(), nil)
+			continue
+		}
+		object.set(field.ResponseName(), e.complete(value.FieldByIndex(index), field, fieldPath))
+	}
+	return object
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+var jsonFieldsCache sync.Map
+
+// jsonFields maps the JSON names of the fields of struct type t, including
+// those of embedded structs, to their index. As in encoding/json, the fields
+// of t hide those of its embedded structs.
+func jsonFields(t reflect.Type) map[string][]int {
+	if cached, ok := jsonFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	var add func(t reflect.Type, index []int)
+	add = func(t reflect.Type, index []int) {
+		var embedded [][]int
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			fieldIndex := append(index[:len(index):len(index)], i)
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldIndex)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if _, exists := fields[name]; !exists {
+				fields[name] = fieldIndex
+			}
+		}
+		for _, fieldIndex := range embedded {
+			add(t.FieldByIndex(fieldIndex).Type, fieldIndex)
+		}
+	}
+	add(t, nil)
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
@@ -0,0 +1,459 @@
+// Package graphql executes read-only GraphQL queries over Go values. It
+// supports the query language needed by dashboards: fields, aliases,
+// arguments, variables, fragments, inline fragments and the @skip and
+// @include directives. Mutations, subscriptions and introspection are not
+// supported.
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Document is a parsed GraphQL request document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query of a document.
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []VariableDefinition
+	Selections []Selection
+}
+
+// VariableDefinition declares a variable of an operation.
+type VariableDefinition struct {
+	Name       string
+	Default    interface{}
+	HasDefault bool
+}
+
+// Selection is a *Field, *FragmentSpread or *InlineFragment.
+type Selection interface{}
+
+// Field selects a field, with its arguments and subfields.
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]interface{}
+	Directives []Directive
+	Selections []Selection
+}
+
+// ResponseName is the key of the field in the response.
+func (f *Field) ResponseName() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread includes a named fragment.
+type FragmentSpread struct {
+	Name       string
+	Directives []Directive
+}
+
+// InlineFragment includes its selections in place. Type conditions are
+// parsed but not checked.
+type InlineFragment struct {
+	Directives []Directive
+	Selections []Selection
+}
+
+// Fragment is a named set of selections.
+type Fragment struct {
+	Name       string
+	Selections []Selection
+}
+
+// Directive such as @skip(if: true).
+type Directive struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Variable refers to an operation variable in an argument value.
+type Variable string
+
+// Enum is an enum value in an argument, passed to resolvers as its name.
+type Enum string
+
+// SyntaxError reports where a document is malformed.
+type SyntaxError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	next   int
+}
+
+// Parse parses a GraphQL request document.
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	// The recursive descent panics with *SyntaxError to keep each rule short
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+	for p.peek().kind != tokenEOF {
+		switch t := p.peek(); {
+		case t.kind == tokenPunct && t.value == "{":
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: p.selectionSet()})
+		case t.kind == tokenName && t.value == "fragment":
+			fragment := p.fragment()
+			doc.Fragments[fragment.Name] = fragment
+		case t.kind == tokenName:
+			doc.Operations = append(doc.Operations, p.operation())
+		default:
+			p.fail(t, "unexpected %q", t.value)
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, &SyntaxError{Message: "no operation", Line: 1, Column: 1}
+	}
+	return doc, nil
+}
+
+func (p *parser) position(pos int) (line, column int) {
+	line = 1 + strings.Count(p.src[:pos], "\n")
+	return line, pos - strings.LastIndex(p.src[:pos], "\n")
+}
+
+func (p *parser) fail(t token, format string, args ...interface{}) {
+	line, column := p.position(t.pos)
+	panic(&SyntaxError{Message: fmt.Sprintf(format, args...), Line: line, Column: column})
+}
+
+func (p *parser) lex() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			p.tokens = append(p.tokens, token{tokenPunct, "...", i})
+			i += 3
+		case strings.ContainsRune("{}()[]:!$=@|&", rune(c)):
+			p.tokens = append(p.tokens, token{tokenPunct, string(c), i})
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(src) && (isNameStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{tokenName, src[start:i], start})
+		case c == '-' || isDigit(c):
+			start := i
+			kind := tokenInt
+			i++
+			for i < len(src) && (isDigit(src[i]) || strings.ContainsRune(".eE+-", rune(src[i]))) {
+				if !isDigit(src[i]) {
+					kind = tokenFloat
+				}
+				i++
+			}
+			p.tokens = append(p.tokens, token{kind, src[start:i], start})
+		case c == '"':
+			start := i
+			if strings.HasPrefix(src[i:], `"""`) {
+				end := strings.Index(src[i+3:], `"""`)
+				if end < 0 {
+					line, column := p.position(start)
+					return &SyntaxError{Message: "unterminated string", Line: line, Column: column}
+				}
+				p.tokens = append(p.tokens, token{tokenString, src[i+3 : i+3+end], start})
+				i += end + 6
+				continue
+			}
+			i++
+			for i < len(src) && src[i] != '"' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) || src[i] != '"' {
+				line, column := p.position(start)
+				return &SyntaxError{Message: "unterminated string", Line: line, Column: column}
+			}
+			value, err := strconv.Unquote(src[start : i+1])
+			if err != nil {
+				line, column := p.position(start)
+				return &SyntaxError{Message: "invalid string", Line: line, Column: column}
+			}
+			p.tokens = append(p.tokens, token{tokenString, value, start})
+			i++
+		default:
+			line, column := p.position(i)
+			return &SyntaxError{Message: fmt.Sprintf("unexpected character %q", c), Line: line, Column: column}
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokenEOF, pos: len(src)})
+	return nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) isPunct(value string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.value == value
+}
+
+func (p *parser) expectPunct(value string) {
+	if t := p.advance(); t.kind != tokenPunct || t.value != value {
+		p.fail(t, "expected %q, found %q", value, t.value)
+	}
+}
+
+func (p *parser) name() string {
+	t := p.advance()
+	if t.kind != tokenName {
+		p.fail(t, "expected a name, found %q", t.value)
+	}
+	return t.value
+}
+
+func (p *parser) operation() *Operation {
+	t := p.peek()
+	op := &Operation{Type: p.name()}
+	if op.Type != "query" && op.Type != "mutation" && op.Type != "subscription" {
+		p.fail(t, "unknown operation type %q", op.Type)
+	}
+	if p.peek().kind == tokenName {
+		op.Name = p.name()
+	}
+	if p.isPunct("(") {
+		p.advance()
+		for !p.isPunct(")") {
+			p.expectPunct("$")
+			def := VariableDefinition{Name: p.name()}
+			p.expectPunct(":")
+			p.typeRef()
+			if p.isPunct("=") {
+				p.advance()
+				def.Default = p.value(true)
+				def.HasDefault = true
+			}
+			p.directives()
+			op.Variables = append(op.Variables, def)
+		}
+		p.advance()
+	}
+	p.directives()
+	op.Selections = p.selectionSet()
+	return op
+}
+
+// typeRef skips a variable type: variables are coerced by the resolvers.
+func (p *parser) typeRef() {
+	if p.isPunct("[") {
+		p.advance()
+		p.typeRef()
+		p.expectPunct("]")
+	} else {
+		p.name()
+	}
+	if p.isPunct("!") {
+		p.advance()
+	}
+}
+
+func (p *parser) fragment() *Fragment {
+	p.name()
+	fragment := &Fragment{Name: p.name()}
+	if t := p.advance(); t.kind != tokenName || t.value != "on" {
+		p.fail(t, `expected "on", found %q`, t.value)
+	}
+	p.name()
+	p.directives()
+	fragment.Selections = p.selectionSet()
+	return fragment
+}
+
+func (p *parser) selectionSet() []Selection {
+	p.expectPunct("{")
+	var selections []Selection
+	for !p.isPunct("}") {
+		if p.peek().kind == tokenEOF {
+			p.fail(p.peek(), `expected "}"`)
+		}
+		selections = append(selections, p.selection())
+	}
+	p.advance()
+	if len(selections) == 0 {
+		p.fail(p.peek(), "empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) selection() Selection {
+	if p.isPunct("...") {
+		p.advance()
+		if t := p.peek(); t.kind == tokenName && t.value != "on" {
+			return &FragmentSpread{Name: p.name(), Directives: p.directives()}
+		}
+		if t := p.peek(); t.kind == tokenName && t.value == "on" {
+			p.advance()
+			p.name()
+		}
+		return &InlineFragment{Directives: p.directives(), Selections: p.selectionSet()}
+	}
+
+	field := &Field{Name: p.name()}
+	if p.isPunct(":") {
+		p.advance()
+		field.Alias, field.Name = field.Name, p.name()
+	}
+	field.Arguments = p.arguments()
+	field.Directives = p.directives()
+	if p.isPunct("{") {
+		field.Selections = p.selectionSet()
+	}
+	return field
+}
+
+func (p *parser) arguments() map[string]interface{} {
+	if !p.isPunct("(") {
+		return nil
+	}
+	p.advance()
+	args := make(map[string]interface{})
+	for !p.isPunct(")") {
+		name := p.name()
+		p.expectPunct(":")
+		args[name] = p.value(false)
+	}
+	p.advance()
+	return args
+}
+
+func (p *parser) directives() []Directive {
+	var directives []Directive
+	for p.isPunct("@") {
+		p.advance()
+		directives = append(directives, Directive{Name: p.name(), Arguments: p.arguments()})
+	}
+	return directives
+}
+
+// value parses an argument value. Variables are not allowed in constant
+// values such as variable defaults.
+func (p *parser) value(constant bool) interface{} {
+	t := p.advance()
+	switch t.kind {
+	case tokenInt:
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			p.fail(t, "invalid integer %s", t.value)
+		}
+		return n
+	case tokenFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			p.fail(t, "invalid number %s", t.value)
+		}
+		return f
+	case tokenString:
+		return t.value
+	case tokenName:
+		switch t.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return Enum(t.value)
+	case tokenPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				p.fail(t, "variables are not allowed here")
+			}
+			return Variable(p.name())
+		case "[":
+			list := []interface{}{}
+			for !p.isPunct("]") {
+				list = append(list, p.value(constant))
+			}
+			p.advance()
+			return list
+		case "{":
+			object := map[string]interface{}{}
+			for !p.isPunct("}") {
+				name := p.name()
+				p.expectPunct(":")
+				object[name] = p.value(constant)
+			}
+			p.advance()
+			return object
+		}
+	}
+	p.fail(t, "unexpected %q", t.value)
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package push sends notifications through the push services popular with
+// self-hosters: ntfy, Gotify and Pushover.
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitwatcher/internal/gitops"
+)
+
+// PushoverURL is the message endpoint of the Pushover API.
+const PushoverURL = "https://api.pushover.net/1/messages.json"
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Message is a notification. Urgent messages are sent with a high priority,
+// which makes phones ring even with notifications muted on some services.
+type Message struct {
+	Title  string
+	Body   string
+	Urgent bool
+}
+
+// Ntfy publishes m to the ntfy topic at topicURL, such as
+// https://ntfy.sh/my-topic. token is only needed by protected topics.
+func Ntfy(ctx context.Context, topicURL, token string, m Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topicURL, strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	if m.Urgent {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return send(req)
+}
+
+// Gotify sends m to the Gotify server at serverURL with an application
+// token.
+func Gotify(ctx context.Context, serverURL, token string, m Message) error {
+	priority := 5
+	if m.Urgent {
+		priority = 8
+	}
+	body, err := json.Marshal(map[string]interface{}{"title": m.Title, "message": m.Body, "priority": priority})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(serverURL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	return send(req)
+}
+
+// Pushover sends m to the devices of a Pushover user through an
+// application.
+func Pushover(ctx context.Context, userKey, appToken string, m Message) error {
+	form := url.Values{
+		"token":   {appToken},
+		"user":    {userKey},
+		"title":   {m.Title},
+		"message": {m.Body},
+	}
+	if m.Urgent {
+		form.Set("priority", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, PushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return send(req)
+}
+
+// send sends req and turns responses other than 2xx into errors, leaving
+// out the URL, which may hold a secret topic. Nothing is sent in air-gapped
+// mode.
+func send(req *http.Request) error {
+	if gitops.AirGapped() {
+		return gitops.ErrAirGapped
+	}
+	resp, err := client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if detail := strings.TrimSpace(string(body)); detail != "" {
+			return fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, detail)
+		}
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
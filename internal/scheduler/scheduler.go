@@ -1,8 +1,12 @@
 package scheduler
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -11,12 +15,26 @@ type Task struct {
 	ID       cron.EntryID
 	Schedule string
 	Action   func()
+	// LastRun is when the task last started and LastDuration how long it
+	// took, zero until then
+	LastRun      time.Time
+	LastDuration time.Duration
+}
+
+// TaskInfo describes a scheduled task.
+type TaskInfo struct {
+	Key            string    `json:"key"`
+	Schedule       string    `json:"schedule"`
+	Next           time.Time `json:"next"`
+	LastRun        time.Time `json:"lastRun"`
+	LastDurationMs int64     `json:"lastDurationMs,omitempty"`
 }
 
 type Scheduler struct {
 	cron  *cron.Cron
 	tasks map[string]*Task
 	mu    sync.RWMutex
+	onRun func(key string, started time.Time, duration time.Duration)
 }
 
 func NewScheduler() *Scheduler {
@@ -26,42 +44,141 @@ func NewScheduler() *Scheduler {
 	}
 }
 
+// ValidateSchedule checks that schedule is a cron expression the scheduler
+// accepts.
+func ValidateSchedule(schedule string) error {
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid cron schedule: %v", err)
+	}
+	return nil
+}
+
+// Interval returns the time between the next two runs of schedule, which is
+// the period of regular schedules.
+func Interval(schedule string) (time.Duration, error) {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron schedule: %v", err)
+	}
+	next := sched.Next(time.Now())
+	return sched.Next(next).Sub(next), nil
+}
+
 func (s *Scheduler) Start() {
 	s.cron.Start()
 }
 
-func (s *Scheduler) Stop() {
-	s.cron.Stop()
+// Stop stops scheduling new runs. The returned context is done once the
+// tasks that are running have finished.
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
+}
+
+// Heartbeat calls beat every interval from the scheduler, without the
+// logging of tasks, so beats stop if the scheduler stops running tasks.
+func (s *Scheduler) Heartbeat(interval time.Duration, beat func()) {
+	s.cron.Schedule(cron.Every(interval), cron.FuncJob(beat))
 }
 
 func (s *Scheduler) AddTask(key string, schedule string, action func()) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Remove existing task if it exists
+	// Remove existing task if it exists, keeping when it last ran
+	task := &Task{Schedule: schedule, Action: action}
 	if existingTask, exists := s.tasks[key]; exists {
 		s.cron.Remove(existingTask.ID)
 		delete(s.tasks, key)
+		task.LastRun, task.LastDuration = existingTask.LastRun, existingTask.LastDuration
 	}
 
 	id, err := s.cron.AddFunc(schedule, func() {
-		log.Printf("Running scheduled task for %s", key)
+		start := time.Now()
+		slog.Info("Running scheduled task", "task", key)
 		action()
+		duration := time.Since(start)
+		slog.Info("Scheduled task finished", "task", key, "duration", duration)
+
+		s.mu.Lock()
+		task.LastRun, task.LastDuration = start, duration
+		onRun := s.onRun
+		s.mu.Unlock()
+		if onRun != nil {
+			onRun(key, start, duration)
+		}
 	})
 
 	if err != nil {
 		return err
 	}
 
-	s.tasks[key] = &Task{
-		ID:       id,
-		Schedule: schedule,
-		Action:   action,
-	}
+	task.ID = id
+	s.tasks[key] = task
 
 	return nil
 }
 
+// OnRun sets a function called after every run of a task, to persist when
+// tasks ran.
+func (s *Scheduler) OnRun(fn func(key string, started time.Time, duration time.Duration)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRun = fn
+}
+
+// SetLastRun records a run of the task key that happened before a restart.
+func (s *Scheduler) SetLastRun(key string, started time.Time, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if task, exists := s.tasks[key]; exists {
+		task.LastRun, task.LastDuration = started, duration
+	}
+}
+
+// Tasks lists the scheduled tasks sorted by key.
+func (s *Scheduler) Tasks() []TaskInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tasks := make([]TaskInfo, 0, len(s.tasks))
+	for key, task := range s.tasks {
+		tasks = append(tasks, s.info(key, task))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Key < tasks[j].Key })
+	return tasks
+}
+
+// Task describes the task key, if there is one.
+func (s *Scheduler) Task(key string) (TaskInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	task, exists := s.tasks[key]
+	if !exists {
+		return TaskInfo{}, false
+	}
+	return s.info(key, task), true
+}
+
+// info describes task. The caller must hold s.mu.
+func (s *Scheduler) info(key string, task *Task) TaskInfo {
+	return TaskInfo{
+		Key:            key,
+		Schedule:       task.Schedule,
+		Next:           s.cron.Entry(task.ID).Next,
+		LastRun:        task.LastRun,
+		LastDurationMs: task.LastDuration.Milliseconds(),
+	}
+}
+
+// Schedule returns the schedule of the task key, empty when there is none.
+func (s *Scheduler) Schedule(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if task, exists := s.tasks[key]; exists {
+		return task.Schedule
+	}
+	return ""
+}
+
 func (s *Scheduler) RemoveTask(key string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -74,4 +191,4 @@ func (s *Scheduler) RemoveTask(key string) {
 
 func (s *Scheduler) UpdateTask(key string, schedule string, action func()) error {
 	return s.AddTask(key, schedule, action)
-}
\ No newline at end of file
+}
@@ -0,0 +1,23 @@
+package secrets
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+)
+
+var platformUUID = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+
+// MachineID returns an identifier of the machine that is stable across
+// reboots, to derive a key from when no passphrase is given.
+func MachineID() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+	m := platformUUID.FindSubmatch(out)
+	if m == nil {
+		return "", errors.New("no IOPlatformUUID in ioreg output")
+	}
+	return string(m[1]), nil
+}
@@ -0,0 +1,20 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// MachineID returns an identifier of the machine that is stable across
+// reboots, to derive a key from when no passphrase is given.
+func MachineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id, nil
+			}
+		}
+	}
+	return "", errors.New("no machine ID in /etc/machine-id")
+}
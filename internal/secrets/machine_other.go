@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package secrets
+
+import "errors"
+
+// MachineID is not supported on this platform, a passphrase is required.
+func MachineID() (string, error) {
+	return "", errors.New("no machine ID on this platform")
+}
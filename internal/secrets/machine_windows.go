@@ -0,0 +1,17 @@
+package secrets
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// MachineID returns an identifier of the machine that is stable across
+// reboots, to derive a key from when no passphrase is given.
+func MachineID() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	id, _, err := key.GetStringValue("MachineGuid")
+	return id, err
+}
@@ -0,0 +1,119 @@
+// Package secrets encrypts short strings such as tokens with AES-GCM under a
+// key derived from a passphrase with scrypt, so they can be stored in files
+// that may leak, such as config backups.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// prefix marks sealed values: the salt, nonce and ciphertext follow, base64
+// encoded.
+const prefix = "enc:v1:"
+
+const saltSize = 16
+
+// ErrWrongKey is returned when a value was sealed under another passphrase,
+// or was tampered with.
+var ErrWrongKey = errors.New("wrong key or corrupted value")
+
+// Box seals and opens values under one passphrase. Keys are derived once per
+// salt: new values share the salt of the box, values sealed by other runs
+// carry their own.
+type Box struct {
+	passphrase []byte
+	salt       []byte
+
+	mu   sync.Mutex
+	keys map[string]cipher.AEAD
+}
+
+// New returns a box for passphrase.
+func New(passphrase []byte) (*Box, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &Box{passphrase: passphrase, salt: salt, keys: make(map[string]cipher.AEAD)}, nil
+}
+
+// IsSealed reports whether value was returned by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func (b *Box) aead(salt []byte) (cipher.AEAD, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if aead, exists := b.keys[string(salt)]; exists {
+		return aead, nil
+	}
+	key, err := scrypt.Key(b.passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	b.keys[string(salt)] = aead
+	return aead, nil
+}
+
+// Seal encrypts plaintext.
+func (b *Box) Seal(plaintext string) (string, error) {
+	aead, err := b.aead(b.salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := bytes.Join([][]byte{b.salt, nonce, aead.Seal(nil, nonce, []byte(plaintext), nil)}, nil)
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal.
+func (b *Box) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return "", errors.New("not a sealed value")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed value: %v", err)
+	}
+	if len(sealed) < saltSize {
+		return "", ErrWrongKey
+	}
+	aead, err := b.aead(sealed[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	rest := sealed[saltSize:]
+	if len(rest) < aead.NonceSize() {
+		return "", ErrWrongKey
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	return string(plaintext), nil
+}
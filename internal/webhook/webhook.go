@@ -0,0 +1,101 @@
+// Package webhook posts JSON payloads to HTTP endpoints, signed with an
+// HMAC-SHA256 of the body so receivers can check where they came from.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// EventHeader names the event of a delivery
+	EventHeader = "X-GitWatcher-Event"
+	// DeliveryHeader identifies a delivery, the same across its retries
+	DeliveryHeader = "X-GitWatcher-Delivery"
+	// SignatureHeader holds "sha256=" and the hex HMAC of the body, set when
+	// the endpoint has a secret
+	SignatureHeader = "X-GitWatcher-Signature-256"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Delivery is a payload to post to an endpoint.
+type Delivery struct {
+	URL    string
+	Secret string
+	Event  string
+	ID     string
+	Body   []byte
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature, in the format of SignatureHeader, is the
+// signature of body with secret. GitHub signs its webhooks the same way.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Send posts d once. Responses other than 2xx are errors. Errors leave out
+// the URL, which may embed a token.
+func Send(ctx context.Context, d Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitWatcher-Webhook")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	if d.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.Secret, d.Body))
+	}
+
+	resp, err := client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SendWithRetry sends d up to attempts times, waiting longer after each
+// failure, and returns the last error.
+func SendWithRetry(ctx context.Context, d Delivery, attempts int) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = Send(ctx, d); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Duration(attempt*attempt) * time.Second):
+			}
+		}
+	}
+	return err
+}